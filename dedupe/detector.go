@@ -0,0 +1,235 @@
+package dedupe
+
+import (
+	"math"
+	"sort"
+
+	"github.com/Afra1m/product_api/models"
+)
+
+// DefaultThreshold задает минимальное сходство названий по умолчанию
+const DefaultThreshold = 0.8
+
+// Оценки совпадений, не зависящие от текста названия
+const (
+	keyScore  = 1.0
+	nameScore = 0.95
+)
+
+// Detector находит вероятные дубликаты. Продукты с одинаковым SKU или
+// штрихкодом считаются дубликатами всегда, с одинаковым нормализованным
+// названием — с оценкой 0.95, а с похожими названиями — если коэффициент
+// Жаккара их триграмм не меньше Threshold.
+type Detector struct {
+	Threshold float64
+}
+
+// NewDetector создает детектор дубликатов с порогом threshold
+func NewDetector(threshold float64) *Detector {
+	return &Detector{Threshold: threshold}
+}
+
+// pairKey упорядочивает пару индексов продуктов
+type pairKey struct {
+	a, b int
+}
+
+// FindClusters группирует вероятные дубликаты в кластеры. Переданный срез
+// не изменяется.
+//
+// Похожие названия ищутся фильтрацией по префиксу: триграммы каждого
+// названия упорядочиваются от редких к частым, и кандидатами становятся
+// только пары с общей триграммой среди первых |x| - ⌈Threshold·|x|⌉ + 1
+// триграмм каждого названия. Пара со сходством не ниже порога обязательно
+// делит такую триграмму, поэтому результат совпадает с попарным
+// сравнением, а частые триграммы, общие для большей части каталога, в
+// префиксы почти не попадают и не порождают пар.
+func (d *Detector) FindClusters(products []models.Product) []models.DuplicateCluster {
+	products = append([]models.Product(nil), products...)
+	sort.Slice(products, func(i, j int) bool {
+		return products[i].ID < products[j].ID
+	})
+
+	matches := make(map[pairKey]*models.DuplicateMatch)
+	addReason := func(i, j int, reason string, score float64) {
+		if i > j {
+			i, j = j, i
+		}
+		key := pairKey{i, j}
+		match, exists := matches[key]
+		if !exists {
+			match = &models.DuplicateMatch{ProductID: products[i].ID, OtherID: products[j].ID}
+			matches[key] = match
+		}
+		match.Reasons = append(match.Reasons, reason)
+		match.Score = math.Max(match.Score, score)
+	}
+
+	// Совпадения по ключам
+	matchKeys(len(products), func(i int) string { return products[i].SKU }, func(i, j int) {
+		addReason(i, j, models.DuplicateSKU, keyScore)
+	})
+	matchKeys(len(products), func(i int) string { return products[i].Barcode }, func(i, j int) {
+		addReason(i, j, models.DuplicateBarcode, keyScore)
+	})
+
+	// Совпадения по нормализованным названиям
+	names := make([]string, len(products))
+	for i, product := range products {
+		names[i] = NormalizeName(product.Name)
+	}
+	matchKeys(len(products), func(i int) string { return names[i] }, func(i, j int) {
+		addReason(i, j, models.DuplicateName, nameScore)
+	})
+
+	// Похожие названия через обратный индекс префиксов триграмм
+	trigrams := make([]map[string]bool, len(products))
+	frequency := make(map[string]int)
+	for i, name := range names {
+		if name == "" {
+			continue
+		}
+		trigrams[i] = Trigrams(name)
+		for trigram := range trigrams[i] {
+			frequency[trigram]++
+		}
+	}
+
+	index := make(map[string][]int)
+	candidates := make(map[pairKey]bool)
+	for i, set := range trigrams {
+		if len(set) == 0 {
+			continue
+		}
+		for _, trigram := range d.prefix(set, frequency) {
+			for _, j := range index[trigram] {
+				candidates[pairKey{j, i}] = true
+			}
+			index[trigram] = append(index[trigram], i)
+		}
+	}
+	for key := range candidates {
+		if names[key.a] == names[key.b] {
+			continue
+		}
+		similarity := Jaccard(trigrams[key.a], trigrams[key.b])
+		if similarity >= d.Threshold {
+			addReason(key.a, key.b, models.DuplicateSimilarName, math.Round(similarity*nameScore*1000)/1000)
+		}
+	}
+
+	return buildClusters(products, matches)
+}
+
+// prefix возвращает триграммы множества set, по которым отбираются
+// кандидаты: от самых редких в каталоге к частым, столько, чтобы название
+// со сходством не ниже Threshold делило с set хотя бы одну из них
+func (d *Detector) prefix(set map[string]bool, frequency map[string]int) []string {
+	ordered := make([]string, 0, len(set))
+	for trigram := range set {
+		ordered = append(ordered, trigram)
+	}
+	sort.Slice(ordered, func(i, j int) bool {
+		if frequency[ordered[i]] != frequency[ordered[j]] {
+			return frequency[ordered[i]] < frequency[ordered[j]]
+		}
+		return ordered[i] < ordered[j]
+	})
+
+	// Погрешность округления может только удлинить префикс
+	size := len(ordered) - int(math.Ceil(d.Threshold*float64(len(ordered))-1e-9)) + 1
+	if size < 1 {
+		size = 1
+	}
+	if size > len(ordered) {
+		size = len(ordered)
+	}
+	return ordered[:size]
+}
+
+// matchKeys вызывает match для каждой пары из n продуктов с одинаковым
+// непустым ключом
+func matchKeys(n int, key func(i int) string, match func(i, j int)) {
+	groups := make(map[string][]int)
+	for i := 0; i < n; i++ {
+		if k := key(i); k != "" {
+			groups[k] = append(groups[k], i)
+		}
+	}
+	for _, ids := range groups {
+		for x := 0; x < len(ids); x++ {
+			for y := x + 1; y < len(ids); y++ {
+				match(ids[x], ids[y])
+			}
+		}
+	}
+}
+
+// buildClusters объединяет связанные пары в кластеры системой непересекающихся множеств
+func buildClusters(products []models.Product, matches map[pairKey]*models.DuplicateMatch) []models.DuplicateCluster {
+	parent := make([]int, len(products))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	for key := range matches {
+		a, b := find(key.a), find(key.b)
+		if a < b {
+			parent[b] = a
+		} else if b < a {
+			parent[a] = b
+		}
+	}
+
+	byRoot := make(map[int]*models.DuplicateCluster)
+	for key, match := range matches {
+		root := find(key.a)
+		cluster, exists := byRoot[root]
+		if !exists {
+			cluster = &models.DuplicateCluster{ID: products[root].ID}
+			byRoot[root] = cluster
+		}
+		cluster.Matches = append(cluster.Matches, *match)
+		cluster.Score = math.Max(cluster.Score, match.Score)
+	}
+	for i, product := range products {
+		if cluster, exists := byRoot[find(i)]; exists {
+			cluster.Products = append(cluster.Products, product)
+		}
+	}
+
+	clusters := make([]models.DuplicateCluster, 0, len(byRoot))
+	for _, cluster := range byRoot {
+		reasons := make(map[string]bool)
+		for _, match := range cluster.Matches {
+			for _, reason := range match.Reasons {
+				reasons[reason] = true
+			}
+		}
+		for reason := range reasons {
+			cluster.Reasons = append(cluster.Reasons, reason)
+		}
+		sort.Strings(cluster.Reasons)
+		sort.Slice(cluster.Matches, func(i, j int) bool {
+			if cluster.Matches[i].ProductID != cluster.Matches[j].ProductID {
+				return cluster.Matches[i].ProductID < cluster.Matches[j].ProductID
+			}
+			return cluster.Matches[i].OtherID < cluster.Matches[j].OtherID
+		})
+		clusters = append(clusters, *cluster)
+	}
+
+	sort.Slice(clusters, func(i, j int) bool {
+		if clusters[i].Score != clusters[j].Score {
+			return clusters[i].Score > clusters[j].Score
+		}
+		return clusters[i].ID < clusters[j].ID
+	})
+	return clusters
+}
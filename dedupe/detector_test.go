@@ -0,0 +1,88 @@
+package dedupe
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/Afra1m/product_api/models"
+)
+
+// randomProducts возвращает n продуктов с названиями из небольшого словаря,
+// чтобы среди них были одинаковые и похожие названия
+func randomProducts(n int) []models.Product {
+	rnd := rand.New(rand.NewSource(1))
+	words := []string{"чайник", "чайники", "электрический", "стальной", "белый", "белая", "кружка", "1.7л", "2л", "xiaomi"}
+	products := make([]models.Product, n)
+	for i := range products {
+		name := make([]string, 1+rnd.Intn(4))
+		for w := range name {
+			name[w] = words[rnd.Intn(len(words))]
+		}
+		products[i] = models.Product{
+			ID:   fmt.Sprintf("p%04d", n-i),
+			Name: strings.Join(name, " "),
+			SKU:  fmt.Sprintf("SKU-%d", i),
+		}
+	}
+	return products
+}
+
+// similarPairs возвращает пары ID с похожими, но не одинаковыми
+// нормализованными названиями попарным сравнением
+func similarPairs(products []models.Product, threshold float64) []string {
+	var pairs []string
+	for i := range products {
+		for j := i + 1; j < len(products); j++ {
+			a, b := NormalizeName(products[i].Name), NormalizeName(products[j].Name)
+			if a == "" || b == "" || a == b || Jaccard(Trigrams(a), Trigrams(b)) < threshold {
+				continue
+			}
+			x, y := products[i].ID, products[j].ID
+			if x > y {
+				x, y = y, x
+			}
+			pairs = append(pairs, x+"/"+y)
+		}
+	}
+	sort.Strings(pairs)
+	return pairs
+}
+
+// TestFindClustersMatchesPairwise проверяет, что отбор кандидатов по
+// префиксам триграмм находит те же похожие названия, что и попарное
+// сравнение, и не меняет переданный срез
+func TestFindClustersMatchesPairwise(t *testing.T) {
+	products := randomProducts(300)
+	original := append([]models.Product(nil), products...)
+
+	for _, threshold := range []float64{0.3, 0.5, 0.8, 1} {
+		var found []string
+		for _, cluster := range NewDetector(threshold).FindClusters(products) {
+			for _, match := range cluster.Matches {
+				for _, reason := range match.Reasons {
+					if reason == models.DuplicateSimilarName {
+						found = append(found, match.ProductID+"/"+match.OtherID)
+					}
+				}
+			}
+		}
+		sort.Strings(found)
+
+		want := similarPairs(products, threshold)
+		if threshold < 1 && len(want) == 0 {
+			t.Fatalf("порог %v: в выборке нет похожих названий", threshold)
+		}
+		if strings.Join(found, ",") != strings.Join(want, ",") {
+			t.Fatalf("порог %v: найдено %d пар, попарным сравнением %d", threshold, len(found), len(want))
+		}
+	}
+
+	for i := range products {
+		if products[i].ID != original[i].ID {
+			t.Fatal("FindClusters изменил порядок переданных продуктов")
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package dedupe
+
+import (
+	"strings"
+	"unicode"
+)
+
+// NormalizeName приводит название к виду для сравнения: нижний регистр,
+// знаки препинания заменены пробелами, повторные пробелы удалены
+func NormalizeName(name string) string {
+	fields := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	return strings.Join(fields, " ")
+}
+
+// Trigrams возвращает множество триграмм нормализованной строки. Строка
+// дополняется пробелами, чтобы начало и конец слов давали свои триграммы.
+func Trigrams(normalized string) map[string]bool {
+	runes := []rune("  " + normalized + " ")
+	trigrams := make(map[string]bool)
+	for i := 0; i+3 <= len(runes); i++ {
+		trigrams[string(runes[i:i+3])] = true
+	}
+	return trigrams
+}
+
+// Jaccard возвращает коэффициент Жаккара двух множеств триграмм
+func Jaccard(a, b map[string]bool) float64 {
+	if len(a) == 0 && len(b) == 0 {
+		return 0
+	}
+
+	shared := 0
+	for trigram := range a {
+		if b[trigram] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(a)+len(b)-shared)
+}
@@ -0,0 +1,164 @@
+package events
+
+import (
+	"sync"
+
+	"github.com/Afra1m/product_api/models"
+)
+
+// DefaultReplaySize задает размер буфера событий для возобновления потока
+const DefaultReplaySize = 1000
+
+// subscriberBuffer задает размер очереди событий одного подписчика
+const subscriberBuffer = 64
+
+// StreamEvent представляет событие продукта с порядковым номером потока.
+// Номером служит ID записи outbox, поэтому номера не начинаются заново
+// после перезапуска, если outbox хранится в журнале.
+type StreamEvent struct {
+	ID    uint64
+	Event models.ProductEvent
+}
+
+// Filter ограничивает поток событиями категории или продукта.
+// Пустые поля не ограничивают поток.
+type Filter struct {
+	Category  string
+	ProductID string
+}
+
+// Matches сообщает, проходит ли событие через фильтр
+func (f Filter) Matches(event models.ProductEvent) bool {
+	if f.ProductID != "" && event.ProductID != f.ProductID {
+		return false
+	}
+	if f.Category != "" {
+		inCategory := event.Product != nil && event.Product.Category == f.Category
+		wasInCategory := event.Previous != nil && event.Previous.Category == f.Category
+		if !inCategory && !wasInCategory {
+			return false
+		}
+	}
+	return true
+}
+
+// Subscription представляет подписку на поток событий. Канал Events
+// закрывается, если подписчик не успевает читать события; клиент может
+// переподключиться с Last-Event-ID и получить пропущенное из буфера.
+type Subscription struct {
+	Events <-chan StreamEvent
+	// LastID содержит номер последнего события на момент подписки
+	LastID uint64
+	events chan StreamEvent
+	filter Filter
+}
+
+// Broker раздает события продуктов подписчикам и хранит последние события
+// в кольцевом буфере для возобновления потока. lastID хранит номер последнего
+// опубликованного события, в том числе опубликованного до запуска процесса.
+type Broker struct {
+	buffer      []StreamEvent
+	start       int
+	lastID      uint64
+	subscribers map[*Subscription]struct{}
+	mu          sync.Mutex
+}
+
+// NewBroker создает новый брокер событий с буфером указанного размера
+func NewBroker(replaySize int) *Broker {
+	if replaySize <= 0 {
+		replaySize = DefaultReplaySize
+	}
+	return &Broker{
+		buffer:      make([]StreamEvent, 0, replaySize),
+		subscribers: make(map[*Subscription]struct{}),
+	}
+}
+
+// Resume сообщает брокеру, что события с номерами до lastID включительно
+// были опубликованы до запуска процесса и в буфер уже не попадут
+func (b *Broker) Resume(lastID uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if lastID > b.lastID {
+		b.lastID = lastID
+	}
+}
+
+// Publish сохраняет событие с номером id в буфере и рассылает подписчикам.
+// Номера должны возрастать; событие с уже опубликованным номером считается
+// повторной доставкой и пропускается. Метод не блокируется на медленных
+// подписчиках.
+func (b *Broker) Publish(id uint64, event models.ProductEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if id <= b.lastID {
+		return
+	}
+	b.lastID = id
+	streamEvent := StreamEvent{ID: id, Event: event}
+	if len(b.buffer) < cap(b.buffer) {
+		b.buffer = append(b.buffer, streamEvent)
+	} else {
+		b.buffer[b.start] = streamEvent
+		b.start = (b.start + 1) % len(b.buffer)
+	}
+
+	for sub := range b.subscribers {
+		if !sub.filter.Matches(event) {
+			continue
+		}
+		select {
+		case sub.events <- streamEvent:
+		default:
+			// Подписчик отстал: закрываем поток, чтобы клиент переподключился
+			close(sub.events)
+			delete(b.subscribers, sub)
+		}
+	}
+}
+
+// Subscribe создает подписку и возвращает события из буфера с номером
+// больше lastEventID. Пропущенные события и новые события не теряются
+// и не дублируются, так как выборка и регистрация выполняются атомарно.
+//
+// Если пропущенных событий уже нет в буфере или lastEventID неизвестен
+// брокеру (например, выдан до перезапуска без журнала outbox), события не
+// возвращаются, а reset равен true: клиенту нужно заново прочитать данные,
+// после чего поток продолжается с номера LastID.
+func (b *Broker) Subscribe(lastEventID uint64, filter Filter) (replay []StreamEvent, reset bool, sub *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	oldest := b.lastID + 1
+	if len(b.buffer) > 0 {
+		oldest = b.buffer[b.start].ID
+	}
+	reset = lastEventID > b.lastID || lastEventID > 0 && lastEventID+1 < oldest
+	if lastEventID > 0 && !reset {
+		for i := 0; i < len(b.buffer); i++ {
+			streamEvent := b.buffer[(b.start+i)%len(b.buffer)]
+			if streamEvent.ID > lastEventID && filter.Matches(streamEvent.Event) {
+				replay = append(replay, streamEvent)
+			}
+		}
+	}
+
+	events := make(chan StreamEvent, subscriberBuffer)
+	sub = &Subscription{Events: events, events: events, filter: filter, LastID: b.lastID}
+	b.subscribers[sub] = struct{}{}
+	return replay, reset, sub
+}
+
+// Unsubscribe отменяет подписку
+func (b *Broker) Unsubscribe(sub *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, exists := b.subscribers[sub]; exists {
+		close(sub.events)
+		delete(b.subscribers, sub)
+	}
+}
@@ -0,0 +1,151 @@
+package exporter
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Afra1m/product_api/importer"
+	"github.com/Afra1m/product_api/models"
+)
+
+// Fields содержит все поля продукта, доступные для выборки, в порядке вывода
+var Fields = []string{
+	"id", "name", "description", "price", "category", "stock", "created_at", "updated_at",
+	"discount", "featured", "popularity", "views", "tags", "sku", "barcode", "weight",
+	"dimensions", "volumetric_weight", "status", "reorder_point", "safety_stock", "attributes",
+	"history",
+}
+
+// TabularFields содержит поля, выгружаемые в CSV и XLSX по умолчанию.
+// История изменений в табличные форматы не выгружается.
+var TabularFields = Fields[:len(Fields)-1]
+
+// ParseFields разбирает список полей через запятую. Пустая строка означает
+// поля по умолчанию и возвращает nil.
+func ParseFields(value string) ([]string, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	var fields []string
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if !isField(field) {
+			return nil, fmt.Errorf("неизвестное поле %q", field)
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+// Select возвращает только указанные поля продукта
+func Select(product models.Product, fields []string) map[string]interface{} {
+	selected := make(map[string]interface{}, len(fields))
+	for _, field := range fields {
+		selected[field] = Value(product, field)
+	}
+	return selected
+}
+
+// Value возвращает значение поля продукта
+func Value(product models.Product, field string) interface{} {
+	switch field {
+	case "id":
+		return product.ID
+	case "name":
+		return product.Name
+	case "description":
+		return product.Description
+	case "price":
+		return product.Price
+	case "category":
+		return product.Category
+	case "stock":
+		return product.Stock
+	case "created_at":
+		return product.CreatedAt
+	case "updated_at":
+		return product.UpdatedAt
+	case "discount":
+		return product.Discount
+	case "featured":
+		return product.Featured
+	case "popularity":
+		return product.Popularity
+	case "views":
+		return product.Views
+	case "tags":
+		return product.Tags
+	case "sku":
+		return product.SKU
+	case "barcode":
+		return product.Barcode
+	case "weight":
+		return product.Weight
+	case "dimensions":
+		return product.Dimensions
+	case "volumetric_weight":
+		return product.VolumetricWeight
+	case "status":
+		return product.Status
+	case "reorder_point":
+		return product.ReorderPoint
+	case "safety_stock":
+		return product.SafetyStock
+	case "attributes":
+		return product.Attributes
+	case "history":
+		return product.History
+	default:
+		return nil
+	}
+}
+
+// FormatValue преобразует значение поля в строку для табличных форматов.
+// Теги объединяются тем же разделителем, что ожидает импорт, вес и габариты
+// записываются в том же виде, в каком их разбирает импорт, а атрибуты и
+// остальные составные значения, например история, — в JSON.
+func FormatValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case int:
+		return strconv.Itoa(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case time.Time:
+		return v.Format(time.RFC3339)
+	case []string:
+		return strings.Join(v, importer.TagSeparator)
+	case models.Attributes:
+		if len(v) == 0 {
+			return ""
+		}
+		data, _ := json.Marshal(v)
+		return string(data)
+	case fmt.Stringer:
+		return v.String()
+	case nil:
+		return ""
+	default:
+		data, err := json.Marshal(v)
+		if err != nil || string(data) == "null" {
+			return ""
+		}
+		return string(data)
+	}
+}
+
+func isField(field string) bool {
+	for _, f := range Fields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
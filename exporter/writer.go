@@ -0,0 +1,169 @@
+package exporter
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+
+	"github.com/Afra1m/product_api/models"
+)
+
+// Format описывает формат выгрузки
+type Format struct {
+	ContentType string
+	Extension   string
+}
+
+// Formats содержит поддерживаемые форматы выгрузки
+var Formats = map[string]Format{
+	"json":   {ContentType: "application/json; charset=utf-8", Extension: "json"},
+	"ndjson": {ContentType: "application/x-ndjson; charset=utf-8", Extension: "ndjson"},
+	"csv":    {ContentType: "text/csv; charset=utf-8", Extension: "csv"},
+	"xlsx":   {ContentType: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", Extension: "xlsx"},
+}
+
+// Writer последовательно записывает продукты в выгрузку, не накапливая их в памяти
+type Writer interface {
+	// Write записывает продукт
+	Write(product models.Product) error
+	// Flush передает записанные данные в нижележащий поток
+	Flush() error
+	// Close завершает документ, не закрывая нижележащий поток
+	Close() error
+}
+
+// NewWriter создает Writer для формата. Если fields пуст, JSON и NDJSON
+// содержат продукты целиком, а CSV и XLSX — столбцы TabularFields.
+func NewWriter(format string, w io.Writer, fields []string) (Writer, error) {
+	switch format {
+	case "json":
+		return &jsonWriter{w: bufio.NewWriter(w), fields: fields}, nil
+	case "ndjson":
+		return &ndjsonWriter{w: bufio.NewWriter(w), fields: fields}, nil
+	case "csv":
+		if len(fields) == 0 {
+			fields = TabularFields
+		}
+		return &csvWriter{w: csv.NewWriter(w), fields: fields}, nil
+	case "xlsx":
+		if len(fields) == 0 {
+			fields = TabularFields
+		}
+		return newXLSXWriter(w, fields)
+	default:
+		return nil, errors.New("неподдерживаемый формат выгрузки")
+	}
+}
+
+func marshalProduct(product models.Product, fields []string) ([]byte, error) {
+	if len(fields) == 0 {
+		return json.Marshal(product)
+	}
+	return json.Marshal(Select(product, fields))
+}
+
+// jsonWriter записывает JSON-массив продуктов
+type jsonWriter struct {
+	w       *bufio.Writer
+	fields  []string
+	written bool
+}
+
+func (j *jsonWriter) Write(product models.Product) error {
+	data, err := marshalProduct(product, j.fields)
+	if err != nil {
+		return err
+	}
+
+	separator := ","
+	if !j.written {
+		separator = "["
+		j.written = true
+	}
+	if _, err := j.w.WriteString(separator); err != nil {
+		return err
+	}
+	_, err = j.w.Write(data)
+	return err
+}
+
+func (j *jsonWriter) Flush() error {
+	return j.w.Flush()
+}
+
+func (j *jsonWriter) Close() error {
+	closing := "]"
+	if !j.written {
+		closing = "[]"
+	}
+	if _, err := j.w.WriteString(closing); err != nil {
+		return err
+	}
+	return j.w.Flush()
+}
+
+// ndjsonWriter записывает по одному продукту в строке
+type ndjsonWriter struct {
+	w      *bufio.Writer
+	fields []string
+}
+
+func (n *ndjsonWriter) Write(product models.Product) error {
+	data, err := marshalProduct(product, n.fields)
+	if err != nil {
+		return err
+	}
+	if _, err := n.w.Write(data); err != nil {
+		return err
+	}
+	return n.w.WriteByte('\n')
+}
+
+func (n *ndjsonWriter) Flush() error {
+	return n.w.Flush()
+}
+
+func (n *ndjsonWriter) Close() error {
+	return n.w.Flush()
+}
+
+// csvWriter записывает CSV с заголовком из имен полей
+type csvWriter struct {
+	w             *csv.Writer
+	fields        []string
+	headerWritten bool
+}
+
+func (c *csvWriter) writeHeader() error {
+	if c.headerWritten {
+		return nil
+	}
+	c.headerWritten = true
+	return c.w.Write(c.fields)
+}
+
+func (c *csvWriter) Write(product models.Product) error {
+	if err := c.writeHeader(); err != nil {
+		return err
+	}
+
+	record := make([]string, len(c.fields))
+	for i, field := range c.fields {
+		record[i] = FormatValue(Value(product, field))
+	}
+	return c.w.Write(record)
+}
+
+func (c *csvWriter) Flush() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+func (c *csvWriter) Close() error {
+	if err := c.writeHeader(); err != nil {
+		return err
+	}
+	return c.Flush()
+}
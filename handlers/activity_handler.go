@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+
+	"github.com/Afra1m/product_api/models"
+	"github.com/Afra1m/product_api/recommend"
+)
+
+// ActivityHandler представляет собой обработчик событий поведения покупателей
+type ActivityHandler struct {
+	recommender *recommend.Recommender
+}
+
+// NewActivityHandler создает новый обработчик событий поведения
+func NewActivityHandler(recommender *recommend.Recommender) *ActivityHandler {
+	return &ActivityHandler{recommender: recommender}
+}
+
+// RecordEvents принимает одно событие или массив событий. Некорректные события
+// и события несуществующих продуктов отклоняются, остальные учитываются.
+func (h *ActivityHandler) RecordEvents(c *gin.Context) {
+	body, err := c.GetRawData()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var events []models.ActivityEvent
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '[' {
+		err = json.Unmarshal(body, &events)
+	} else {
+		var event models.ActivityEvent
+		err = json.Unmarshal(body, &event)
+		events = append(events, event)
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result := models.ActivityResult{}
+	now := time.Now()
+	for i, event := range events {
+		if err := binding.Validator.ValidateStruct(event); err != nil {
+			result.Errors = append(result.Errors, models.ActivityEventError{Index: i, Error: err.Error()})
+			continue
+		}
+		if event.Timestamp.IsZero() {
+			event.Timestamp = now
+		}
+
+		if err := h.recommender.Record(event); err != nil {
+			result.Errors = append(result.Errors, models.ActivityEventError{Index: i, Error: err.Error()})
+			continue
+		}
+		result.Accepted++
+	}
+	result.Rejected = len(result.Errors)
+
+	c.JSON(http.StatusOK, result)
+}
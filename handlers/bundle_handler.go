@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Afra1m/product_api/models"
+	"github.com/Afra1m/product_api/storage"
+)
+
+// GetProductBundle возвращает состав набора и наличие компонентов
+func (h *ProductHandler) GetProductBundle(c *gin.Context) {
+	details, err := h.storage.GetBundle(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, details)
+}
+
+// SetProductBundle задает состав набора и способ расчета его цены
+func (h *ProductHandler) SetProductBundle(c *gin.Context) {
+	var input models.BundleInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	bundle, err := models.NewBundle(input)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if _, err := h.storage.GetByID(c.Param("id")); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	product, err := h.storage.SetBundle(c.Param("id"), bundle)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, storage.ErrInvalidComponent) ||
+			errors.Is(err, storage.ErrComponentInUse) ||
+			errors.Is(err, storage.ErrBundleVariants) {
+			status = http.StatusConflict
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, product)
+}
+
+// AdjustProductStock изменяет остаток продукта на delta. Продажа набора
+// списывает все его компоненты.
+func (h *ProductHandler) AdjustProductStock(c *gin.Context) {
+	var input models.StockAdjustmentInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	product, err := h.storage.AdjustStock(c.Param("id"), input.Delta)
+	if err != nil {
+		c.JSON(stockErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, product)
+}
+
+// stockErrorStatus возвращает HTTP-статус ошибки изменения остатка или
+// другого поля продукта: 409, если остаток выводится из вариантов или товара
+// не хватает, 400, если продукт не прошел проверку, иначе 404
+func stockErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, storage.ErrVariantParentStock) || errors.Is(err, storage.ErrInsufficientStock):
+		return http.StatusConflict
+	case storage.IsInvalid(err):
+		return http.StatusBadRequest
+	}
+	return http.StatusNotFound
+}
@@ -0,0 +1,344 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/Afra1m/product_api/models"
+	"github.com/Afra1m/product_api/storage"
+	"github.com/Afra1m/product_api/validation"
+)
+
+// CategoryHandler представляет собой обработчик дерева категорий
+type CategoryHandler struct {
+	categories *storage.CategoryStorage
+	products   *storage.ProductStorage
+}
+
+// NewCategoryHandler создает новый обработчик категорий
+func NewCategoryHandler(categories *storage.CategoryStorage, products *storage.ProductStorage) *CategoryHandler {
+	return &CategoryHandler{categories: categories, products: products}
+}
+
+// GetAllCategories возвращает список категорий, а с параметром tree=true —
+// дерево категорий
+func (h *CategoryHandler) GetAllCategories(c *gin.Context) {
+	if c.Query("tree") == "true" {
+		c.JSON(http.StatusOK, h.categories.Tree())
+		return
+	}
+	c.JSON(http.StatusOK, h.categories.GetAll())
+}
+
+// GetCategory возвращает категорию по ID или slug
+func (h *CategoryHandler) GetCategory(c *gin.Context) {
+	category, err := h.categories.Get(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, category)
+}
+
+// GetCategoryBreadcrumbs возвращает путь от корня дерева до категории
+func (h *CategoryHandler) GetCategoryBreadcrumbs(c *gin.Context) {
+	category, err := h.categories.Get(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, h.categories.Breadcrumbs(category.ID))
+}
+
+// CreateCategory создает новую категорию
+func (h *CategoryHandler) CreateCategory(c *gin.Context) {
+	var input models.CategoryInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	parentID, ok := h.resolveParent(c, input.ParentID)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	category := models.Category{
+		ID:         uuid.New().String(),
+		Slug:       input.Slug,
+		Name:       input.Name,
+		ParentID:   parentID,
+		Position:   input.Position,
+		Attributes: input.Attributes,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	if err := h.categories.Create(category); err != nil {
+		c.JSON(categoryErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, category)
+}
+
+// UpdateCategory обновляет категорию. При смене slug продукты категории
+// переносятся на новый slug. Изменение, после которого продукты категории
+// или ее потомков не прошли бы проверку по новой схеме, отклоняется с 409.
+func (h *CategoryHandler) UpdateCategory(c *gin.Context) {
+	var input models.CategoryInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	existing, err := h.categories.Get(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	parentID, ok := h.resolveParent(c, input.ParentID)
+	if !ok {
+		return
+	}
+	input.ParentID = parentID
+
+	var category models.Category
+	err = h.products.ChangeCategories(func(change storage.CategoryChange) error {
+		if err := h.checkProducts(existing, input); err != nil {
+			return err
+		}
+		oldCategory, updated, err := h.categories.Update(existing.ID, input)
+		if err != nil {
+			return err
+		}
+		// Дерево меняется первым, чтобы продукты проверялись по новой схеме
+		// категории; если перенести их не удалось, изменение дерева отменяется
+		if _, err := change.ReassignCategory(oldCategory.Slug, updated.Slug); err != nil {
+			if restoreErr := h.categories.Restore(oldCategory); restoreErr != nil {
+				log.Println("Не удалось отменить изменение категории:", restoreErr)
+			}
+			return reassignError{err}
+		}
+		category = updated
+		return nil
+	})
+	if err != nil {
+		respondCategoryError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, category)
+}
+
+// MoveCategory переносит категорию вместе с потомками к другому родителю.
+// Продукты остаются в своих категориях и переезжают вместе с ними.
+func (h *CategoryHandler) MoveCategory(c *gin.Context) {
+	var input models.CategoryMoveInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	existing, err := h.categories.Get(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	parentID, ok := h.resolveParent(c, input.ParentID)
+	if !ok {
+		return
+	}
+
+	var category models.Category
+	err = h.products.ChangeCategories(func(storage.CategoryChange) error {
+		// Схема категории наследуется от предков, поэтому у нового родителя
+		// могут быть свои обязательные атрибуты
+		if err := h.checkProducts(existing, models.CategoryInput{
+			Slug:       existing.Slug,
+			Name:       existing.Name,
+			ParentID:   parentID,
+			Position:   existing.Position,
+			Attributes: existing.Attributes,
+		}); err != nil {
+			return err
+		}
+		moved, err := h.categories.Move(existing.ID, parentID, input.Position)
+		category = moved
+		return err
+	})
+	if err != nil {
+		respondCategoryError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, category)
+}
+
+// MergeCategory сливает категорию в target_id: продукты и дочерние категории
+// переходят в target_id, а исходная категория удаляется
+func (h *CategoryHandler) MergeCategory(c *gin.Context) {
+	var input models.CategoryMergeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	existing, err := h.categories.Get(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	target, err := h.categories.Get(input.TargetID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	var result models.CategoryMergeResult
+	err = h.products.ChangeCategories(func(change storage.CategoryChange) error {
+		source, target, children, err := h.categories.Merge(existing.ID, target.ID)
+		if err != nil {
+			return err
+		}
+		movedProducts, err := change.ReassignCategory(source.Slug, target.Slug)
+		if err != nil {
+			// Возвращаем источник и его дочерние категории на место
+			if restoreErr := h.categories.Restore(append(children, source)...); restoreErr != nil {
+				log.Println("Не удалось отменить слияние категорий:", restoreErr)
+			}
+			return reassignError{err}
+		}
+		result = models.CategoryMergeResult{
+			Target:        target,
+			MovedProducts: movedProducts,
+			MovedChildren: len(children),
+		}
+		return nil
+	})
+	if err != nil {
+		respondCategoryError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// DeleteCategory удаляет категорию без дочерних категорий и продуктов
+func (h *CategoryHandler) DeleteCategory(c *gin.Context) {
+	category, err := h.categories.Get(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	err = h.products.ChangeCategories(func(storage.CategoryChange) error {
+		if len(h.products.GetByCategory(category.Slug)) > 0 {
+			return errCategoryHasProducts
+		}
+		return h.categories.Delete(category.ID)
+	})
+	if err != nil {
+		respondCategoryError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// errCategoryHasProducts запрещает удалять категорию, в которой есть продукты
+var errCategoryHasProducts = errors.New("в категории есть продукты; перенесите их или слейте категорию")
+
+// invalidProductsError сообщает, что продукты не пройдут проверку по новой
+// схеме категории
+type invalidProductsError struct {
+	ids []string
+}
+
+func (e *invalidProductsError) Error() string {
+	return "атрибуты продуктов не соответствуют новой схеме категории"
+}
+
+// reassignError сообщает, что продукты не удалось перенести в другую
+// категорию, и изменение дерева отменено
+type reassignError struct {
+	err error
+}
+
+func (e reassignError) Error() string { return e.err.Error() }
+func (e reassignError) Unwrap() error { return e.err }
+
+// checkProducts проверяет атрибуты продуктов категории existing и ее
+// потомков по схемам дерева, в котором категория уже изменена с input, и
+// возвращает invalidProductsError с ID продуктов, не прошедших проверку:
+// иначе после изменения схемы любая запись в эти продукты отклонялась бы.
+// Вызывается внутри ChangeCategories, чтобы продукты не менялись до
+// изменения дерева.
+func (h *CategoryHandler) checkProducts(existing models.Category, input models.CategoryInput) error {
+	tree, err := h.categories.Preview(existing.ID, input)
+	if err != nil {
+		return err
+	}
+
+	var invalid []string
+	check := func(product models.Product) {
+		if len(validation.AttributeErrors(product, tree)) > 0 {
+			invalid = append(invalid, product.ID)
+		}
+	}
+	for _, product := range h.products.GetByCategory(existing.Slug) {
+		product.Category = input.Slug
+		check(product)
+	}
+	for _, descendant := range tree.Descendants(existing.ID) {
+		for _, product := range h.products.GetByCategory(descendant.Slug) {
+			check(product)
+		}
+	}
+	if len(invalid) > 0 {
+		sort.Strings(invalid)
+		return &invalidProductsError{ids: invalid}
+	}
+	return nil
+}
+
+// respondCategoryError отвечает на ошибку изменения дерева категорий
+func respondCategoryError(c *gin.Context, err error) {
+	var invalid *invalidProductsError
+	var reassign reassignError
+	switch {
+	case errors.As(err, &invalid):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "product_ids": invalid.ids})
+	case errors.As(err, &reassign):
+		c.JSON(storageErrorStatus(reassign.err), gin.H{"error": err.Error()})
+	default:
+		c.JSON(categoryErrorStatus(err), gin.H{"error": err.Error()})
+	}
+}
+
+// resolveParent находит родительскую категорию по ID или slug. Пустая
+// ссылка означает корень дерева.
+func (h *CategoryHandler) resolveParent(c *gin.Context, ref string) (string, bool) {
+	if ref == "" {
+		return "", true
+	}
+	parent, err := h.categories.Get(ref)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "родительская категория не найдена"})
+		return "", false
+	}
+	return parent.ID, true
+}
+
+// categoryErrorStatus возвращает HTTP-статус ошибки изменения категории
+func categoryErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, storage.ErrCategoryNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, storage.ErrDuplicateSlug), errors.Is(err, storage.ErrCategoryCycle),
+		errors.Is(err, storage.ErrCategoryNotEmpty), errors.Is(err, errCategoryHasProducts):
+		return http.StatusConflict
+	default:
+		return http.StatusBadRequest
+	}
+}
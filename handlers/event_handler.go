@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+
+	"github.com/Afra1m/product_api/events"
+)
+
+// heartbeatInterval задает период отправки комментариев, поддерживающих соединение
+const heartbeatInterval = 15 * time.Second
+
+// EventHandler представляет собой обработчик потока событий продуктов
+type EventHandler struct {
+	broker *events.Broker
+}
+
+// NewEventHandler создает новый обработчик потока событий
+func NewEventHandler(broker *events.Broker) *EventHandler {
+	return &EventHandler{broker: broker}
+}
+
+// StreamProductEvents передает события изменения продуктов по Server-Sent Events.
+// Клиент может возобновить поток с заголовком Last-Event-ID (или параметром
+// last_event_id) и ограничить его параметрами category и product_id. Если
+// пропущенные события восстановить нельзя, первым отправляется событие
+// reset с номером, с которого продолжается поток.
+func (h *EventHandler) StreamProductEvents(c *gin.Context) {
+	lastEventIDStr := c.GetHeader("Last-Event-ID")
+	if lastEventIDStr == "" {
+		lastEventIDStr = c.Query("last_event_id")
+	}
+
+	var lastEventID uint64
+	if lastEventIDStr != "" {
+		var err error
+		lastEventID, err = strconv.ParseUint(lastEventIDStr, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "неверный формат Last-Event-ID"})
+			return
+		}
+	}
+
+	filter := events.Filter{
+		Category:  c.Query("category"),
+		ProductID: c.Query("product_id"),
+	}
+	replay, reset, sub := h.broker.Subscribe(lastEventID, filter)
+	defer h.broker.Unsubscribe(sub)
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	if reset {
+		c.Render(-1, sse.Event{
+			Id:    strconv.FormatUint(sub.LastID, 10),
+			Event: "reset",
+			Data:  gin.H{"last_event_id": sub.LastID},
+		})
+	}
+	for _, event := range replay {
+		renderStreamEvent(c, event)
+	}
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case event, ok := <-sub.Events:
+			if !ok {
+				return false
+			}
+			renderStreamEvent(c, event)
+			return true
+		case <-heartbeat.C:
+			_, err := io.WriteString(w, ": ping\n\n")
+			return err == nil
+		}
+	})
+}
+
+func renderStreamEvent(c *gin.Context, event events.StreamEvent) {
+	c.Render(-1, sse.Event{
+		Id:    strconv.FormatUint(event.ID, 10),
+		Event: event.Event.Type,
+		Data:  event.Event,
+	})
+}
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Afra1m/product_api/models"
+	"github.com/Afra1m/product_api/storage"
+)
+
+// InventoryHandler представляет собой обработчик для управления запасами
+type InventoryHandler struct {
+	storage *storage.ProductStorage
+}
+
+// NewInventoryHandler создает новый обработчик запасов
+func NewInventoryHandler(storage *storage.ProductStorage) *InventoryHandler {
+	return &InventoryHandler{storage: storage}
+}
+
+// GetPolicies возвращает политики запасов категорий
+func (h *InventoryHandler) GetPolicies(c *gin.Context) {
+	policies := h.storage.GetPolicies()
+	c.JSON(http.StatusOK, policies)
+}
+
+// SetPolicy устанавливает точку перезаказа и страховой запас категории
+func (h *InventoryHandler) SetPolicy(c *gin.Context) {
+	var input models.InventoryPolicyInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	policy := models.InventoryPolicy{
+		Category:     c.Param("category"),
+		ReorderPoint: input.ReorderPoint,
+		SafetyStock:  input.SafetyStock,
+	}
+	h.storage.SetPolicy(policy)
+
+	c.JSON(http.StatusOK, policy)
+}
+
+// DeletePolicy удаляет политику запасов категории
+func (h *InventoryHandler) DeletePolicy(c *gin.Context) {
+	if err := h.storage.DeletePolicy(c.Param("category")); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// GetReorderReport возвращает список товаров для перезаказа с рекомендуемым количеством
+func (h *InventoryHandler) GetReorderReport(c *gin.Context) {
+	windowDays, err := strconv.Atoi(c.DefaultQuery("window_days", "30"))
+	if err != nil || windowDays <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверный формат периода расчета"})
+		return
+	}
+
+	coverDays, err := strconv.Atoi(c.DefaultQuery("cover_days", "14"))
+	if err != nil || coverDays < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверный формат периода покрытия"})
+		return
+	}
+
+	report := h.storage.GetReorderReport(c.Query("category"), windowDays, coverDays)
+	c.JSON(http.StatusOK, report)
+}
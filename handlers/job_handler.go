@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Afra1m/product_api/jobs"
+	"github.com/Afra1m/product_api/storage"
+)
+
+// JobHandler представляет собой обработчик для фоновых задач
+type JobHandler struct {
+	storage *storage.JobStorage
+	runner  *jobs.Runner
+}
+
+// NewJobHandler создает новый обработчик задач
+func NewJobHandler(storage *storage.JobStorage, runner *jobs.Runner) *JobHandler {
+	return &JobHandler{storage: storage, runner: runner}
+}
+
+// GetAllJobs возвращает все задачи, начиная с самых новых
+func (h *JobHandler) GetAllJobs(c *gin.Context) {
+	c.JSON(http.StatusOK, h.storage.GetAll())
+}
+
+// GetJobByID возвращает задачу и ход ее выполнения
+func (h *JobHandler) GetJobByID(c *gin.Context) {
+	job, err := h.storage.GetByID(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
+
+// GetJobErrors возвращает отчет об ошибках строк. По умолчанию отчет
+// выгружается файлом CSV, параметр format=json возвращает его в JSON.
+func (h *JobHandler) GetJobErrors(c *gin.Context) {
+	id := c.Param("id")
+	rowErrors, err := h.storage.GetErrors(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	switch c.DefaultQuery("format", "csv") {
+	case "json":
+		c.JSON(http.StatusOK, rowErrors)
+	case "csv":
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		c.Header("Content-Disposition", `attachment; filename="job-`+id+`-errors.csv"`)
+		c.Status(http.StatusOK)
+
+		w := csv.NewWriter(c.Writer)
+		w.Write([]string{"row", "sku", "errors"})
+		for _, rowError := range rowErrors {
+			w.Write([]string{strconv.Itoa(rowError.Row), rowError.SKU, strings.Join(rowError.Errors, "; ")})
+		}
+		w.Flush()
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неподдерживаемый формат отчета"})
+	}
+}
+
+// CancelJob отменяет незавершенную задачу
+func (h *JobHandler) CancelJob(c *gin.Context) {
+	id := c.Param("id")
+	if _, err := h.storage.GetByID(id); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	job, err := h.runner.Cancel(id)
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
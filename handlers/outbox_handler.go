@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Afra1m/product_api/models"
+	"github.com/Afra1m/product_api/storage"
+)
+
+// OutboxHandler представляет собой обработчик для администрирования outbox
+type OutboxHandler struct {
+	storage *storage.ProductStorage
+}
+
+// NewOutboxHandler создает новый обработчик outbox
+func NewOutboxHandler(storage *storage.ProductStorage) *OutboxHandler {
+	return &OutboxHandler{storage: storage}
+}
+
+// GetOutboxEntries возвращает записи outbox. Параметр status принимает
+// значения pending, failed и delivered; без него возвращаются
+// ожидающие и неудавшиеся записи.
+func (h *OutboxHandler) GetOutboxEntries(c *gin.Context) {
+	status := c.Query("status")
+	switch status {
+	case "", models.OutboxPending, models.OutboxFailed, models.OutboxDelivered:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверный статус записи outbox"})
+		return
+	}
+
+	entries := h.storage.GetOutbox(status)
+	c.JSON(http.StatusOK, entries)
+}
+
+// GetOutboxStats возвращает количество записей outbox по статусам
+func (h *OutboxHandler) GetOutboxStats(c *gin.Context) {
+	stats := h.storage.GetOutboxStats()
+	c.JSON(http.StatusOK, stats)
+}
+
+// GetOutboxEntry возвращает запись outbox по ID
+func (h *OutboxHandler) GetOutboxEntry(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверный формат ID записи"})
+		return
+	}
+
+	entry, err := h.storage.GetOutboxEntry(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, entry)
+}
+
+// RetryOutboxEntry возвращает неудавшуюся запись outbox в очередь на публикацию
+func (h *OutboxHandler) RetryOutboxEntry(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверный формат ID записи"})
+		return
+	}
+
+	if _, err := h.storage.GetOutboxEntry(id); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	entry, err := h.storage.RetryOutbox(id)
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, entry)
+}
@@ -1,34 +1,91 @@
 package handlers
 
 import (
+	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
 
+	"github.com/Afra1m/product_api/dedupe"
+	"github.com/Afra1m/product_api/exporter"
+	"github.com/Afra1m/product_api/importer"
+	"github.com/Afra1m/product_api/jobs"
 	"github.com/Afra1m/product_api/models"
+	"github.com/Afra1m/product_api/recommend"
 	"github.com/Afra1m/product_api/storage"
+	"github.com/Afra1m/product_api/validation"
 )
 
 // ProductHandler представляет собой обработчик для продуктов
 type ProductHandler struct {
-	storage *storage.ProductStorage
+	storage    *storage.ProductStorage
+	jobs       *jobs.Runner
+	validator  *validation.Validator
+	recommend  *recommend.Recommender
+	categories *storage.CategoryStorage
 }
 
 // NewProductHandler создает новый обработчик продуктов
-func NewProductHandler(storage *storage.ProductStorage) *ProductHandler {
-	return &ProductHandler{storage: storage}
+func NewProductHandler(storage *storage.ProductStorage, jobs *jobs.Runner, validator *validation.Validator, recommender *recommend.Recommender, categories *storage.CategoryStorage) *ProductHandler {
+	return &ProductHandler{storage: storage, jobs: jobs, validator: validator, recommend: recommender, categories: categories}
 }
 
-// GetAllProducts возвращает список всех продуктов
+// GetAllProducts возвращает список продуктов. Параметры фильтрации описаны
+// в parseProductFilter, параметр fields ограничивает набор полей ответа.
 func (h *ProductHandler) GetAllProducts(c *gin.Context) {
-	products := h.storage.GetAll()
-	c.JSON(http.StatusOK, products)
+	filter, err := parseProductFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	fields, err := exporter.ParseFields(c.Query("fields"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	offset, limit, err := parsePage(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Сортировка идет по упорядоченному индексу, обход которого
+	// останавливается, как только набрано limit продуктов. Без sort список
+	// упорядочен по дате создания и ID, чтобы страницы не пересекались и не
+	// теряли продукты.
+	sortBy := c.DefaultQuery("sort", storage.SortCreatedAt)
+	desc := strings.HasPrefix(sortBy, "-")
+	products, err := h.storage.GetSorted(strings.TrimPrefix(sortBy, "-"), desc, filter, offset, limit)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := convertUnits(c, products); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(fields) == 0 {
+		c.JSON(http.StatusOK, products)
+		return
+	}
+
+	selected := make([]map[string]interface{}, len(products))
+	for i, product := range products {
+		selected[i] = exporter.Select(product, fields)
+	}
+	c.JSON(http.StatusOK, selected)
 }
 
-// GetProductByID возвращает продукт по ID
+// GetProductByID возвращает продукт по ID вместе с путем к его категории
 func (h *ProductHandler) GetProductByID(c *gin.Context) {
 	id := c.Param("id")
 	product, err := h.storage.GetByID(id)
@@ -36,7 +93,23 @@ func (h *ProductHandler) GetProductByID(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, product)
+
+	// Открытие карточки продукта учитывается как просмотр
+	view := models.ActivityEvent{Type: models.ActivityView, ProductID: id, Timestamp: time.Now()}
+	if err := h.recommend.Record(view); err == nil {
+		product.Views++
+	}
+
+	if system := c.Query("units"); system != "" {
+		if err := product.ConvertUnits(system); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	c.JSON(http.StatusOK, models.ProductWithBreadcrumbs{
+		Product:     product,
+		Breadcrumbs: h.categories.Breadcrumbs(product.Category),
+	})
 }
 
 // CreateProduct создает новый продукт
@@ -47,28 +120,13 @@ func (h *ProductHandler) CreateProduct(c *gin.Context) {
 		return
 	}
 
-	now := time.Now()
-	product := models.Product{
-		ID:          uuid.New().String(),
-		Name:        input.Name,
-		Description: input.Description,
-		Price:       input.Price,
-		Category:    input.Category,
-		Stock:       input.Stock,
-		CreatedAt:   now,
-		UpdatedAt:   now,
-		Discount:    input.Discount,
-		Featured:    input.Featured,
-		Tags:        input.Tags,
-		SKU:         input.SKU,
-		Barcode:     input.Barcode,
-		Weight:      input.Weight,
-		Dimensions:  input.Dimensions,
-		Status:      input.Status,
+	product := models.NewProduct(input, time.Now())
+	if !h.validate(c, product) {
+		return
 	}
 
 	if err := h.storage.Create(product); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(storageErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -90,25 +148,20 @@ func (h *ProductHandler) UpdateProduct(c *gin.Context) {
 		return
 	}
 
-	existingProduct.Name = input.Name
-	existingProduct.Description = input.Description
-	existingProduct.Price = input.Price
-	existingProduct.Category = input.Category
-	existingProduct.Stock = input.Stock
-	existingProduct.Discount = input.Discount
-	existingProduct.Featured = input.Featured
-	existingProduct.Tags = input.Tags
-	existingProduct.SKU = input.SKU
-	existingProduct.Barcode = input.Barcode
-	existingProduct.Weight = input.Weight
-	existingProduct.Dimensions = input.Dimensions
-	existingProduct.Status = input.Status
+	existingProduct.ApplyInput(input)
 	existingProduct.UpdatedAt = time.Now()
+	if !h.validate(c, existingProduct) {
+		return
+	}
 
 	if err := h.storage.Update(id, existingProduct); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(storageErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
+	// Остаток родителя и поля варианта хранилище выводит из семейства вариантов
+	if updated, err := h.storage.GetByID(id); err == nil {
+		existingProduct = updated
+	}
 
 	c.JSON(http.StatusOK, existingProduct)
 }
@@ -117,16 +170,89 @@ func (h *ProductHandler) UpdateProduct(c *gin.Context) {
 func (h *ProductHandler) DeleteProduct(c *gin.Context) {
 	id := c.Param("id")
 	if err := h.storage.Delete(id); err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		status := http.StatusNotFound
+		if errors.Is(err, storage.ErrComponentInUse) {
+			status = http.StatusConflict
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
 		return
 	}
 	c.Status(http.StatusNoContent)
 }
 
-// GetProductsByCategory возвращает продукты по категории
+// GetProductBySKU возвращает продукт по SKU
+func (h *ProductHandler) GetProductBySKU(c *gin.Context) {
+	product, err := h.storage.GetBySKU(c.Param("sku"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, product)
+}
+
+// GetProductByBarcode возвращает продукт по штрихкоду
+func (h *ProductHandler) GetProductByBarcode(c *gin.Context) {
+	product, err := h.storage.GetByBarcode(c.Param("code"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, product)
+}
+
+// UpsertProductBySKU обновляет продукт с SKU из пути или создает его,
+// если такого SKU еще нет
+func (h *ProductHandler) UpsertProductBySKU(c *gin.Context) {
+	sku := c.Param("sku")
+	var input models.ProductInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if input.SKU != "" && input.SKU != sku {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "SKU в теле запроса не совпадает с SKU в пути"})
+		return
+	}
+	input.SKU = sku
+
+	product := models.NewProduct(input, time.Now())
+	if !h.validate(c, product) {
+		return
+	}
+
+	result, err := h.storage.Upsert(product)
+	if err != nil {
+		c.JSON(storageErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	if result.Created {
+		c.JSON(http.StatusCreated, result.Product)
+		return
+	}
+	c.JSON(http.StatusOK, result.Product)
+}
+
+// GetProductsByCategory возвращает продукты по категории. Категория задается
+// slug, ID зарегистрированной категории или, для категорий вне дерева,
+// строкой из поля category продукта. С параметром include_descendants=true
+// возвращаются и продукты всех подкатегорий.
 func (h *ProductHandler) GetProductsByCategory(c *gin.Context) {
-	category := c.Param("category")
-	products := h.storage.GetByCategory(category)
+	slugs := []string{c.Param("category")}
+	if category, err := h.categories.Get(c.Param("category")); err == nil {
+		slugs = []string{category.Slug}
+		if c.Query("include_descendants") == "true" {
+			for _, descendant := range h.categories.Descendants(category.ID) {
+				slugs = append(slugs, descendant.Slug)
+			}
+		}
+	}
+
+	var products []models.Product
+	for _, slug := range slugs {
+		products = append(products, h.storage.GetByCategory(slug)...)
+	}
 	c.JSON(http.StatusOK, products)
 }
 
@@ -188,7 +314,7 @@ func (h *ProductHandler) UpdateProductStock(c *gin.Context) {
 	}
 
 	if err := h.storage.UpdateStock(id, input.Stock); err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		c.JSON(stockErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -219,28 +345,14 @@ func (h *ProductHandler) CreateBatchProducts(c *gin.Context) {
 	now := time.Now()
 
 	for i, in := range input {
-		products[i] = models.Product{
-			ID:          uuid.New().String(),
-			Name:        in.Name,
-			Description: in.Description,
-			Price:       in.Price,
-			Category:    in.Category,
-			Stock:       in.Stock,
-			CreatedAt:   now,
-			UpdatedAt:   now,
-			Discount:    in.Discount,
-			Featured:    in.Featured,
-			Tags:        in.Tags,
-			SKU:         in.SKU,
-			Barcode:     in.Barcode,
-			Weight:      in.Weight,
-			Dimensions:  in.Dimensions,
-			Status:      in.Status,
+		products[i] = models.NewProduct(in, now)
+		if !h.validate(c, products[i]) {
+			return
 		}
 	}
 
 	if err := h.storage.CreateBatch(products); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(storageErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -255,34 +367,29 @@ func (h *ProductHandler) UpdateBatchProducts(c *gin.Context) {
 		return
 	}
 
+	// Все продукты читаются из одного снимка, чтобы пакет видел
+	// согласованное состояние каталога
+	snapshot := h.storage.Snapshot()
+
 	updates := make(map[string]models.Product)
 	for _, id := range input.IDs {
-		product, err := h.storage.GetByID(id)
+		product, err := snapshot.GetByID(id)
 		if err != nil {
 			c.JSON(http.StatusNotFound, gin.H{"error": "продукт с ID " + id + " не найден"})
 			return
 		}
 
-		product.Name = input.Update.Name
-		product.Description = input.Update.Description
-		product.Price = input.Update.Price
-		product.Category = input.Update.Category
-		product.Stock = input.Update.Stock
-		product.Discount = input.Update.Discount
-		product.Featured = input.Update.Featured
-		product.Tags = input.Update.Tags
-		product.SKU = input.Update.SKU
-		product.Barcode = input.Update.Barcode
-		product.Weight = input.Update.Weight
-		product.Dimensions = input.Update.Dimensions
-		product.Status = input.Update.Status
+		product.ApplyInput(input.Update)
 		product.UpdatedAt = time.Now()
+		if !h.validate(c, product) {
+			return
+		}
 
 		updates[id] = product
 	}
 
 	if err := h.storage.UpdateBatch(updates); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(storageErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -301,7 +408,14 @@ func (h *ProductHandler) DeleteBatchProducts(c *gin.Context) {
 	}
 
 	if err := h.storage.DeleteBatch(input.IDs); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		status := storageErrorStatus(err)
+		switch {
+		case errors.Is(err, storage.ErrProductNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, storage.ErrComponentInUse):
+			status = http.StatusConflict
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
 		return
 	}
 
@@ -364,63 +478,80 @@ func (h *ProductHandler) UpdateProductDiscount(c *gin.Context) {
 	}
 
 	if err := h.storage.UpdateDiscount(id, input.Discount); err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		c.JSON(stockErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
 	c.Status(http.StatusOK)
 }
 
-// GetSimilarProducts возвращает похожие продукты
+// GetSimilarProducts возвращает до limit (по умолчанию 10, максимум 100) наиболее
+// похожих продуктов с оценками. Параметр in_stock=true исключает продукты без запаса.
 func (h *ProductHandler) GetSimilarProducts(c *gin.Context) {
-	id := c.Param("id")
-	product, err := h.storage.GetByID(id)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if err != nil || limit <= 0 || limit > recommend.MaxNeighbors {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверный формат лимита"})
 		return
 	}
 
-	products := h.storage.GetAll()
-	var similar []models.Product
-	for _, p := range products {
-		if p.ID != id && p.Category == product.Category {
-			similar = append(similar, p)
-		}
+	snapshot, ok := h.snapshot(c)
+	if !ok {
+		return
+	}
+
+	inStock := c.Query("in_stock") == "true"
+	similar, err := h.recommend.Similar.Find(snapshot, c.Param("id"), limit, inStock)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
 	}
 
 	c.JSON(http.StatusOK, similar)
 }
 
-// GetRelatedProducts возвращает связанные продукты
+// GetRelatedProducts возвращает до limit (по умолчанию 10) продуктов, связанных
+// с продуктом совместными просмотрами и покупками и общими тегами
 func (h *ProductHandler) GetRelatedProducts(c *gin.Context) {
-	id := c.Param("id")
-	product, err := h.storage.GetByID(id)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if err != nil || limit <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверный формат лимита"})
 		return
 	}
 
-	products := h.storage.GetAll()
-	var related []models.Product
-	for _, p := range products {
-		if p.ID != id && hasCommonTags(p.Tags, product.Tags) {
-			related = append(related, p)
-		}
+	snapshot, ok := h.snapshot(c)
+	if !ok {
+		return
+	}
+
+	product, err := snapshot.GetByID(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
 	}
 
-	c.JSON(http.StatusOK, related)
+	c.JSON(http.StatusOK, h.recommend.Related.Find(snapshot, product, limit))
 }
 
-// GetTrendingProducts возвращает трендовые продукты
+// GetTrendingProducts возвращает продукты с наибольшей оценкой недавнего
+// интереса. Параметр half_life (например, 6h) задает период полураспада.
 func (h *ProductHandler) GetTrendingProducts(c *gin.Context) {
 	limitStr := c.DefaultQuery("limit", "10")
 	limit, err := strconv.Atoi(limitStr)
-	if err != nil {
+	if err != nil || limit < 0 {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "неверный формат лимита"})
 		return
 	}
 
-	products := h.storage.GetPopular(limit)
+	var halfLife time.Duration
+	if value := c.Query("half_life"); value != "" {
+		halfLife, err = time.ParseDuration(value)
+		if err != nil || halfLife <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "неверный формат периода полураспада"})
+			return
+		}
+	}
+
+	products := h.recommend.Trending.Top(time.Now(), halfLife, limit)
 	c.JSON(http.StatusOK, products)
 }
 
@@ -443,57 +574,186 @@ func (h *ProductHandler) UpdateProductFeature(c *gin.Context) {
 	}
 
 	if err := h.storage.UpdateFeature(id, input.Featured); err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		c.JSON(stockErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
 	c.Status(http.StatusOK)
 }
 
-// ExportProducts экспортирует продукты
+// ExportProducts выгружает продукты в формате format (json, ndjson, csv, xlsx)
+// в виде файла. Продукты читаются из хранилища порциями и сразу передаются
+// клиенту. Поддерживаются те же фильтры и параметр fields, что и в списке продуктов.
 func (h *ProductHandler) ExportProducts(c *gin.Context) {
-	products := h.storage.GetAll()
-	c.JSON(http.StatusOK, products)
+	formatName := c.DefaultQuery("format", "json")
+	format, supported := exporter.Formats[formatName]
+	if !supported {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неподдерживаемый формат выгрузки"})
+		return
+	}
+
+	filter, err := parseProductFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	fields, err := exporter.ParseFields(c.Query("fields"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if _, _, err := models.UnitSystem(c.Query("units")); c.Query("units") != "" && err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	filename := "products-" + time.Now().Format("20060102-150405") + "." + format.Extension
+	c.Header("Content-Type", format.ContentType)
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Status(http.StatusOK)
+
+	writer, err := exporter.NewWriter(formatName, c.Writer, fields)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	err = h.storage.ForEachChunk(filter, exportChunkSize, func(products []models.Product) error {
+		convertUnits(c, products)
+		for _, product := range products {
+			if err := writer.Write(product); err != nil {
+				return err
+			}
+		}
+		if err := writer.Flush(); err != nil {
+			return err
+		}
+		c.Writer.Flush()
+		return nil
+	})
+	if err == nil {
+		err = writer.Close()
+	}
+	if err != nil {
+		// Заголовки уже отправлены, поэтому о прерванной выгрузке можно только записать в лог
+		c.Error(err)
+	}
 }
 
-// ImportProducts импортирует продукты
+// GetProductChanges возвращает ленту изменений продуктов после номера since.
+// Удаленные продукты передаются записями типа delete без продукта.
+func (h *ProductHandler) GetProductChanges(c *gin.Context) {
+	since, err := strconv.ParseUint(c.DefaultQuery("since", "0"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверный формат номера изменения"})
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit <= 0 || limit > 1000 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверный формат лимита"})
+		return
+	}
+
+	feed := h.storage.GetChanges(since, limit)
+	c.JSON(http.StatusOK, feed)
+}
+
+// ImportProducts импортирует продукты из JSON-массива или CSV (multipart-поле
+// file или тело с Content-Type text/csv). Продукты с уже известным SKU
+// обновляются, остальные создаются. Если хотя бы одна строка содержит ошибки,
+// ничего не сохраняется и возвращаются ошибки всех строк; с skip_invalid=true
+// такие строки пропускаются, а остальные сохраняются. С dry_run=true
+// выполняется только проверка.
 func (h *ProductHandler) ImportProducts(c *gin.Context) {
-	var input []models.ProductInput
-	if err := c.ShouldBindJSON(&input); err != nil {
+	dryRun := c.Query("dry_run") == "true"
+	skipInvalid := c.Query("skip_invalid") == "true"
+
+	source, err := readImportSource(c)
+	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	products := make([]models.Product, len(input))
-	now := time.Now()
+	// Большие файлы обрабатываются фоновой задачей, ход которой доступен в /api/jobs
+	if c.Query("async") == "true" {
+		job, err := h.jobs.StartImport(source, dryRun, skipInvalid)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.Header("Location", "/api/jobs/"+job.ID)
+		c.JSON(http.StatusAccepted, job)
+		return
+	}
 
-	for i, in := range input {
-		products[i] = models.Product{
-			ID:          uuid.New().String(),
-			Name:        in.Name,
-			Description: in.Description,
-			Price:       in.Price,
-			Category:    in.Category,
-			Stock:       in.Stock,
-			CreatedAt:   now,
-			UpdatedAt:   now,
-			Discount:    in.Discount,
-			Featured:    in.Featured,
-			Tags:        in.Tags,
-			SKU:         in.SKU,
-			Barcode:     in.Barcode,
-			Weight:      in.Weight,
-			Dimensions:  in.Dimensions,
-			Status:      in.Status,
+	rows, err := source.Parse()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	h.validator.ValidateRows(rows)
+
+	result := models.ImportResult{
+		DryRun: dryRun,
+		Total:  len(rows),
+		Errors: []models.ImportRowError{},
+	}
+
+	valid := make([]importer.Row, 0, len(rows))
+	for _, row := range rows {
+		if !row.Valid() {
+			result.Errors = append(result.Errors, models.ImportRowError{
+				Row:    row.Line,
+				SKU:    row.Input.SKU,
+				Errors: row.Errors,
+			})
+			continue
 		}
+		valid = append(valid, row)
 	}
+	result.Failed = len(result.Errors)
 
-	if err := h.storage.CreateBatch(products); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if dryRun {
+		skus := make([]string, 0, len(valid))
+		for _, row := range valid {
+			skus = append(skus, row.Input.SKU)
+		}
+		existing := h.storage.ExistingSKUs(skus)
+		for _, row := range valid {
+			if sku := row.Input.SKU; sku != "" && existing[sku] {
+				result.Updated++
+			} else {
+				result.Created++
+				if sku != "" {
+					// Повтор SKU в файле обновит продукт, созданный предыдущей строкой
+					existing[sku] = true
+				}
+			}
+		}
+		c.JSON(http.StatusOK, result)
 		return
 	}
 
-	c.JSON(http.StatusCreated, products)
+	if result.Failed > 0 && !skipInvalid {
+		c.JSON(http.StatusUnprocessableEntity, result)
+		return
+	}
+
+	saved, err := h.jobs.Save(valid, time.Now(), skipInvalid)
+	if err != nil {
+		c.JSON(storageErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	result.Created = saved.Created
+	result.Updated = saved.Updated
+	result.Products = saved.Products
+	result.Errors = append(result.Errors, saved.Errors...)
+	result.Failed = len(result.Errors)
+	c.JSON(http.StatusOK, result)
 }
 
 // ValidateProduct проверяет валидность продукта
@@ -505,31 +765,118 @@ func (h *ProductHandler) ValidateProduct(c *gin.Context) {
 		return
 	}
 
-	validation := make(map[string]bool)
-	validation["name"] = product.Name != ""
-	validation["price"] = product.Price > 0
-	validation["category"] = product.Category != ""
-	validation["stock"] = product.Stock >= 0
-	validation["sku"] = product.SKU != ""
-	validation["barcode"] = product.Barcode != ""
+	report := h.validator.Report(product)
+	report.Checks = map[string]bool{
+		"name":     product.Name != "",
+		"price":    product.Price > 0,
+		"category": product.Category != "",
+		"stock":    product.Stock >= 0,
+		"sku":      product.SKU != "",
+		"barcode":  product.Barcode != "",
+	}
+	for _, err := range report.Errors {
+		report.Checks[err.Field] = false
+	}
 
-	c.JSON(http.StatusOK, validation)
+	c.JSON(http.StatusOK, report)
 }
 
-// GetDuplicateProducts возвращает дубликаты продуктов
-func (h *ProductHandler) GetDuplicateProducts(c *gin.Context) {
-	products := h.storage.GetAll()
-	duplicates := make(map[string][]models.Product)
+// ValidateCatalog проверяет все продукты правилами каталога и возвращает
+// отчет о качестве. Параметр category ограничивает проверку категорией,
+// severity=error|warning оставляет продукты с нарушениями этого уровня.
+func (h *ProductHandler) ValidateCatalog(c *gin.Context) {
+	severity := c.Query("severity")
+	switch severity {
+	case "", models.SeverityError, models.SeverityWarning:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверный уровень нарушений"})
+		return
+	}
+
+	report := models.CatalogValidationReport{
+		GeneratedAt: time.Now(),
+		ByRule:      make(map[string]int),
+		Products:    []models.ValidationReport{},
+	}
+	filter := models.ProductFilter{Category: c.Query("category")}
+	err := h.storage.ForEachChunk(filter, exportChunkSize, func(products []models.Product) error {
+		for _, product := range products {
+			result := h.validator.Report(product)
+			report.Total++
+			if result.Valid {
+				report.Valid++
+			} else {
+				report.WithErrors++
+			}
+			if len(result.Warnings) > 0 {
+				report.WithWarnings++
+			}
+			for _, err := range result.Errors {
+				report.ByRule[err.Rule]++
+			}
+			for _, err := range result.Warnings {
+				report.ByRule[err.Rule]++
+			}
 
-	for _, p1 := range products {
-		for _, p2 := range products {
-			if p1.ID != p2.ID && p1.Name == p2.Name {
-				duplicates[p1.Name] = append(duplicates[p1.Name], p1, p2)
+			switch {
+			case severity == models.SeverityError && len(result.Errors) > 0,
+				severity == models.SeverityWarning && len(result.Warnings) > 0,
+				severity == "" && len(result.Errors)+len(result.Warnings) > 0:
+				report.Products = append(report.Products, result)
 			}
 		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// GetDuplicateProducts возвращает кластеры вероятных дубликатов с оценками
+// и причинами совпадения. Параметр threshold задает минимальное сходство
+// названий.
+func (h *ProductHandler) GetDuplicateProducts(c *gin.Context) {
+	threshold := dedupe.DefaultThreshold
+	if value := c.Query("threshold"); value != "" {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil || parsed <= 0 || parsed > 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "порог сходства должен быть числом от 0 до 1"})
+			return
+		}
+		threshold = parsed
+	}
+
+	snapshot, ok := h.snapshot(c)
+	if !ok {
+		return
+	}
+
+	clusters := dedupe.NewDetector(threshold).FindClusters(snapshot.GetAll())
+	c.JSON(http.StatusOK, clusters)
+}
+
+// MergeProducts сливает дубликаты source_ids в продукт target_id
+func (h *ProductHandler) MergeProducts(c *gin.Context) {
+	var input models.MergeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	product, err := h.storage.Merge(input.TargetID, input.SourceIDs)
+	if storage.IsConflict(err) || errors.Is(err, storage.ErrMergeSource) || errors.Is(err, storage.ErrMergeTarget) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 
-	c.JSON(http.StatusOK, duplicates)
+	c.JSON(http.StatusOK, product)
 }
 
 // GetOutOfStockProducts возвращает продукты, которых нет в наличии
@@ -538,13 +885,18 @@ func (h *ProductHandler) GetOutOfStockProducts(c *gin.Context) {
 	c.JSON(http.StatusOK, products)
 }
 
-// GetLowStockProducts возвращает продукты с низким запасом
+// GetLowStockProducts возвращает продукты с низким запасом.
+// Без параметра threshold порог определяется точкой перезаказа продукта или его категории.
+// Порог должен быть положительным: нулевой запас означает отсутствие товара.
 func (h *ProductHandler) GetLowStockProducts(c *gin.Context) {
-	thresholdStr := c.DefaultQuery("threshold", "10")
-	threshold, err := strconv.Atoi(thresholdStr)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "неверный формат порога"})
-		return
+	threshold := 0
+	if thresholdStr := c.Query("threshold"); thresholdStr != "" {
+		var err error
+		threshold, err = strconv.Atoi(thresholdStr)
+		if err != nil || threshold <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "порог должен быть положительным целым числом"})
+			return
+		}
 	}
 
 	products := h.storage.GetLowStock(threshold)
@@ -553,17 +905,250 @@ func (h *ProductHandler) GetLowStockProducts(c *gin.Context) {
 
 // Вспомогательные функции
 
-func contains(s, substr string) bool {
-	return len(substr) == 0 || len(s) >= len(substr) && s[0:len(substr)] == substr
+// exportChunkSize задает число продуктов, читаемых из хранилища за один раз при выгрузке
+const exportChunkSize = 500
+
+// parsePage разбирает параметры offset и limit списка продуктов.
+// Нулевой limit означает отсутствие ограничения.
+func parsePage(c *gin.Context) (int, int, error) {
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		return 0, 0, errors.New("неверный формат смещения")
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "0"))
+	if err != nil || limit < 0 {
+		return 0, 0, errors.New("неверный формат лимита")
+	}
+	return offset, limit, nil
+}
+
+// parseProductFilter разбирает параметры фильтрации списка продуктов:
+// category, tag, status, q, min_price, max_price, in_stock, featured
+func parseProductFilter(c *gin.Context) (models.ProductFilter, error) {
+	filter := models.ProductFilter{
+		Category: c.Query("category"),
+		Tag:      c.Query("tag"),
+		Status:   c.Query("status"),
+		Query:    c.Query("q"),
+	}
+
+	if value := c.Query("min_price"); value != "" {
+		min, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return filter, errors.New("неверный формат минимальной цены")
+		}
+		filter.MinPrice = &min
+	}
+	if value := c.Query("max_price"); value != "" {
+		max, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return filter, errors.New("неверный формат максимальной цены")
+		}
+		filter.MaxPrice = &max
+	}
+	if value := c.Query("in_stock"); value != "" {
+		inStock, err := strconv.ParseBool(value)
+		if err != nil {
+			return filter, errors.New("неверный формат параметра in_stock")
+		}
+		filter.InStock = &inStock
+	}
+	if value := c.Query("featured"); value != "" {
+		featured, err := strconv.ParseBool(value)
+		if err != nil {
+			return filter, errors.New("неверный формат параметра featured")
+		}
+		filter.Featured = &featured
+	}
+
+	bounds := []struct {
+		name   string
+		target **float64
+	}{
+		{"min_weight", &filter.MinWeight},
+		{"max_weight", &filter.MaxWeight},
+		{"min_volumetric_weight", &filter.MinVolumetricWeight},
+		{"max_volumetric_weight", &filter.MaxVolumetricWeight},
+	}
+	for _, bound := range bounds {
+		if value := c.Query(bound.name); value != "" {
+			weight, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return filter, errors.New("неверный формат параметра " + bound.name)
+			}
+			*bound.target = &weight
+		}
+	}
+
+	attributes, err := parseAttributeConditions(c)
+	if err != nil {
+		return filter, err
+	}
+	filter.Attributes = attributes
+	return filter, nil
 }
 
-func hasCommonTags(tags1, tags2 []string) bool {
-	for _, t1 := range tags1 {
-		for _, t2 := range tags2 {
-			if t1 == t2 {
-				return true
+// parseAttributeConditions разбирает условия на атрибуты из параметров вида
+// attr.<имя>=v1,v2 (любое из значений), attr.<имя>.min и attr.<имя>.max
+// (числовые границы). Условия упорядочены по имени атрибута.
+func parseAttributeConditions(c *gin.Context) ([]models.AttributeCondition, error) {
+	conditions := make(map[string]*models.AttributeCondition)
+	condition := func(name string) *models.AttributeCondition {
+		if conditions[name] == nil {
+			conditions[name] = &models.AttributeCondition{Name: name}
+		}
+		return conditions[name]
+	}
+
+	for key, values := range c.Request.URL.Query() {
+		name, found := strings.CutPrefix(key, "attr.")
+		if !found || name == "" || len(values) == 0 || values[0] == "" {
+			continue
+		}
+		value := values[0]
+
+		if base, found := strings.CutSuffix(name, ".min"); found && base != "" {
+			min, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return nil, errors.New("неверный формат параметра " + key)
 			}
+			condition(base).Min = &min
+			continue
+		}
+		if base, found := strings.CutSuffix(name, ".max"); found && base != "" {
+			max, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return nil, errors.New("неверный формат параметра " + key)
+			}
+			condition(base).Max = &max
+			continue
+		}
+		condition(name).Values = strings.Split(value, ",")
+	}
+
+	result := make([]models.AttributeCondition, 0, len(conditions))
+	for _, condition := range conditions {
+		result = append(result, *condition)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result, nil
+}
+
+// convertUnits переводит размеры и вес продуктов в систему единиц из
+// параметра units. Без параметра продукты не меняются.
+func convertUnits(c *gin.Context, products []models.Product) error {
+	system := c.Query("units")
+	if system == "" {
+		return nil
+	}
+	for i := range products {
+		if err := products[i].ConvertUnits(system); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readImportSource читает файл импорта из тела запроса в зависимости от его типа
+func readImportSource(c *gin.Context) (importer.Source, error) {
+	source := importer.Source{Format: importer.FormatJSON}
+	rawMapping := c.Query("mapping")
+
+	var body io.Reader = c.Request.Body
+	switch c.ContentType() {
+	case "multipart/form-data":
+		header, err := c.FormFile("file")
+		if err != nil {
+			return source, errors.New("файл для импорта не передан в поле 'file'")
+		}
+		file, err := header.Open()
+		if err != nil {
+			return source, err
+		}
+		defer file.Close()
+
+		body = file
+		if !strings.HasSuffix(strings.ToLower(header.Filename), ".json") {
+			source.Format = importer.FormatCSV
+		}
+		if mapping := c.PostForm("mapping"); mapping != "" {
+			rawMapping = mapping
+		}
+	case "text/csv", "application/csv":
+		source.Format = importer.FormatCSV
+	}
+
+	if source.Format == importer.FormatCSV {
+		var err error
+		source.Mapping, source.Delimiter, err = importOptions(c, rawMapping)
+		if err != nil {
+			return source, err
+		}
+	}
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return source, err
+	}
+	source.Data = data
+	return source, nil
+}
+
+// importOptions разбирает сопоставление столбцов (JSON-объект
+// {"столбец": "поле"}) и разделитель CSV из параметра delimiter
+func importOptions(c *gin.Context, rawMapping string) (importer.Mapping, rune, error) {
+	var mapping importer.Mapping
+	if rawMapping != "" {
+		if err := json.Unmarshal([]byte(rawMapping), &mapping); err != nil {
+			return nil, 0, errors.New("неверный формат сопоставления столбцов")
 		}
 	}
+
+	delimiter := ','
+	switch value := c.DefaultQuery("delimiter", ","); value {
+	case "tab", "\t":
+		delimiter = '\t'
+	case "semicolon":
+		// Точку с запятой нельзя передать в строке запроса без кодирования
+		delimiter = ';'
+	default:
+		runes := []rune(value)
+		if len(runes) != 1 {
+			return nil, 0, errors.New("разделитель должен состоять из одного символа")
+		}
+		delimiter = runes[0]
+	}
+	return mapping, delimiter, nil
+}
+
+// validate проверяет продукт правилами каталога. При нарушениях уровня error
+// отвечает 400 со списком нарушений и возвращает false; предупреждения
+// запись не останавливают.
+func (h *ProductHandler) validate(c *gin.Context, product models.Product) bool {
+	report := h.validator.Report(product)
+	if report.Valid {
+		return true
+	}
+
+	c.JSON(http.StatusBadRequest, gin.H{"error": report.Errors[0].Error(), "errors": report.Errors, "warnings": report.Warnings})
 	return false
 }
+
+// storageErrorStatus возвращает HTTP-статус ошибки сохранения продукта:
+// 409 при нарушении уникальности SKU или штрихкода, 400, если продукт не
+// прошел проверку, иначе 500
+func storageErrorStatus(err error) int {
+	switch {
+	case storage.IsConflict(err):
+		return http.StatusConflict
+	case storage.IsInvalid(err):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+func contains(s, substr string) bool {
+	return len(substr) == 0 || len(s) >= len(substr) && s[0:len(substr)] == substr
+}
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Afra1m/product_api/models"
+	"github.com/Afra1m/product_api/validation"
+)
+
+// ValidationHandler представляет собой обработчик для настройки проверки продуктов
+type ValidationHandler struct {
+	validator *validation.Validator
+}
+
+// NewValidationHandler создает новый обработчик настройки проверки
+func NewValidationHandler(validator *validation.Validator) *ValidationHandler {
+	return &ValidationHandler{validator: validator}
+}
+
+// GetRules возвращает правила проверки каталога
+func (h *ValidationHandler) GetRules(c *gin.Context) {
+	c.JSON(http.StatusOK, h.validator.GetRules())
+}
+
+// GetSKUPatterns возвращает шаблоны SKU категорий
+func (h *ValidationHandler) GetSKUPatterns(c *gin.Context) {
+	c.JSON(http.StatusOK, h.validator.GetSKUPatterns())
+}
+
+// SetSKUPattern устанавливает шаблон SKU категории. Категория "*" задает
+// шаблон для категорий без собственного шаблона.
+func (h *ValidationHandler) SetSKUPattern(c *gin.Context) {
+	var input models.SKUPatternInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	pattern := models.SKUPattern{
+		Category: c.Param("category"),
+		Pattern:  input.Pattern,
+	}
+	if err := h.validator.SetSKUPattern(pattern.Category, pattern.Pattern); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, pattern)
+}
+
+// DeleteSKUPattern удаляет шаблон SKU категории
+func (h *ValidationHandler) DeleteSKUPattern(c *gin.Context) {
+	if err := h.validator.DeleteSKUPattern(c.Param("category")); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Afra1m/product_api/models"
+	"github.com/Afra1m/product_api/storage"
+)
+
+// GetProductVariants возвращает варианты продукта и сводку их наличия
+func (h *ProductHandler) GetProductVariants(c *gin.Context) {
+	variants, err := h.storage.GetVariants(c.Param("id"))
+	if err != nil {
+		c.JSON(variantErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, variants)
+}
+
+// SetVariantAxes задает оси вариантов продукта
+func (h *ProductHandler) SetVariantAxes(c *gin.Context) {
+	var input models.VariantAxesInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if _, err := h.storage.GetByID(c.Param("id")); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	product, err := h.storage.SetVariantAxes(c.Param("id"), input.Axes)
+	if err != nil {
+		c.JSON(variantErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, product)
+}
+
+// CreateProductVariant создает вариант продукта
+func (h *ProductHandler) CreateProductVariant(c *gin.Context) {
+	var input models.VariantInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	parent, err := h.storage.GetByID(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	variant := models.NewVariant(parent, input, time.Now())
+	if !h.validate(c, variant) {
+		return
+	}
+
+	variant, err = h.storage.CreateVariant(parent.ID, variant)
+	if err != nil {
+		c.JSON(variantErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, variant)
+}
+
+// UpdateProductVariant изменяет опции, SKU, штрихкод, цену, остаток и статус
+// варианта продукта
+func (h *ProductHandler) UpdateProductVariant(c *gin.Context) {
+	var input models.VariantInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	existing, err := h.storage.GetByID(c.Param("variantId"))
+	if err != nil || existing.ParentID != c.Param("id") {
+		c.JSON(http.StatusNotFound, gin.H{"error": "вариант не найден"})
+		return
+	}
+
+	existing.ApplyVariantInput(input)
+	if !h.validate(c, existing) {
+		return
+	}
+
+	variant, err := h.storage.UpdateVariant(c.Param("id"), existing.ID, input)
+	if err != nil {
+		c.JSON(variantErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, variant)
+}
+
+// variantErrorStatus возвращает HTTP-статус ошибки операции с вариантами:
+// 409 при конфликте с существующими вариантами или ключами, 404 для
+// продукта без осей вариантов, иначе 400
+func variantErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, storage.ErrDuplicateVariant),
+		errors.Is(err, storage.ErrNestedVariant),
+		errors.Is(err, storage.ErrBundleVariants),
+		errors.Is(err, storage.ErrStockedParent),
+		storage.IsConflict(err):
+		return http.StatusConflict
+	case errors.Is(err, storage.ErrNotVariantParent):
+		return http.StatusNotFound
+	default:
+		return http.StatusBadRequest
+	}
+}
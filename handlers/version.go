@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Afra1m/product_api/storage"
+)
+
+// Заголовки версии каталога
+const (
+	// CatalogVersionHeader сообщает версию каталога, которую отражает ответ
+	CatalogVersionHeader = "X-Catalog-Version"
+	// MinCatalogVersionHeader задает минимальную версию каталога для чтения
+	MinCatalogVersionHeader = "X-Min-Catalog-Version"
+)
+
+// CatalogVersion добавляет к ответам заголовок X-Catalog-Version с текущей
+// версией каталога. Для записи это версия после ее применения: передав ее
+// в X-Min-Catalog-Version, клиент гарантирует, что последующее чтение
+// увидит его изменения. Обработчики, читающие из снимка, указывают версию
+// снимка сами.
+func CatalogVersion(products *storage.ProductStorage) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Writer = &versionWriter{ResponseWriter: c.Writer, products: products}
+		c.Next()
+	}
+}
+
+// versionWriter устанавливает заголовок версии непосредственно перед отправкой
+// ответа, чтобы учесть запись, выполненную обработчиком
+type versionWriter struct {
+	gin.ResponseWriter
+	products *storage.ProductStorage
+}
+
+func (w *versionWriter) setVersion() {
+	if w.Header().Get(CatalogVersionHeader) == "" {
+		w.Header().Set(CatalogVersionHeader, strconv.FormatUint(w.products.Version(), 10))
+	}
+}
+
+func (w *versionWriter) WriteHeader(code int) {
+	w.setVersion()
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *versionWriter) WriteHeaderNow() {
+	w.setVersion()
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+func (w *versionWriter) Write(data []byte) (int, error) {
+	w.setVersion()
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *versionWriter) WriteString(s string) (int, error) {
+	w.setVersion()
+	return w.ResponseWriter.WriteString(s)
+}
+
+// snapshot возвращает снимок каталога для обработчика, которому нужно
+// несколько согласованных чтений, и указывает его версию в ответе. Если
+// снимок старше версии из X-Min-Catalog-Version, отвечает 412.
+func (h *ProductHandler) snapshot(c *gin.Context) (*storage.Snapshot, bool) {
+	snapshot := h.storage.Snapshot()
+	if value := c.GetHeader(MinCatalogVersionHeader); value != "" {
+		minVersion, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "неверный формат версии каталога"})
+			return nil, false
+		}
+		if snapshot.Version() < minVersion {
+			c.JSON(http.StatusPreconditionFailed, gin.H{"error": "каталог еще не достиг запрошенной версии"})
+			return nil, false
+		}
+	}
+
+	c.Header(CatalogVersionHeader, strconv.FormatUint(snapshot.Version(), 10))
+	return snapshot, true
+}
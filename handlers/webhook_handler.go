@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/Afra1m/product_api/models"
+	"github.com/Afra1m/product_api/storage"
+	"github.com/Afra1m/product_api/webhooks"
+)
+
+// WebhookHandler представляет собой обработчик для управления вебхуками
+type WebhookHandler struct {
+	storage    *storage.WebhookStorage
+	dispatcher *webhooks.Dispatcher
+}
+
+// NewWebhookHandler создает новый обработчик вебхуков
+func NewWebhookHandler(storage *storage.WebhookStorage, dispatcher *webhooks.Dispatcher) *WebhookHandler {
+	return &WebhookHandler{storage: storage, dispatcher: dispatcher}
+}
+
+// GetAllWebhooks возвращает список всех вебхуков
+func (h *WebhookHandler) GetAllWebhooks(c *gin.Context) {
+	hooks := h.storage.GetAll()
+	for i := range hooks {
+		hooks[i].Secret = ""
+	}
+	c.JSON(http.StatusOK, hooks)
+}
+
+// GetWebhookByID возвращает вебхук по ID
+func (h *WebhookHandler) GetWebhookByID(c *gin.Context) {
+	webhook, err := h.storage.GetByID(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	webhook.Secret = ""
+	c.JSON(http.StatusOK, webhook)
+}
+
+// CreateWebhook регистрирует новый вебхук. Секрет для подписи возвращается
+// только в ответе на создание; если он не передан, генерируется случайный.
+func (h *WebhookHandler) CreateWebhook(c *gin.Context) {
+	var input models.WebhookInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateEventFilter(input.Events); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	secret := input.Secret
+	if secret == "" {
+		var err error
+		secret, err = generateSecret()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	now := time.Now()
+	webhook := models.Webhook{
+		ID:        uuid.New().String(),
+		URL:       input.URL,
+		Events:    input.Events,
+		Secret:    secret,
+		Active:    input.Active == nil || *input.Active,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	if err := h.storage.Create(webhook); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, webhook)
+}
+
+// UpdateWebhook обновляет существующий вебхук. Пустой секрет сохраняет прежний.
+func (h *WebhookHandler) UpdateWebhook(c *gin.Context) {
+	id := c.Param("id")
+	var input models.WebhookInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateEventFilter(input.Events); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	webhook, err := h.storage.GetByID(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	webhook.URL = input.URL
+	webhook.Events = input.Events
+	if input.Secret != "" {
+		webhook.Secret = input.Secret
+	}
+	if input.Active != nil {
+		webhook.Active = *input.Active
+	}
+	webhook.UpdatedAt = time.Now()
+
+	if err := h.storage.Update(id, webhook); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	webhook.Secret = ""
+	c.JSON(http.StatusOK, webhook)
+}
+
+// DeleteWebhook удаляет вебхук
+func (h *WebhookHandler) DeleteWebhook(c *gin.Context) {
+	if err := h.storage.Delete(c.Param("id")); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// GetDeliveries возвращает историю доставок вебхука
+func (h *WebhookHandler) GetDeliveries(c *gin.Context) {
+	deliveries, err := h.storage.GetDeliveries(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, deliveries)
+}
+
+// GetDelivery возвращает доставку вебхука с попытками
+func (h *WebhookHandler) GetDelivery(c *gin.Context) {
+	delivery, err := h.storage.GetDelivery(c.Param("delivery_id"))
+	if err != nil || delivery.WebhookID != c.Param("id") {
+		c.JSON(http.StatusNotFound, gin.H{"error": "доставка не найдена"})
+		return
+	}
+	c.JSON(http.StatusOK, delivery)
+}
+
+// RedeliverDelivery повторно отправляет доставку вебхука
+func (h *WebhookHandler) RedeliverDelivery(c *gin.Context) {
+	original, err := h.storage.GetDelivery(c.Param("delivery_id"))
+	if err != nil || original.WebhookID != c.Param("id") {
+		c.JSON(http.StatusNotFound, gin.H{"error": "доставка не найдена"})
+		return
+	}
+
+	delivery, err := h.dispatcher.Redeliver(original.ID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusAccepted, delivery)
+}
+
+// Вспомогательные функции
+
+func validateEventFilter(events []string) error {
+	for _, event := range events {
+		if event != "*" && !models.IsEventType(event) {
+			return errors.New("неизвестный тип события: " + event)
+		}
+	}
+	return nil
+}
+
+func generateSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,306 @@
+package importer
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin/binding"
+
+	"github.com/Afra1m/product_api/models"
+)
+
+// TagSeparator разделяет теги внутри одной ячейки CSV
+const TagSeparator = "|"
+
+// Форматы файлов импорта
+const (
+	FormatCSV  = "csv"
+	FormatJSON = "json"
+)
+
+// AttributePrefix начинает имя поля, заполняющего один атрибут продукта,
+// например attr.color
+const AttributePrefix = "attr."
+
+// Fields содержит поля продукта, которые можно заполнить из CSV. Столбец
+// attributes содержит JSON-объект со всеми атрибутами, а поля
+// AttributePrefix+имя заполняют отдельные атрибуты.
+var Fields = []string{
+	"name", "description", "price", "category", "stock", "discount", "featured",
+	"tags", "sku", "barcode", "weight", "dimensions", "status", "reorder_point", "safety_stock",
+	"attributes",
+}
+
+// Mapping сопоставляет заголовок столбца CSV полю продукта из Fields.
+// Столбцы, заголовок которых совпадает с именем поля, сопоставляются
+// автоматически; остальные столбцы без сопоставления игнорируются.
+type Mapping map[string]string
+
+// Source представляет загруженный файл импорта вместе с параметрами разбора
+type Source struct {
+	Format    string
+	Data      []byte
+	Mapping   Mapping
+	Delimiter rune
+}
+
+// Parse разбирает файл импорта в строки
+func (s Source) Parse() ([]Row, error) {
+	if s.Format == FormatCSV {
+		delimiter := s.Delimiter
+		if delimiter == 0 {
+			delimiter = ','
+		}
+		return ParseCSV(bytes.NewReader(s.Data), s.Mapping, delimiter)
+	}
+	return ParseJSON(bytes.NewReader(s.Data))
+}
+
+// Row представляет строку импорта. Line содержит номер строки в файле
+// (для JSON — порядковый номер элемента, начиная с 1).
+type Row struct {
+	Line   int
+	Input  models.ProductInput
+	Errors []string
+}
+
+// Valid сообщает, что строка не содержит ошибок
+func (r Row) Valid() bool {
+	return len(r.Errors) == 0
+}
+
+// ParseCSV читает продукты из CSV с заголовком в первой строке.
+// Ошибки отдельных строк сохраняются в Row.Errors; ошибка возвращается,
+// только если файл нельзя прочитать целиком или сопоставление неверно.
+func ParseCSV(r io.Reader, mapping Mapping, delimiter rune) ([]Row, error) {
+	reader := csv.NewReader(r)
+	reader.Comma = delimiter
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, errors.New("файл CSV пуст")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	columns, err := resolveColumns(header, mapping)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []Row
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				rows = append(rows, Row{Line: parseErr.Line, Errors: []string{parseErr.Err.Error()}})
+				continue
+			}
+			return nil, err
+		}
+
+		line, _ := reader.FieldPos(0)
+		row := Row{Line: line}
+		for i, value := range record {
+			field, mapped := columns[i]
+			if !mapped {
+				continue
+			}
+			if err := setField(&row.Input, field, strings.TrimSpace(value)); err != nil {
+				row.Errors = append(row.Errors, field+": "+err.Error())
+			}
+		}
+		if row.Valid() {
+			row.Errors = Validate(row.Input)
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// ParseJSON читает продукты из JSON-массива и проверяет каждый элемент отдельно
+func ParseJSON(r io.Reader) ([]Row, error) {
+	var inputs []models.ProductInput
+	if err := json.NewDecoder(r).Decode(&inputs); err != nil {
+		return nil, err
+	}
+
+	rows := make([]Row, len(inputs))
+	for i, input := range inputs {
+		rows[i] = Row{Line: i + 1, Input: input, Errors: Validate(input)}
+	}
+	return rows, nil
+}
+
+// Validate проверяет входные данные продукта по тем же правилам, что и API
+func Validate(input models.ProductInput) []string {
+	if err := binding.Validator.ValidateStruct(&input); err != nil {
+		return strings.Split(err.Error(), "\n")
+	}
+	return nil
+}
+
+// resolveColumns сопоставляет индексы столбцов полям продукта
+func resolveColumns(header []string, mapping Mapping) (map[int]string, error) {
+	for column, field := range mapping {
+		if !isField(field) {
+			return nil, fmt.Errorf("столбец %q сопоставлен неизвестному полю %q", column, field)
+		}
+	}
+
+	// Регистр имени поля не важен, а имя атрибута сохраняется как есть
+	columns := make(map[int]string)
+	for i, name := range header {
+		name = strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))
+		lower := strings.ToLower(name)
+		if field, mapped := mapping[name]; mapped {
+			columns[i] = field
+		} else if strings.HasPrefix(lower, AttributePrefix) && len(name) > len(AttributePrefix) {
+			columns[i] = AttributePrefix + name[len(AttributePrefix):]
+		} else if isField(lower) {
+			columns[i] = lower
+		}
+	}
+	return columns, nil
+}
+
+func isField(field string) bool {
+	if strings.HasPrefix(field, AttributePrefix) {
+		return len(field) > len(AttributePrefix)
+	}
+	for _, f := range Fields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// setField записывает значение ячейки в поле продукта
+func setField(input *models.ProductInput, field, value string) error {
+	var err error
+	switch field {
+	case "name":
+		input.Name = value
+	case "description":
+		input.Description = value
+	case "category":
+		input.Category = value
+	case "sku":
+		input.SKU = value
+	case "barcode":
+		input.Barcode = value
+	case "dimensions":
+		input.Dimensions, err = models.ParseDimensions(value)
+	case "status":
+		input.Status = value
+	case "tags":
+		input.Tags = splitTags(value)
+	case "price":
+		input.Price, err = parseFloat(value)
+	case "discount":
+		input.Discount, err = parseFloat(value)
+	case "weight":
+		input.Weight, err = models.ParseWeight(value)
+	case "stock":
+		input.Stock, err = parseInt(value)
+	case "reorder_point":
+		input.ReorderPoint, err = parseInt(value)
+	case "safety_stock":
+		input.SafetyStock, err = parseInt(value)
+	case "featured":
+		if value != "" {
+			input.Featured, err = strconv.ParseBool(strings.ToLower(value))
+			if err != nil {
+				err = errors.New("ожидается true или false")
+			}
+		}
+	case "attributes":
+		if value != "" {
+			var attributes models.Attributes
+			if err = json.Unmarshal([]byte(value), &attributes); err != nil {
+				return errors.New("ожидается JSON-объект")
+			}
+			for name, v := range attributes {
+				setAttribute(input, name, v)
+			}
+		}
+	default:
+		if name, found := strings.CutPrefix(field, AttributePrefix); found && value != "" {
+			setAttribute(input, name, parseAttribute(value))
+		}
+	}
+	return err
+}
+
+// setAttribute записывает атрибут продукта. Отдельные столбцы атрибутов
+// дополняют JSON-объект из столбца attributes.
+func setAttribute(input *models.ProductInput, name string, value interface{}) {
+	if input.Attributes == nil {
+		input.Attributes = make(models.Attributes)
+	}
+	input.Attributes[name] = value
+}
+
+// parseAttribute разбирает значение атрибута из ячейки: true/false и числа
+// в канонической записи становятся логическими и числовыми значениями,
+// остальное, например артикулы с ведущими нулями, остается строками
+func parseAttribute(value string) interface{} {
+	switch strings.ToLower(value) {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	number := strings.Replace(value, ",", ".", 1)
+	if f, err := strconv.ParseFloat(number, 64); err == nil && strconv.FormatFloat(f, 'f', -1, 64) == number {
+		return f
+	}
+	return value
+}
+
+func parseFloat(value string) (float64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	// Допускаем десятичную запятую, которую подставляют табличные редакторы
+	f, err := strconv.ParseFloat(strings.Replace(value, ",", ".", 1), 64)
+	if err != nil {
+		return 0, errors.New("ожидается число")
+	}
+	return f, nil
+}
+
+func parseInt(value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, errors.New("ожидается целое число")
+	}
+	return i, nil
+}
+
+func splitTags(value string) []string {
+	var tags []string
+	for _, tag := range strings.Split(value, TagSeparator) {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
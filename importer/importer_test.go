@@ -0,0 +1,141 @@
+package importer
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Afra1m/product_api/models"
+)
+
+func TestParseCSVMapping(t *testing.T) {
+	data := "\ufeffНазвание;Цена;Категория;Остаток;Теги;Габариты;Комментарий;SKU\n" +
+		"Чайник;1299,50;kitchen;5;new| sale |;10x20x30 cm;не импортируется;K-1\n"
+	mapping := Mapping{
+		"Название":  "name",
+		"Цена":      "price",
+		"Категория": "category",
+		"Остаток":   "stock",
+		"Теги":      "tags",
+		"Габариты":  "dimensions",
+	}
+
+	rows, err := ParseCSV(strings.NewReader(data), mapping, ';')
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || !rows[0].Valid() {
+		t.Fatalf("разобрано %+v", rows)
+	}
+	want := models.ProductInput{
+		Name:       "Чайник",
+		Price:      1299.5,
+		Category:   "kitchen",
+		Stock:      5,
+		Tags:       []string{"new", "sale"},
+		Dimensions: models.Dimensions{Length: 10, Width: 20, Height: 30, Unit: models.UnitCM},
+		SKU:        "K-1",
+	}
+	if got := rows[0].Input; !reflect.DeepEqual(got, want) {
+		t.Fatalf("строка разобрана как %+v, ожидалось %+v", got, want)
+	}
+	if rows[0].Line != 2 {
+		t.Fatalf("номер строки %d, ожидался 2", rows[0].Line)
+	}
+}
+
+func TestParseCSVUnknownField(t *testing.T) {
+	_, err := ParseCSV(strings.NewReader("a\n1\n"), Mapping{"a": "colour"}, ',')
+	if err == nil {
+		t.Fatal("сопоставление с неизвестным полем принято")
+	}
+}
+
+func TestParseCSVRowErrors(t *testing.T) {
+	data := "name,category,price,stock,featured,dimensions\n" +
+		"A,c,abc,1,,\n" +
+		"B,c,10,1,maybe,10x0x30\n" +
+		",c,10,1,,\n" +
+		"C,c,10,2,true,\n"
+
+	rows, err := ParseCSV(strings.NewReader(data), nil, ',')
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 4 {
+		t.Fatalf("разобрано %d строк, ожидалось 4", len(rows))
+	}
+	wantErrors := []int{1, 2, 1, 0}
+	for i, row := range rows {
+		if len(row.Errors) != wantErrors[i] {
+			t.Errorf("строка %d: ошибки %q, ожидалось %d", row.Line, row.Errors, wantErrors[i])
+		}
+	}
+	if !strings.HasPrefix(rows[0].Errors[0], "price: ") {
+		t.Errorf("ошибка цены без имени поля: %q", rows[0].Errors[0])
+	}
+	if !rows[3].Input.Featured {
+		t.Error("featured=true не разобран")
+	}
+}
+
+func TestParseCSVAttributes(t *testing.T) {
+	data := "name,category,price,stock,attributes,attr.color,attr.Size,ATTR.article,attr.weight_g,attr.wifi,Объем\n" +
+		`A,c,10,1,"{""brand"": ""Acme"", ""warranty"": 2}",red,XL,007,250,TRUE,1.7` + "\n" +
+		"B,c,10,1,,,,,,,\n"
+	mapping := Mapping{"Объем": "attr.volume"}
+
+	rows, err := ParseCSV(strings.NewReader(data), mapping, ',')
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("разобрано %d строк, ожидалось 2", len(rows))
+	}
+	want := models.Attributes{
+		"brand":    "Acme",
+		"warranty": float64(2),
+		"color":    "red",
+		"Size":     "XL",
+		"article":  "007",
+		"weight_g": float64(250),
+		"wifi":     true,
+		"volume":   1.7,
+	}
+	if got := rows[0].Input.Attributes; !reflect.DeepEqual(got, want) {
+		t.Fatalf("атрибуты %v, ожидалось %v", got, want)
+	}
+	if rows[1].Input.Attributes != nil {
+		t.Fatalf("пустые ячейки атрибутов дали %v", rows[1].Input.Attributes)
+	}
+
+	rows, err = ParseCSV(strings.NewReader("name,category,price,stock,attributes\nA,c,10,1,[1]\n"), nil, ',')
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows[0].Errors) != 1 || !strings.HasPrefix(rows[0].Errors[0], "attributes: ") {
+		t.Fatalf("столбец attributes не с объектом: ошибки %q", rows[0].Errors)
+	}
+}
+
+func TestParseAttribute(t *testing.T) {
+	tests := []struct {
+		value string
+		want  interface{}
+	}{
+		{"true", true},
+		{"False", false},
+		{"42", float64(42)},
+		{"1,5", 1.5},
+		{"-0.25", -0.25},
+		{"007", "007"},
+		{"1e3", "1e3"},
+		{"1.50", "1.50"},
+		{"red", "red"},
+	}
+	for _, tt := range tests {
+		if got := parseAttribute(tt.value); got != tt.want {
+			t.Errorf("parseAttribute(%q) = %#v, ожидалось %#v", tt.value, got, tt.want)
+		}
+	}
+}
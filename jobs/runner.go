@@ -0,0 +1,349 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Afra1m/product_api/importer"
+	"github.com/Afra1m/product_api/models"
+	"github.com/Afra1m/product_api/storage"
+	"github.com/Afra1m/product_api/validation"
+	"github.com/google/uuid"
+)
+
+// Runner выполняет фоновые задачи импорта. Файл обрабатывается частями,
+// после каждой части обновляется прогресс задачи и проверяется отмена.
+//
+// Как и синхронный импорт, задача по умолчанию ничего не сохраняет, если
+// хотя бы одна строка файла содержит ошибки или нарушает уникальность SKU
+// или штрихкода: до сохранения первой части весь файл проверяется так же,
+// как его проверит хранилище (см. ProductStorage.CheckUpsertBatch). Если
+// часть все же отклонена из-за параллельной записи в каталог, задача
+// завершается ошибкой, в которой указано, сколько строк уже сохранено, а
+// отклоненные строки попадают в отчет. С skipInvalid строки с ошибками и
+// строки, нарушающие уникальность SKU или штрихкода, пропускаются и
+// попадают в отчет, а остальные сохраняются.
+type Runner struct {
+	jobs      *storage.JobStorage
+	products  *storage.ProductStorage
+	validator *validation.Validator
+	running   map[string]*run
+	mu        sync.Mutex
+
+	// ChunkSize задает число строк, сохраняемых за один шаг
+	ChunkSize int
+}
+
+// run описывает выполняемую задачу: cancel прерывает ее, а done
+// закрывается, когда исполнитель перестает изменять задачу
+type run struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewRunner создает новый исполнитель задач
+func NewRunner(jobs *storage.JobStorage, products *storage.ProductStorage, validator *validation.Validator) *Runner {
+	return &Runner{
+		jobs:      jobs,
+		products:  products,
+		validator: validator,
+		running:   make(map[string]*run),
+		ChunkSize: 500,
+	}
+}
+
+// StartImport создает задачу импорта и запускает ее в фоне
+func (r *Runner) StartImport(source importer.Source, dryRun, skipInvalid bool) (models.Job, error) {
+	job := models.Job{
+		ID:          uuid.New().String(),
+		Type:        models.JobTypeImport,
+		Status:      models.JobQueued,
+		DryRun:      dryRun,
+		SkipInvalid: skipInvalid,
+		CreatedAt:   time.Now(),
+	}
+	if err := r.jobs.Create(job); err != nil {
+		return models.Job{}, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	current := &run{cancel: cancel, done: make(chan struct{})}
+	r.mu.Lock()
+	r.running[job.ID] = current
+	r.mu.Unlock()
+
+	go r.runImport(ctx, job.ID, current, source, dryRun, skipInvalid)
+	return job, nil
+}
+
+// Cancel отменяет незавершенную задачу. Исполнитель дописывает текущую
+// часть файла и сам отмечает задачу отмененной, а Cancel ждет этого, поэтому
+// счетчики возвращенной задачи учитывают все сохраненные строки. Уже
+// сохраненные части импорта не откатываются.
+func (r *Runner) Cancel(id string) (models.Job, error) {
+	job, err := r.jobs.GetByID(id)
+	if err != nil {
+		return models.Job{}, err
+	}
+	if job.Finished() {
+		return job, errors.New("задача уже завершена")
+	}
+
+	r.mu.Lock()
+	current, exists := r.running[id]
+	r.mu.Unlock()
+	if !exists {
+		return r.finish(id, models.JobCancelled, "")
+	}
+
+	current.cancel()
+	<-current.done
+	job, err = r.jobs.GetByID(id)
+	if err != nil {
+		return models.Job{}, err
+	}
+	if job.Status != models.JobCancelled {
+		// Задача завершилась раньше, чем исполнитель заметил отмену
+		return job, errors.New("задача уже завершена")
+	}
+	return job, nil
+}
+
+func (r *Runner) runImport(ctx context.Context, id string, current *run, source importer.Source, dryRun, skipInvalid bool) {
+	defer func() {
+		r.mu.Lock()
+		delete(r.running, id)
+		r.mu.Unlock()
+		current.cancel()
+		close(current.done)
+	}()
+	// cancelled отмечает задачу отмененной, если ее отменили
+	cancelled := func() bool {
+		if ctx.Err() == nil {
+			return false
+		}
+		r.finish(id, models.JobCancelled, "")
+		return true
+	}
+
+	rows, err := source.Parse()
+	if err != nil {
+		r.finish(id, models.JobFailed, err.Error())
+		return
+	}
+	r.validator.ValidateRows(rows)
+	if cancelled() {
+		return
+	}
+
+	if !dryRun && !skipInvalid {
+		if rowErrors := r.check(rows); len(rowErrors) > 0 {
+			r.jobs.AppendErrors(id, rowErrors)
+			if _, err := r.jobs.Update(id, func(job *models.Job) {
+				job.Total = len(rows)
+				job.Failed = len(rowErrors)
+			}); err != nil {
+				return
+			}
+			r.finish(id, models.JobFailed, "файл содержит строки с ошибками, ничего не сохранено")
+			return
+		}
+	}
+
+	started := time.Now()
+	if _, err := r.jobs.Update(id, func(job *models.Job) {
+		job.Status = models.JobRunning
+		job.Total = len(rows)
+		job.StartedAt = &started
+	}); err != nil {
+		return
+	}
+
+	// Повтор SKU в файле обновит продукт, созданный предыдущей строкой,
+	// поэтому при пробном запуске встреченные SKU запоминаются
+	seen := make(map[string]bool)
+
+	for start := 0; start < len(rows); start += r.ChunkSize {
+		if cancelled() {
+			return
+		}
+
+		end := start + r.ChunkSize
+		if end > len(rows) {
+			end = len(rows)
+		}
+
+		created, updated, rowErrors, err := r.importChunk(rows[start:end], dryRun, skipInvalid, seen)
+		if rejected(err) {
+			// Часть отклонена из-за записей, сделанных после проверки файла
+			r.jobs.AppendErrors(id, r.check(rows[start:end]))
+			r.finish(id, models.JobFailed, fmt.Sprintf("%v; сохранено строк: %d из %d", err, start, len(rows)))
+			return
+		}
+		if err != nil {
+			r.finish(id, models.JobFailed, err.Error())
+			return
+		}
+
+		r.jobs.AppendErrors(id, rowErrors)
+		if _, err := r.jobs.Update(id, func(job *models.Job) {
+			job.Processed += end - start
+			job.Failed += len(rowErrors)
+			job.Succeeded += created + updated
+			job.Created += created
+			job.Updated += updated
+			job.Progress = float64(job.Processed) / float64(job.Total)
+		}); err != nil {
+			return
+		}
+	}
+
+	r.finish(id, models.JobSucceeded, "")
+}
+
+// check возвращает ошибки строк, из-за которых импорт без skipInvalid не
+// сохранит строки: ошибки разбора и проверки строк, а также нарушения
+// уникальности SKU и штрихкода и отказы проверки хранилища, найденные
+// проверкой всех корректных строк одним пакетом
+func (r *Runner) check(rows []importer.Row) []models.ImportRowError {
+	var rowErrors []models.ImportRowError
+	valid := make([]importer.Row, 0, len(rows))
+	for _, row := range rows {
+		if !row.Valid() {
+			rowErrors = append(rowErrors, rowError(row, row.Errors))
+			continue
+		}
+		valid = append(valid, row)
+	}
+
+	rejected := r.products.CheckUpsertBatch(newProducts(valid, time.Now()))
+	for i, row := range valid {
+		if err, exists := rejected[i]; exists {
+			rowErrors = append(rowErrors, rowError(row, []string{err.Error()}))
+		}
+	}
+	sort.Slice(rowErrors, func(i, j int) bool {
+		return rowErrors[i].Row < rowErrors[j].Row
+	})
+	return rowErrors
+}
+
+// importChunk сохраняет корректные строки части файла одним пакетом (см.
+// Save); строки с ошибками пропускаются и попадают в отчет
+func (r *Runner) importChunk(rows []importer.Row, dryRun, skipInvalid bool, seen map[string]bool) (int, int, []models.ImportRowError, error) {
+	var rowErrors []models.ImportRowError
+	now := time.Now()
+	valid := make([]importer.Row, 0, len(rows))
+	for _, row := range rows {
+		if !row.Valid() {
+			rowErrors = append(rowErrors, rowError(row, row.Errors))
+			continue
+		}
+		valid = append(valid, row)
+	}
+
+	created, updated := 0, 0
+	if dryRun {
+		skus := make([]string, 0, len(valid))
+		for _, row := range valid {
+			skus = append(skus, row.Input.SKU)
+		}
+		existing := r.products.ExistingSKUs(skus)
+		for _, row := range valid {
+			sku := row.Input.SKU
+			if sku != "" && (existing[sku] || seen[sku]) {
+				updated++
+			} else {
+				created++
+				if sku != "" {
+					seen[sku] = true
+				}
+			}
+		}
+		return created, updated, rowErrors, nil
+	}
+
+	result, err := r.Save(valid, now, skipInvalid)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	return result.Created, result.Updated, append(rowErrors, result.Errors...), nil
+}
+
+// Save сохраняет корректные строки импорта одним пакетом UpsertBatch: пакет
+// сохраняется целиком или не сохраняется вовсе. Если пакет отклонен из-за
+// нарушения уникальности ключа или проверки продукта и skipInvalid истинно,
+// строки сохраняются по одной, а отклоненные строки попадают в Errors.
+func (r *Runner) Save(rows []importer.Row, now time.Time, skipInvalid bool) (models.ImportResult, error) {
+	result := models.ImportResult{Total: len(rows), Errors: []models.ImportRowError{}}
+	products := newProducts(rows, now)
+
+	saved, err := r.products.UpsertBatch(products)
+	if skipInvalid && rejected(err) {
+		saved, err = nil, nil
+		for i, row := range rows {
+			upsert, err := r.products.Upsert(products[i])
+			if rejected(err) {
+				result.Errors = append(result.Errors, rowError(row, []string{err.Error()}))
+				continue
+			}
+			if err != nil {
+				return models.ImportResult{}, err
+			}
+			saved = append(saved, upsert)
+		}
+	}
+	if err != nil {
+		return models.ImportResult{}, err
+	}
+
+	for _, upsert := range saved {
+		if upsert.Created {
+			result.Created++
+		} else {
+			result.Updated++
+		}
+		result.Products = append(result.Products, upsert.Product)
+	}
+	result.Failed = len(result.Errors)
+	return result, nil
+}
+
+// rejected сообщает, что продукт отклонен из-за своих данных, а не из-за
+// сбоя хранилища
+func rejected(err error) bool {
+	return storage.IsConflict(err) || storage.IsInvalid(err)
+}
+
+// newProducts создает продукты из строк импорта
+func newProducts(rows []importer.Row, now time.Time) []models.Product {
+	products := make([]models.Product, len(rows))
+	for i, row := range rows {
+		products[i] = models.NewProduct(row.Input, now)
+	}
+	return products
+}
+
+func rowError(row importer.Row, errs []string) models.ImportRowError {
+	return models.ImportRowError{
+		Row:    row.Line,
+		SKU:    row.Input.SKU,
+		Errors: errs,
+	}
+}
+
+func (r *Runner) finish(id, status, message string) (models.Job, error) {
+	finished := time.Now()
+	return r.jobs.Update(id, func(job *models.Job) {
+		job.Status = status
+		job.Error = message
+		job.FinishedAt = &finished
+		if status == models.JobSucceeded {
+			job.Progress = 1
+		}
+	})
+}
@@ -1,26 +1,130 @@
 package main
 
 import (
+	"context"
 	"log"
+	"os"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
+	"github.com/Afra1m/product_api/events"
 	"github.com/Afra1m/product_api/handlers"
+	"github.com/Afra1m/product_api/jobs"
+	"github.com/Afra1m/product_api/outbox"
+	"github.com/Afra1m/product_api/recommend"
 	"github.com/Afra1m/product_api/storage"
+	"github.com/Afra1m/product_api/validation"
+	"github.com/Afra1m/product_api/webhooks"
 )
 
 func main() {
 	// Инициализация хранилища
 	productStorage := storage.NewProductStorage()
+	if path := os.Getenv("CHANGELOG_FILE"); path != "" {
+		changeLog, err := storage.OpenFileChangeLog(path)
+		if err != nil {
+			log.Fatal("Не удалось открыть ленту изменений:", err)
+		}
+		defer changeLog.Close()
+
+		// Журнал outbox по умолчанию хранится рядом с лентой изменений
+		journalPath := os.Getenv("OUTBOX_JOURNAL_FILE")
+		if journalPath == "" {
+			journalPath = path + ".outbox"
+		}
+		journal, err := storage.OpenOutboxJournal(journalPath)
+		if err != nil {
+			log.Fatal("Не удалось открыть журнал outbox:", err)
+		}
+		defer journal.Close()
+		productStorage = storage.NewProductStorageWithLogs(changeLog, journal)
+	}
+	go productStorage.RunCounterFlush(context.Background(), storage.DefaultCounterFlushInterval)
+	webhookStorage := storage.NewWebhookStorage()
+	jobStorage := storage.NewJobStorage()
+	categoryStorage := storage.NewCategoryStorage()
+	// Дерево категорий по умолчанию хранится рядом с лентой изменений, иначе
+	// после перезапуска продукты остались бы без своих категорий
+	categoriesPath := os.Getenv("CATEGORIES_FILE")
+	if path := os.Getenv("CHANGELOG_FILE"); categoriesPath == "" && path != "" {
+		categoriesPath = path + ".categories"
+	}
+	if categoriesPath != "" {
+		var err error
+		categoryStorage, err = storage.OpenCategoryStorage(categoriesPath)
+		if err != nil {
+			log.Fatal("Не удалось открыть дерево категорий:", err)
+		}
+	}
+
+	// Правила проверки продуктов
+	validator := validation.NewValidator()
+	validator.SetSchemas(categoryStorage)
+	if path := os.Getenv("VALIDATION_CONFIG"); path != "" {
+		if err := validator.LoadConfig(path); err != nil {
+			log.Fatal("Не удалось загрузить правила проверки:", err)
+		}
+	}
+	productStorage.SetValidator(validator)
+
+	// Фоновые задачи импорта
+	jobRunner := jobs.NewRunner(jobStorage, productStorage, validator)
+
+	// Доставка событий продуктов на вебхуки
+	dispatcher := webhooks.NewDispatcher(webhookStorage)
+
+	// Поток событий для клиентов Server-Sent Events
+	broker := events.NewBroker(events.DefaultReplaySize)
+	broker.Resume(productStorage.OutboxPublishedSeq())
+
+	// Публикация событий из outbox
+	sinks := []outbox.Sink{
+		outbox.NewWebhookSink(dispatcher),
+		outbox.NewBusSink(broker),
+	}
+	if path := os.Getenv("OUTBOX_FILE"); path != "" {
+		fileSink, err := outbox.NewFileSink(path)
+		if err != nil {
+			log.Fatal("Не удалось открыть файл outbox:", err)
+		}
+		defer fileSink.Close()
+		sinks = append(sinks, fileSink)
+	}
+	if os.Getenv("OUTBOX_STDOUT") == "true" {
+		sinks = append(sinks, outbox.NewStdoutSink())
+	}
+	relay := outbox.NewRelay(productStorage, sinks...)
+	go relay.Run(context.Background())
+
+	// Рекомендации
+	halfLife := recommend.DefaultHalfLife
+	if value := os.Getenv("TRENDING_HALF_LIFE"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			log.Fatal("Неверный период полураспада трендов:", value)
+		}
+		halfLife = parsed
+	}
+	recommender := recommend.NewRecommender(productStorage, halfLife)
 
 	// Инициализация обработчиков
-	productHandler := handlers.NewProductHandler(productStorage)
+	productHandler := handlers.NewProductHandler(productStorage, jobRunner, validator, recommender, categoryStorage)
+	inventoryHandler := handlers.NewInventoryHandler(productStorage)
+	webhookHandler := handlers.NewWebhookHandler(webhookStorage, dispatcher)
+	eventHandler := handlers.NewEventHandler(broker)
+	outboxHandler := handlers.NewOutboxHandler(productStorage)
+	jobHandler := handlers.NewJobHandler(jobStorage, jobRunner)
+	validationHandler := handlers.NewValidationHandler(validator)
+	activityHandler := handlers.NewActivityHandler(recommender)
+	categoryHandler := handlers.NewCategoryHandler(categoryStorage, productStorage)
 
 	// Создание маршрутизатора
 	router := gin.Default()
 
 	// Группа API
 	api := router.Group("/api")
+	api.Use(handlers.CatalogVersion(productStorage))
 	{
 		// Продукты
 		products := api.Group("/products")
@@ -32,6 +136,11 @@ func main() {
 			products.PUT("/:id", productHandler.UpdateProduct)
 			products.DELETE("/:id", productHandler.DeleteProduct)
 
+			// Естественные ключи
+			products.GET("/by-sku/:sku", productHandler.GetProductBySKU)
+			products.PUT("/by-sku/:sku", productHandler.UpsertProductBySKU)
+			products.GET("/by-barcode/:code", productHandler.GetProductByBarcode)
+
 			// Фильтрация и поиск
 			products.GET("/category/:category", productHandler.GetProductsByCategory)
 			products.GET("/search", productHandler.SearchProducts)
@@ -65,12 +174,94 @@ func main() {
 			// Импорт/экспорт
 			products.GET("/export", productHandler.ExportProducts)
 			products.POST("/import", productHandler.ImportProducts)
+			products.GET("/changes", productHandler.GetProductChanges)
 
 			// Валидация и проверка
+			products.GET("/validate", productHandler.ValidateCatalog)
 			products.GET("/validate/:id", productHandler.ValidateProduct)
 			products.GET("/duplicates", productHandler.GetDuplicateProducts)
+			products.POST("/merge", productHandler.MergeProducts)
 			products.GET("/out-of-stock", productHandler.GetOutOfStockProducts)
 			products.GET("/low-stock", productHandler.GetLowStockProducts)
+
+			// Варианты продуктов
+			products.PUT("/:id/variant-axes", productHandler.SetVariantAxes)
+			products.GET("/:id/variants", productHandler.GetProductVariants)
+			products.POST("/:id/variants", productHandler.CreateProductVariant)
+			products.PUT("/:id/variants/:variantId", productHandler.UpdateProductVariant)
+
+			// Наборы
+			products.GET("/:id/bundle", productHandler.GetProductBundle)
+			products.PUT("/:id/bundle", productHandler.SetProductBundle)
+			products.POST("/:id/stock/adjust", productHandler.AdjustProductStock)
+
+			// Поток событий
+			products.GET("/events", eventHandler.StreamProductEvents)
+		}
+
+		// Управление запасами
+		inventory := api.Group("/inventory")
+		{
+			inventory.GET("/policies", inventoryHandler.GetPolicies)
+			inventory.PUT("/policies/:category", inventoryHandler.SetPolicy)
+			inventory.DELETE("/policies/:category", inventoryHandler.DeletePolicy)
+			inventory.GET("/reorder-report", inventoryHandler.GetReorderReport)
+		}
+
+		// Дерево категорий
+		categories := api.Group("/categories")
+		{
+			categories.GET("", categoryHandler.GetAllCategories)
+			categories.POST("", categoryHandler.CreateCategory)
+			categories.GET("/:id", categoryHandler.GetCategory)
+			categories.PUT("/:id", categoryHandler.UpdateCategory)
+			categories.DELETE("/:id", categoryHandler.DeleteCategory)
+			categories.GET("/:id/breadcrumbs", categoryHandler.GetCategoryBreadcrumbs)
+			categories.POST("/:id/move", categoryHandler.MoveCategory)
+			categories.POST("/:id/merge", categoryHandler.MergeCategory)
+		}
+
+		// Вебхуки
+		hooks := api.Group("/webhooks")
+		{
+			hooks.GET("", webhookHandler.GetAllWebhooks)
+			hooks.POST("", webhookHandler.CreateWebhook)
+			hooks.GET("/:id", webhookHandler.GetWebhookByID)
+			hooks.PUT("/:id", webhookHandler.UpdateWebhook)
+			hooks.DELETE("/:id", webhookHandler.DeleteWebhook)
+			hooks.GET("/:id/deliveries", webhookHandler.GetDeliveries)
+			hooks.GET("/:id/deliveries/:delivery_id", webhookHandler.GetDelivery)
+			hooks.POST("/:id/deliveries/:delivery_id/redeliver", webhookHandler.RedeliverDelivery)
+		}
+
+		// Администрирование
+		admin := api.Group("/admin")
+		{
+			admin.GET("/outbox", outboxHandler.GetOutboxEntries)
+			admin.GET("/outbox/stats", outboxHandler.GetOutboxStats)
+			admin.GET("/outbox/:id", outboxHandler.GetOutboxEntry)
+			admin.POST("/outbox/:id/retry", outboxHandler.RetryOutboxEntry)
+		}
+
+		// События поведения покупателей
+		api.POST("/events", activityHandler.RecordEvents)
+
+		// Фоновые задачи
+		jobGroup := api.Group("/jobs")
+		{
+			jobGroup.GET("", jobHandler.GetAllJobs)
+			jobGroup.GET("/:id", jobHandler.GetJobByID)
+			jobGroup.GET("/:id/errors", jobHandler.GetJobErrors)
+			jobGroup.POST("/:id/cancel", jobHandler.CancelJob)
+		}
+
+		// Настройка проверки продуктов
+		validationGroup := api.Group("/validation")
+		{
+			validationGroup.GET("/rules", validationHandler.GetRules)
+			validationGroup.GET("/sku-patterns", validationHandler.GetSKUPatterns)
+			validationGroup.PUT("/sku-patterns/:category", validationHandler.SetSKUPattern)
+			validationGroup.DELETE("/sku-patterns/:category", validationHandler.DeleteSKUPattern)
 		}
 	}
 
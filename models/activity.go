@@ -0,0 +1,52 @@
+package models
+
+import (
+	"time"
+)
+
+// Типы событий поведения покупателей
+const (
+	ActivityView      = "view"
+	ActivityAddToCart = "add_to_cart"
+	ActivityPurchase  = "purchase"
+)
+
+// ActivityEvent представляет действие покупателя с продуктом в рамках сессии
+type ActivityEvent struct {
+	Type      string    `json:"type" binding:"required,oneof=view add_to_cart purchase"`
+	ProductID string    `json:"product_id" binding:"required"`
+	SessionID string    `json:"session_id" binding:"required"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// ActivityResult представляет результат приема событий
+type ActivityResult struct {
+	Accepted int                  `json:"accepted"`
+	Rejected int                  `json:"rejected"`
+	Errors   []ActivityEventError `json:"errors,omitempty"`
+}
+
+// ActivityEventError описывает отклоненное событие
+type ActivityEventError struct {
+	Index int    `json:"index"`
+	Error string `json:"error"`
+}
+
+// RelatedScores содержит составляющие оценки связанности продуктов, каждая от 0 до 1
+type RelatedScores struct {
+	CoOccurrence float64 `json:"co_occurrence"`
+	Tags         float64 `json:"tags"`
+}
+
+// RelatedProduct представляет связанный продукт с итоговой оценкой и ее составляющими
+type RelatedProduct struct {
+	Product Product       `json:"product"`
+	Score   float64       `json:"score"`
+	Scores  RelatedScores `json:"scores"`
+}
+
+// TrendingProduct представляет продукт с оценкой популярности, затухающей со временем
+type TrendingProduct struct {
+	Product Product `json:"product"`
+	Score   float64 `json:"score"`
+}
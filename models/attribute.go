@@ -0,0 +1,133 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// Типы атрибутов продукта
+const (
+	AttributeString  = "string"
+	AttributeNumber  = "number"
+	AttributeInteger = "integer"
+	AttributeBoolean = "boolean"
+	AttributeEnum    = "enum"
+)
+
+// Attributes содержит значения атрибутов продукта по именам. Значения
+// строковые, числовые или логические, как их декодирует encoding/json.
+type Attributes map[string]interface{}
+
+// Clone возвращает глубокую копию атрибутов
+func (a Attributes) Clone() Attributes {
+	if a == nil {
+		return nil
+	}
+	clone := make(Attributes, len(a))
+	for name, value := range a {
+		clone[name] = cloneValue(value)
+	}
+	return clone
+}
+
+// AttributeDefinition описывает атрибут продуктов категории. Для enum
+// AllowedValues обязателен; для остальных типов он необязательно сужает
+// допустимые значения.
+type AttributeDefinition struct {
+	Name          string   `json:"name" binding:"required"`
+	Type          string   `json:"type" binding:"required,oneof=string number integer boolean enum"`
+	Unit          string   `json:"unit,omitempty"`
+	AllowedValues []string `json:"allowed_values,omitempty"`
+	Required      bool     `json:"required"`
+}
+
+// Check проверяет, что значение соответствует типу и допустимым значениям атрибута
+func (d AttributeDefinition) Check(value interface{}) error {
+	switch d.Type {
+	case AttributeString, AttributeEnum:
+		if _, ok := value.(string); !ok {
+			return errors.New("ожидается строка")
+		}
+	case AttributeNumber:
+		if _, ok := AttributeNumberValue(value); !ok {
+			return errors.New("ожидается число")
+		}
+	case AttributeInteger:
+		number, ok := AttributeNumberValue(value)
+		if !ok || number != math.Trunc(number) {
+			return errors.New("ожидается целое число")
+		}
+	case AttributeBoolean:
+		if _, ok := value.(bool); !ok {
+			return errors.New("ожидается true или false")
+		}
+	}
+
+	if len(d.AllowedValues) > 0 {
+		formatted := FormatAttribute(value)
+		for _, allowed := range d.AllowedValues {
+			if allowed == formatted {
+				return nil
+			}
+		}
+		return fmt.Errorf("значение %q не входит в список допустимых", formatted)
+	}
+	return nil
+}
+
+// ValidateDefinitions проверяет схему атрибутов: имена уникальны, а у enum
+// есть список допустимых значений
+func ValidateDefinitions(definitions []AttributeDefinition) error {
+	seen := make(map[string]bool, len(definitions))
+	for _, definition := range definitions {
+		if definition.Name == "" {
+			return errors.New("у атрибута должно быть имя")
+		}
+		if seen[definition.Name] {
+			return fmt.Errorf("атрибут %q описан повторно", definition.Name)
+		}
+		seen[definition.Name] = true
+
+		switch definition.Type {
+		case AttributeString, AttributeNumber, AttributeInteger, AttributeBoolean:
+		case AttributeEnum:
+			if len(definition.AllowedValues) == 0 {
+				return fmt.Errorf("атрибуту %q типа enum нужен список allowed_values", definition.Name)
+			}
+		default:
+			return fmt.Errorf("неизвестный тип атрибута %q", definition.Type)
+		}
+	}
+	return nil
+}
+
+// AttributeNumberValue возвращает числовое значение атрибута
+func AttributeNumberValue(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	default:
+		return 0, false
+	}
+}
+
+// FormatAttribute возвращает строковое представление значения атрибута,
+// с которым сравниваются допустимые значения и условия фильтра
+func FormatAttribute(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case int:
+		return strconv.Itoa(v)
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
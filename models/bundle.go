@@ -0,0 +1,92 @@
+package models
+
+import (
+	"errors"
+	"math"
+)
+
+// Способы расчета цены набора
+const (
+	BundlePricingFixed   = "fixed"
+	BundlePricingDerived = "derived"
+)
+
+// BundleComponent задает продукт, входящий в набор, и его количество
+type BundleComponent struct {
+	ProductID string `json:"product_id" binding:"required"`
+	Quantity  int    `json:"quantity" binding:"required,gte=1"`
+}
+
+// Bundle описывает состав набора. При цене derived цена набора равна
+// сумме цен компонентов с учетом количества за вычетом скидки Discount
+// в процентах, при fixed — цене самого продукта.
+type Bundle struct {
+	Components []BundleComponent `json:"components"`
+	Pricing    string            `json:"pricing"`
+	Discount   float64           `json:"discount"`
+}
+
+// BundleInput представляет структуру для задания состава набора
+type BundleInput struct {
+	Components []BundleComponent `json:"components" binding:"required,min=1,dive"`
+	Pricing    string            `json:"pricing" binding:"required,oneof=fixed derived"`
+	Discount   float64           `json:"discount" binding:"gte=0,lte=100"`
+}
+
+// BundleComponentAvailability описывает компонент набора и число наборов,
+// которое можно собрать из его остатка
+type BundleComponentAvailability struct {
+	Product   Product `json:"product"`
+	Quantity  int     `json:"quantity"`
+	Available int     `json:"available"`
+}
+
+// BundleDetails представляет набор вместе с компонентами
+type BundleDetails struct {
+	Bundle          Product                       `json:"bundle"`
+	Components      []BundleComponentAvailability `json:"components"`
+	Available       int                           `json:"available"`
+	ComponentsPrice float64                       `json:"components_price"`
+}
+
+// StockAdjustmentInput задает изменение остатка: отрицательное значение
+// списывает товар, положительное возвращает его на склад
+type StockAdjustmentInput struct {
+	Delta int `json:"delta" binding:"required"`
+}
+
+// IsBundle сообщает, что продукт является набором
+func (p Product) IsBundle() bool {
+	return p.Bundle != nil
+}
+
+// NewBundle создает состав набора из входных данных
+func NewBundle(input BundleInput) (*Bundle, error) {
+	seen := make(map[string]bool, len(input.Components))
+	for _, component := range input.Components {
+		if seen[component.ProductID] {
+			return nil, errors.New("компонент " + component.ProductID + " указан повторно")
+		}
+		seen[component.ProductID] = true
+	}
+	return &Bundle{
+		Components: input.Components,
+		Pricing:    input.Pricing,
+		Discount:   input.Discount,
+	}, nil
+}
+
+// Price возвращает цену набора по цене компонентов, округленную до копеек
+func (b Bundle) Price(componentsPrice float64) float64 {
+	return math.Round(componentsPrice*(100-b.Discount)) / 100
+}
+
+// Clone возвращает копию состава набора
+func (b *Bundle) Clone() *Bundle {
+	if b == nil {
+		return nil
+	}
+	clone := *b
+	clone.Components = append([]BundleComponent(nil), b.Components...)
+	return &clone
+}
@@ -0,0 +1,67 @@
+package models
+
+import (
+	"time"
+)
+
+// Category представляет категорию каталога. Продукты ссылаются на категорию
+// по ее slug в поле Product.Category. Категории без родителя являются
+// корневыми; Position задает порядок среди соседей. Attributes описывает
+// атрибуты продуктов категории; потомки наследуют схему предков.
+type Category struct {
+	ID         string                `json:"id"`
+	Slug       string                `json:"slug"`
+	Name       string                `json:"name"`
+	ParentID   string                `json:"parent_id,omitempty"`
+	Position   int                   `json:"position"`
+	Attributes []AttributeDefinition `json:"attributes,omitempty"`
+	CreatedAt  time.Time             `json:"created_at"`
+	UpdatedAt  time.Time             `json:"updated_at"`
+}
+
+// CategoryInput представляет структуру для создания/обновления категории
+type CategoryInput struct {
+	Slug       string                `json:"slug" binding:"required"`
+	Name       string                `json:"name" binding:"required"`
+	ParentID   string                `json:"parent_id"`
+	Position   int                   `json:"position"`
+	Attributes []AttributeDefinition `json:"attributes" binding:"dive"`
+}
+
+// CategoryNode представляет категорию с дочерними категориями в дереве
+type CategoryNode struct {
+	Category
+	Children []CategoryNode `json:"children"`
+}
+
+// CategoryMoveInput задает нового родителя и позицию категории. Пустой
+// parent_id делает категорию корневой.
+type CategoryMoveInput struct {
+	ParentID string `json:"parent_id"`
+	Position *int   `json:"position"`
+}
+
+// CategoryMergeInput задает категорию, в которую сливается исходная
+type CategoryMergeInput struct {
+	TargetID string `json:"target_id" binding:"required"`
+}
+
+// CategoryMergeResult описывает результат слияния категорий
+type CategoryMergeResult struct {
+	Target        Category `json:"target"`
+	MovedProducts int      `json:"moved_products"`
+	MovedChildren int      `json:"moved_children"`
+}
+
+// Breadcrumb представляет звено пути от корня дерева до категории
+type Breadcrumb struct {
+	ID   string `json:"id"`
+	Slug string `json:"slug"`
+	Name string `json:"name"`
+}
+
+// ProductWithBreadcrumbs представляет продукт вместе с путем к его категории
+type ProductWithBreadcrumbs struct {
+	Product
+	Breadcrumbs []Breadcrumb `json:"breadcrumbs"`
+}
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+)
+
+// Типы записей ленты изменений
+const (
+	ChangeUpsert = "upsert"
+	ChangeDelete = "delete"
+)
+
+// ProductChange представляет запись ленты изменений продуктов. Для удаления
+// Product равен nil (tombstone). Product хранится без истории: History
+// содержит только записи истории, добавленные этим изменением, а при
+// HistoryReset — всю историю продукта. Изменения, сделанные одной операцией,
+// записываются группой подряд идущих записей; Continued отмечает все записи
+// группы, кроме последней.
+type ProductChange struct {
+	Seq          uint64           `json:"seq"`
+	Type         string           `json:"type"`
+	ProductID    string           `json:"product_id"`
+	Product      *Product         `json:"product"`
+	History      []ProductHistory `json:"history,omitempty"`
+	HistoryReset bool             `json:"history_reset,omitempty"`
+	Timestamp    time.Time        `json:"timestamp"`
+	Continued    bool             `json:"continued,omitempty"`
+}
+
+// ChangeFeed представляет страницу ленты изменений
+type ChangeFeed struct {
+	Changes   []ProductChange `json:"changes"`
+	NextSince uint64          `json:"next_since"`
+	HasMore   bool            `json:"has_more"`
+}
@@ -0,0 +1,34 @@
+package models
+
+// Причины, по которым продукты считаются дубликатами
+const (
+	DuplicateSKU         = "sku"
+	DuplicateBarcode     = "barcode"
+	DuplicateName        = "name"
+	DuplicateSimilarName = "similar_name"
+)
+
+// DuplicateMatch описывает пару вероятных дубликатов. Score от 0 до 1
+// оценивает уверенность в том, что это один и тот же товар.
+type DuplicateMatch struct {
+	ProductID string   `json:"product_id"`
+	OtherID   string   `json:"other_id"`
+	Score     float64  `json:"score"`
+	Reasons   []string `json:"reasons"`
+}
+
+// DuplicateCluster представляет группу продуктов, связанных совпадениями.
+// ID кластера совпадает с наименьшим ID его продуктов.
+type DuplicateCluster struct {
+	ID       string           `json:"id"`
+	Score    float64          `json:"score"`
+	Reasons  []string         `json:"reasons"`
+	Products []Product        `json:"products"`
+	Matches  []DuplicateMatch `json:"matches"`
+}
+
+// MergeInput представляет структуру для слияния дубликатов в один продукт
+type MergeInput struct {
+	TargetID  string   `json:"target_id" binding:"required"`
+	SourceIDs []string `json:"source_ids" binding:"required,min=1"`
+}
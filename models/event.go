@@ -0,0 +1,45 @@
+package models
+
+import (
+	"time"
+)
+
+// Типы событий продуктов
+const (
+	EventProductCreated = "product.created"
+	EventProductUpdated = "product.updated"
+	EventProductDeleted = "product.deleted"
+	EventStockChanged   = "stock.changed"
+	EventPriceChanged   = "price.changed"
+	EventStockLow       = "stock.low"
+)
+
+// EventTypes содержит все поддерживаемые типы событий
+var EventTypes = []string{
+	EventProductCreated,
+	EventProductUpdated,
+	EventProductDeleted,
+	EventStockChanged,
+	EventPriceChanged,
+	EventStockLow,
+}
+
+// IsEventType сообщает, является ли строка известным типом события
+func IsEventType(eventType string) bool {
+	for _, t := range EventTypes {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// ProductEvent представляет событие изменения продукта
+type ProductEvent struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	ProductID string    `json:"product_id"`
+	Product   *Product  `json:"product,omitempty"`
+	Previous  *Product  `json:"previous,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
@@ -0,0 +1,120 @@
+package models
+
+import (
+	"strings"
+)
+
+// ProductFilter представляет условия отбора продуктов для списков и экспорта.
+// Незаданные условия не ограничивают выборку.
+type ProductFilter struct {
+	Category string
+	Tag      string
+	Status   string
+	Query    string
+	MinPrice *float64
+	MaxPrice *float64
+	InStock  *bool
+	Featured *bool
+	// Границы веса и объемного веса задаются в килограммах
+	MinWeight           *float64
+	MaxWeight           *float64
+	MinVolumetricWeight *float64
+	MaxVolumetricWeight *float64
+	// Условия на атрибуты должны выполняться все одновременно
+	Attributes []AttributeCondition
+}
+
+// AttributeCondition задает условие на атрибут продукта: значение атрибута
+// совпадает с одним из Values и, для числовых атрибутов, лежит в границах
+// Min и Max. Продукт без атрибута условию не удовлетворяет.
+type AttributeCondition struct {
+	Name   string
+	Values []string
+	Min    *float64
+	Max    *float64
+}
+
+// Matches сообщает, удовлетворяют ли атрибуты условию
+func (c AttributeCondition) Matches(attributes Attributes) bool {
+	value, exists := attributes[c.Name]
+	if !exists || value == nil {
+		return false
+	}
+	if len(c.Values) > 0 {
+		formatted := FormatAttribute(value)
+		matched := false
+		for _, v := range c.Values {
+			if v == formatted {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	if c.Min != nil || c.Max != nil {
+		number, ok := AttributeNumberValue(value)
+		if !ok || !inRange(number, c.Min, c.Max) {
+			return false
+		}
+	}
+	return true
+}
+
+// Matches сообщает, удовлетворяет ли продукт условиям фильтра
+func (f ProductFilter) Matches(product Product) bool {
+	if f.Category != "" && product.Category != f.Category {
+		return false
+	}
+	if f.Status != "" && product.Status != f.Status {
+		return false
+	}
+	if f.Tag != "" && !hasTag(product.Tags, f.Tag) {
+		return false
+	}
+	if f.Query != "" {
+		query := strings.ToLower(f.Query)
+		if !strings.Contains(strings.ToLower(product.Name), query) &&
+			!strings.Contains(strings.ToLower(product.Description), query) {
+			return false
+		}
+	}
+	if f.MinPrice != nil && product.Price < *f.MinPrice {
+		return false
+	}
+	if f.MaxPrice != nil && product.Price > *f.MaxPrice {
+		return false
+	}
+	if f.InStock != nil && (product.Stock > 0) != *f.InStock {
+		return false
+	}
+	if f.Featured != nil && product.Featured != *f.Featured {
+		return false
+	}
+	if !inRange(product.Weight.Kilograms(), f.MinWeight, f.MaxWeight) {
+		return false
+	}
+	if !inRange(product.VolumetricWeight.Kilograms(), f.MinVolumetricWeight, f.MaxVolumetricWeight) {
+		return false
+	}
+	for _, condition := range f.Attributes {
+		if !condition.Matches(product.Attributes) {
+			return false
+		}
+	}
+	return true
+}
+
+func inRange(value float64, min, max *float64) bool {
+	return (min == nil || value >= *min) && (max == nil || value <= *max)
+}
+
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,26 @@
+package models
+
+// UpsertResult представляет результат сохранения продукта по SKU
+type UpsertResult struct {
+	Product Product
+	Created bool
+}
+
+// ImportRowError представляет ошибки одной строки импорта
+type ImportRowError struct {
+	Row    int      `json:"row"`
+	SKU    string   `json:"sku,omitempty"`
+	Errors []string `json:"errors"`
+}
+
+// ImportResult представляет результат импорта. В режиме проверки (dry run)
+// Created и Updated показывают, сколько продуктов было бы создано и обновлено.
+type ImportResult struct {
+	DryRun   bool             `json:"dry_run"`
+	Total    int              `json:"total"`
+	Created  int              `json:"created"`
+	Updated  int              `json:"updated"`
+	Failed   int              `json:"failed"`
+	Errors   []ImportRowError `json:"errors"`
+	Products []Product        `json:"products,omitempty"`
+}
@@ -0,0 +1,40 @@
+package models
+
+import (
+	"time"
+)
+
+// InventoryPolicy представляет точку перезаказа и страховой запас категории
+type InventoryPolicy struct {
+	Category     string `json:"category"`
+	ReorderPoint int    `json:"reorder_point"`
+	SafetyStock  int    `json:"safety_stock"`
+}
+
+// InventoryPolicyInput представляет структуру для установки политики категории
+type InventoryPolicyInput struct {
+	ReorderPoint int `json:"reorder_point" binding:"gte=0"`
+	SafetyStock  int `json:"safety_stock" binding:"gte=0"`
+}
+
+// ReorderReportItem представляет позицию отчета о перезаказе
+type ReorderReportItem struct {
+	ProductID         string   `json:"product_id"`
+	Name              string   `json:"name"`
+	SKU               string   `json:"sku"`
+	Category          string   `json:"category"`
+	Stock             int      `json:"stock"`
+	ReorderPoint      int      `json:"reorder_point"`
+	SafetyStock       int      `json:"safety_stock"`
+	DailyVelocity     float64  `json:"daily_velocity"`
+	DaysOfCover       *float64 `json:"days_of_cover,omitempty"`
+	SuggestedQuantity int      `json:"suggested_quantity"`
+}
+
+// ReorderReport представляет отчет о товарах, которые нужно перезаказать
+type ReorderReport struct {
+	GeneratedAt time.Time           `json:"generated_at"`
+	WindowDays  int                 `json:"window_days"`
+	CoverDays   int                 `json:"cover_days"`
+	Items       []ReorderReportItem `json:"items"`
+}
@@ -0,0 +1,43 @@
+package models
+
+import (
+	"time"
+)
+
+// Статусы фоновой задачи
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+	JobCancelled = "cancelled"
+)
+
+// JobTypeImport обозначает задачу импорта продуктов
+const JobTypeImport = "import"
+
+// Job представляет фоновую задачу и ход ее выполнения. Ошибки отдельных
+// строк хранятся отдельно и доступны в отчете об ошибках задачи.
+type Job struct {
+	ID          string     `json:"id"`
+	Type        string     `json:"type"`
+	Status      string     `json:"status"`
+	DryRun      bool       `json:"dry_run"`
+	SkipInvalid bool       `json:"skip_invalid"`
+	Total       int        `json:"total"`
+	Processed   int        `json:"processed"`
+	Succeeded   int        `json:"succeeded"`
+	Failed      int        `json:"failed"`
+	Created     int        `json:"created"`
+	Updated     int        `json:"updated"`
+	Progress    float64    `json:"progress"`
+	Error       string     `json:"error,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	StartedAt   *time.Time `json:"started_at,omitempty"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty"`
+}
+
+// Finished сообщает, что задача завершена и больше не изменится
+func (j Job) Finished() bool {
+	return j.Status == JobSucceeded || j.Status == JobFailed || j.Status == JobCancelled
+}
@@ -0,0 +1,376 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Единицы длины
+const (
+	UnitMM   = "mm"
+	UnitCM   = "cm"
+	UnitM    = "m"
+	UnitInch = "in"
+)
+
+// Единицы веса
+const (
+	UnitGram     = "g"
+	UnitKilogram = "kg"
+	UnitPound    = "lb"
+	UnitOunce    = "oz"
+)
+
+// Системы единиц для вывода размеров и веса
+const (
+	UnitsMetric   = "metric"
+	UnitsImperial = "imperial"
+)
+
+// VolumetricDivisor задает делитель объемного веса: объем в кубических
+// сантиметрах, деленный на него, дает объемный вес в килограммах
+const VolumetricDivisor = 5000
+
+// Длина единицы в сантиметрах
+var lengthUnits = map[string]float64{
+	UnitMM:   0.1,
+	UnitCM:   1,
+	UnitM:    100,
+	UnitInch: 2.54,
+}
+
+// Вес единицы в килограммах
+var weightUnits = map[string]float64{
+	UnitGram:     0.001,
+	UnitKilogram: 1,
+	UnitPound:    0.45359237,
+	UnitOunce:    0.028349523125,
+}
+
+// Написания единиц, принимаемые при разборе строк
+var unitAliases = map[string]string{
+	"mm": UnitMM, "мм": UnitMM,
+	"cm": UnitCM, "см": UnitCM,
+	"m": UnitM, "м": UnitM,
+	"in": UnitInch, "inch": UnitInch, "inches": UnitInch, `"`: UnitInch, "дюйм": UnitInch,
+	"g": UnitGram, "г": UnitGram, "гр": UnitGram,
+	"kg": UnitKilogram, "кг": UnitKilogram,
+	"lb": UnitPound, "lbs": UnitPound, "фунт": UnitPound,
+	"oz": UnitOunce, "унц": UnitOunce,
+}
+
+// Dimensions представляет габариты продукта. В JSON принимается объект
+// {"length", "width", "height", "unit"} или строка вида "10x20x30 cm";
+// единица по умолчанию — сантиметры.
+type Dimensions struct {
+	Length float64 `json:"length"`
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+	Unit   string  `json:"unit"`
+}
+
+var dimensionsPattern = regexp.MustCompile(`^([0-9.,]+)\s*[xXхХ×*]\s*([0-9.,]+)\s*[xXхХ×*]\s*([0-9.,]+)\s*(\S*)$`)
+
+// ParseDimensions разбирает габариты из строки вида "10x20x30 cm". Все три
+// измерения должны быть больше 0.
+func ParseDimensions(value string) (Dimensions, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return Dimensions{}, nil
+	}
+
+	match := dimensionsPattern.FindStringSubmatch(value)
+	if match == nil {
+		return Dimensions{}, errors.New("ожидаются габариты вида 10x20x30 cm")
+	}
+
+	var d Dimensions
+	var err error
+	for i, target := range []*float64{&d.Length, &d.Width, &d.Height} {
+		if *target, err = parseMeasure(match[i+1]); err != nil {
+			return Dimensions{}, err
+		}
+	}
+	if d.Unit, err = parseUnit(match[4], UnitCM, lengthUnits); err != nil {
+		return Dimensions{}, err
+	}
+	if d.Length == 0 || d.Width == 0 || d.Height == 0 {
+		return Dimensions{}, errPartialDimensions
+	}
+	return d, nil
+}
+
+// errPartialDimensions означает, что габариты заданы не всеми измерениями
+var errPartialDimensions = errors.New("все габариты должны быть больше 0")
+
+// check отклоняет отрицательные габариты и габариты, заданные не всеми
+// измерениями
+func (d Dimensions) check() error {
+	if d.Length < 0 || d.Width < 0 || d.Height < 0 {
+		return errors.New("габариты не могут быть отрицательными")
+	}
+	if !d.IsZero() && (d.Length == 0 || d.Width == 0 || d.Height == 0) {
+		return errPartialDimensions
+	}
+	return nil
+}
+
+// IsZero сообщает, что габариты не заданы
+func (d Dimensions) IsZero() bool {
+	return d.Length == 0 && d.Width == 0 && d.Height == 0
+}
+
+// String возвращает габариты в виде "10x20x30 cm"
+func (d Dimensions) String() string {
+	if d.IsZero() {
+		return ""
+	}
+	return formatMeasure(d.Length) + "x" + formatMeasure(d.Width) + "x" + formatMeasure(d.Height) + " " + d.Unit
+}
+
+// In переводит габариты в единицу unit
+func (d Dimensions) In(unit string) (Dimensions, error) {
+	to, exists := lengthUnits[unit]
+	if !exists {
+		return Dimensions{}, errors.New("неизвестная единица длины " + unit)
+	}
+	if d.IsZero() {
+		return d, nil
+	}
+
+	factor := lengthUnits[d.Unit] / to
+	return Dimensions{
+		Length: round(d.Length * factor),
+		Width:  round(d.Width * factor),
+		Height: round(d.Height * factor),
+		Unit:   unit,
+	}, nil
+}
+
+// VolumetricWeight возвращает объемный вес габаритов в килограммах
+func (d Dimensions) VolumetricWeight() Weight {
+	if d.IsZero() {
+		return Weight{}
+	}
+	cm, _ := d.In(UnitCM)
+	return Weight{Value: round(cm.Length * cm.Width * cm.Height / VolumetricDivisor), Unit: UnitKilogram}
+}
+
+// MarshalJSON записывает незаданные габариты как null
+func (d Dimensions) MarshalJSON() ([]byte, error) {
+	if d.IsZero() {
+		return []byte("null"), nil
+	}
+	type dimensions Dimensions
+	return json.Marshal(dimensions(d))
+}
+
+// UnmarshalJSON принимает объект габаритов, строку вида "10x20x30 cm" или
+// null. Габариты, заданные не всеми измерениями, отклоняются.
+func (d *Dimensions) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err == nil {
+		parsed, err := ParseDimensions(value)
+		if err != nil {
+			return err
+		}
+		*d = parsed
+		return nil
+	}
+
+	type dimensions Dimensions
+	var parsed dimensions
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		return err
+	}
+	if err := Dimensions(parsed).check(); err != nil {
+		return err
+	}
+	if Dimensions(parsed).IsZero() {
+		*d = Dimensions{}
+		return nil
+	}
+	unit, err := parseUnit(parsed.Unit, UnitCM, lengthUnits)
+	if err != nil {
+		return err
+	}
+	parsed.Unit = unit
+	*d = Dimensions(parsed)
+	return nil
+}
+
+// Weight представляет вес продукта. В JSON принимается объект
+// {"value", "unit"}, число в килограммах или строка вида "1.5 kg".
+type Weight struct {
+	Value float64 `json:"value"`
+	Unit  string  `json:"unit"`
+}
+
+var weightPattern = regexp.MustCompile(`^([0-9.,]+)\s*(\S*)$`)
+
+// ParseWeight разбирает вес из строки вида "1.5 kg"; единица по умолчанию —
+// килограммы
+func ParseWeight(value string) (Weight, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return Weight{}, nil
+	}
+
+	match := weightPattern.FindStringSubmatch(value)
+	if match == nil {
+		return Weight{}, errors.New("ожидается вес вида 1.5 kg")
+	}
+
+	amount, err := parseMeasure(match[1])
+	if err != nil {
+		return Weight{}, err
+	}
+	unit, err := parseUnit(match[2], UnitKilogram, weightUnits)
+	if err != nil {
+		return Weight{}, err
+	}
+	return Weight{Value: amount, Unit: unit}, nil
+}
+
+// IsZero сообщает, что вес не задан
+func (w Weight) IsZero() bool {
+	return w.Value == 0
+}
+
+// String возвращает вес в виде "1.5 kg"
+func (w Weight) String() string {
+	if w.IsZero() {
+		return ""
+	}
+	return formatMeasure(w.Value) + " " + w.Unit
+}
+
+// In переводит вес в единицу unit
+func (w Weight) In(unit string) (Weight, error) {
+	to, exists := weightUnits[unit]
+	if !exists {
+		return Weight{}, errors.New("неизвестная единица веса " + unit)
+	}
+	if w.IsZero() {
+		return w, nil
+	}
+	return Weight{Value: round(w.Value * weightUnits[w.Unit] / to), Unit: unit}, nil
+}
+
+// Kilograms возвращает вес в килограммах
+func (w Weight) Kilograms() float64 {
+	return w.Value * weightUnits[w.Unit]
+}
+
+// MarshalJSON записывает незаданный вес как null
+func (w Weight) MarshalJSON() ([]byte, error) {
+	if w.IsZero() {
+		return []byte("null"), nil
+	}
+	type weight Weight
+	return json.Marshal(weight(w))
+}
+
+// UnmarshalJSON принимает объект веса, число в килограммах, строку вида
+// "1.5 kg" или null
+func (w *Weight) UnmarshalJSON(data []byte) error {
+	var number float64
+	if err := json.Unmarshal(data, &number); err == nil {
+		if number < 0 {
+			return errors.New("вес не может быть отрицательным")
+		}
+		*w = Weight{Value: number, Unit: UnitKilogram}
+		if number == 0 {
+			*w = Weight{}
+		}
+		return nil
+	}
+
+	var value string
+	if err := json.Unmarshal(data, &value); err == nil {
+		parsed, err := ParseWeight(value)
+		if err != nil {
+			return err
+		}
+		*w = parsed
+		return nil
+	}
+
+	type weight Weight
+	var parsed weight
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		return err
+	}
+	if parsed.Value < 0 {
+		return errors.New("вес не может быть отрицательным")
+	}
+	unit, err := parseUnit(parsed.Unit, UnitKilogram, weightUnits)
+	if err != nil {
+		return err
+	}
+	parsed.Unit = unit
+	*w = Weight(parsed)
+	return nil
+}
+
+// UnitSystem возвращает единицы длины и веса системы metric или imperial
+func UnitSystem(system string) (string, string, error) {
+	switch system {
+	case UnitsMetric:
+		return UnitCM, UnitKilogram, nil
+	case UnitsImperial:
+		return UnitInch, UnitPound, nil
+	default:
+		return "", "", errors.New("неизвестная система единиц " + system)
+	}
+}
+
+// ConvertUnits переводит габариты, вес и объемный вес продукта в единицы
+// системы metric или imperial
+func (p *Product) ConvertUnits(system string) error {
+	lengthUnit, weightUnit, err := UnitSystem(system)
+	if err != nil {
+		return err
+	}
+
+	p.Dimensions, _ = p.Dimensions.In(lengthUnit)
+	p.Weight, _ = p.Weight.In(weightUnit)
+	p.VolumetricWeight, _ = p.VolumetricWeight.In(weightUnit)
+	return nil
+}
+
+// parseUnit приводит написание единицы к обозначению из units
+func parseUnit(value, fallback string, units map[string]float64) (string, error) {
+	value = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(value), "."))
+	if value == "" {
+		return fallback, nil
+	}
+	if unit, exists := unitAliases[value]; exists {
+		value = unit
+	}
+	if _, exists := units[value]; !exists {
+		return "", errors.New("неизвестная единица измерения " + value)
+	}
+	return value, nil
+}
+
+func parseMeasure(value string) (float64, error) {
+	number, err := strconv.ParseFloat(strings.Replace(value, ",", ".", 1), 64)
+	if err != nil || number < 0 {
+		return 0, errors.New("ожидается неотрицательное число")
+	}
+	return number, nil
+}
+
+func formatMeasure(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+// round округляет значение после перевода единиц до тысячных
+func round(value float64) float64 {
+	return math.Round(value*1000) / 1000
+}
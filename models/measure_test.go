@@ -0,0 +1,200 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseDimensions(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    Dimensions
+		wantErr bool
+	}{
+		{"", Dimensions{}, false},
+		{"10x20x30", Dimensions{10, 20, 30, UnitCM}, false},
+		{"10x20x30 cm", Dimensions{10, 20, 30, UnitCM}, false},
+		{" 10 X 20 X 30 mm ", Dimensions{10, 20, 30, UnitMM}, false},
+		{"1,5х2,5×3.5 м", Dimensions{1.5, 2.5, 3.5, UnitM}, false},
+		{"4*5*6 см", Dimensions{4, 5, 6, UnitCM}, false},
+		{`10x20x30"`, Dimensions{10, 20, 30, UnitInch}, false},
+		{"10x20x30 inches", Dimensions{10, 20, 30, UnitInch}, false},
+		{"10x20x30 In.", Dimensions{10, 20, 30, UnitInch}, false},
+		{"10x0x30 cm", Dimensions{}, true},
+		{"0x0x0", Dimensions{}, true},
+		{"10x20 cm", Dimensions{}, true},
+		{"10x20x30 kg", Dimensions{}, true},
+		{"10x20x30 ft", Dimensions{}, true},
+		{"10x-20x30", Dimensions{}, true},
+		{"axbxc", Dimensions{}, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseDimensions(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseDimensions(%q): ошибка %v", tt.value, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseDimensions(%q) = %+v, ожидалось %+v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestDimensionsUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		json    string
+		want    Dimensions
+		wantErr bool
+	}{
+		{`null`, Dimensions{}, false},
+		{`"10x20x30 mm"`, Dimensions{10, 20, 30, UnitMM}, false},
+		{`{"length": 10, "width": 20, "height": 30}`, Dimensions{10, 20, 30, UnitCM}, false},
+		{`{"length": 1, "width": 2, "height": 3, "unit": "дюйм"}`, Dimensions{1, 2, 3, UnitInch}, false},
+		{`{}`, Dimensions{}, false},
+		{`{"length": 10}`, Dimensions{}, true},
+		{`{"length": 10, "width": 20, "height": 0}`, Dimensions{}, true},
+		{`{"length": -1, "width": 20, "height": 30}`, Dimensions{}, true},
+		{`{"length": 1, "width": 2, "height": 3, "unit": "kg"}`, Dimensions{}, true},
+		{`"10x0x30 cm"`, Dimensions{}, true},
+		{`42`, Dimensions{}, true},
+	}
+	for _, tt := range tests {
+		var got Dimensions
+		err := json.Unmarshal([]byte(tt.json), &got)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("разбор %s: ошибка %v", tt.json, err)
+			continue
+		}
+		if !tt.wantErr && got != tt.want {
+			t.Errorf("разбор %s = %+v, ожидалось %+v", tt.json, got, tt.want)
+		}
+	}
+}
+
+func TestParseWeight(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    Weight
+		wantErr bool
+	}{
+		{"", Weight{}, false},
+		{"1.5", Weight{1.5, UnitKilogram}, false},
+		{"1,5 кг", Weight{1.5, UnitKilogram}, false},
+		{"250 гр", Weight{250, UnitGram}, false},
+		{"2 lbs", Weight{2, UnitPound}, false},
+		{"8 OZ", Weight{8, UnitOunce}, false},
+		{"3 фунт", Weight{3, UnitPound}, false},
+		{"1.5 cm", Weight{}, true},
+		{"-1 kg", Weight{}, true},
+		{"много", Weight{}, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseWeight(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseWeight(%q): ошибка %v", tt.value, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseWeight(%q) = %+v, ожидалось %+v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestWeightUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		json    string
+		want    Weight
+		wantErr bool
+	}{
+		{`null`, Weight{}, false},
+		{`0`, Weight{}, false},
+		{`2.5`, Weight{2.5, UnitKilogram}, false},
+		{`"500 g"`, Weight{500, UnitGram}, false},
+		{`{"value": 3, "unit": "lb"}`, Weight{3, UnitPound}, false},
+		{`{"value": 3}`, Weight{3, UnitKilogram}, false},
+		{`-1`, Weight{}, true},
+		{`{"value": -3, "unit": "kg"}`, Weight{}, true},
+		{`{"value": 3, "unit": "cm"}`, Weight{}, true},
+	}
+	for _, tt := range tests {
+		var got Weight
+		err := json.Unmarshal([]byte(tt.json), &got)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("разбор %s: ошибка %v", tt.json, err)
+			continue
+		}
+		if !tt.wantErr && got != tt.want {
+			t.Errorf("разбор %s = %+v, ожидалось %+v", tt.json, got, tt.want)
+		}
+	}
+}
+
+func TestDimensionsIn(t *testing.T) {
+	tests := []struct {
+		from    Dimensions
+		unit    string
+		want    Dimensions
+		wantErr bool
+	}{
+		{Dimensions{10, 20, 30, UnitCM}, UnitMM, Dimensions{100, 200, 300, UnitMM}, false},
+		{Dimensions{1, 2, 3, UnitM}, UnitCM, Dimensions{100, 200, 300, UnitCM}, false},
+		{Dimensions{1, 2, 3, UnitInch}, UnitCM, Dimensions{2.54, 5.08, 7.62, UnitCM}, false},
+		{Dimensions{2.54, 5.08, 10, UnitCM}, UnitInch, Dimensions{1, 2, 3.937, UnitInch}, false},
+		{Dimensions{}, UnitInch, Dimensions{}, false},
+		{Dimensions{1, 2, 3, UnitCM}, "ft", Dimensions{}, true},
+	}
+	for _, tt := range tests {
+		got, err := tt.from.In(tt.unit)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%+v в %s: ошибка %v", tt.from, tt.unit, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%+v в %s = %+v, ожидалось %+v", tt.from, tt.unit, got, tt.want)
+		}
+	}
+}
+
+func TestWeightIn(t *testing.T) {
+	tests := []struct {
+		from    Weight
+		unit    string
+		want    Weight
+		wantErr bool
+	}{
+		{Weight{1.5, UnitKilogram}, UnitGram, Weight{1500, UnitGram}, false},
+		{Weight{1, UnitKilogram}, UnitPound, Weight{2.205, UnitPound}, false},
+		{Weight{16, UnitOunce}, UnitPound, Weight{1, UnitPound}, false},
+		{Weight{500, UnitGram}, UnitKilogram, Weight{0.5, UnitKilogram}, false},
+		{Weight{}, UnitPound, Weight{}, false},
+		{Weight{1, UnitKilogram}, "t", Weight{}, true},
+	}
+	for _, tt := range tests {
+		got, err := tt.from.In(tt.unit)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%+v в %s: ошибка %v", tt.from, tt.unit, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%+v в %s = %+v, ожидалось %+v", tt.from, tt.unit, got, tt.want)
+		}
+	}
+}
+
+func TestVolumetricWeight(t *testing.T) {
+	tests := []struct {
+		dimensions Dimensions
+		want       Weight
+	}{
+		{Dimensions{}, Weight{}},
+		{Dimensions{10, 20, 25, UnitCM}, Weight{1, UnitKilogram}},
+		{Dimensions{100, 200, 250, UnitMM}, Weight{1, UnitKilogram}},
+		{Dimensions{0.5, 0.4, 0.3, UnitM}, Weight{12, UnitKilogram}},
+		{Dimensions{10, 10, 10, UnitInch}, Weight{3.277, UnitKilogram}},
+	}
+	for _, tt := range tests {
+		if got := tt.dimensions.VolumetricWeight(); got != tt.want {
+			t.Errorf("объемный вес %+v = %+v, ожидалось %+v", tt.dimensions, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+)
+
+// Статусы записи outbox
+const (
+	OutboxPending   = "pending"
+	OutboxDelivered = "delivered"
+	OutboxFailed    = "failed"
+)
+
+// OutboxEntry представляет событие, записанное в outbox вместе с изменением
+// продукта и ожидающее публикации. ChangeSeq содержит номер последней записи
+// ленты изменений, вместе с которой было записано событие. DeliveredTo
+// содержит имена приемников, которые уже приняли событие, чтобы при повторе
+// отправлять его только остальным.
+type OutboxEntry struct {
+	ID            uint64       `json:"id"`
+	ChangeSeq     uint64       `json:"change_seq"`
+	Event         ProductEvent `json:"event"`
+	Status        string       `json:"status"`
+	Attempts      int          `json:"attempts"`
+	DeliveredTo   []string     `json:"delivered_to"`
+	LastError     string       `json:"last_error,omitempty"`
+	NextAttemptAt time.Time    `json:"next_attempt_at"`
+	CreatedAt     time.Time    `json:"created_at"`
+	UpdatedAt     time.Time    `json:"updated_at"`
+}
+
+// OutboxStats представляет количество записей outbox по статусам
+type OutboxStats struct {
+	Pending   int `json:"pending"`
+	Delivered int `json:"delivered"`
+	Failed    int `json:"failed"`
+}
@@ -2,46 +2,158 @@ package models
 
 import (
 	"time"
+
+	"github.com/google/uuid"
 )
 
-// Product представляет собой модель продукта
+// Product представляет собой модель продукта. Родительский продукт задает
+// оси вариантов в VariantAxes, а вариант ссылается на родителя через ParentID
+// и задает значения осей в Options. Набор перечисляет компоненты в Bundle.
 type Product struct {
-	ID          string           `json:"id"`
-	Name        string           `json:"name"`
-	Description string           `json:"description"`
-	Price       float64          `json:"price"`
-	Category    string           `json:"category"`
-	Stock       int              `json:"stock"`
-	CreatedAt   time.Time        `json:"created_at"`
-	UpdatedAt   time.Time        `json:"updated_at"`
-	Discount    float64          `json:"discount"`
-	Featured    bool             `json:"featured"`
-	Popularity  int              `json:"popularity"`
-	Views       int              `json:"views"`
-	Tags        []string         `json:"tags"`
-	SKU         string           `json:"sku"`
-	Barcode     string           `json:"barcode"`
-	Weight      float64          `json:"weight"`
-	Dimensions  string           `json:"dimensions"`
-	Status      string           `json:"status"`
-	History     []ProductHistory `json:"history,omitempty"`
+	ID               string            `json:"id"`
+	Name             string            `json:"name"`
+	Description      string            `json:"description"`
+	Price            float64           `json:"price"`
+	Category         string            `json:"category"`
+	Stock            int               `json:"stock"`
+	CreatedAt        time.Time         `json:"created_at"`
+	UpdatedAt        time.Time         `json:"updated_at"`
+	Discount         float64           `json:"discount"`
+	Featured         bool              `json:"featured"`
+	Popularity       int               `json:"popularity"`
+	Views            int               `json:"views"`
+	Tags             []string          `json:"tags"`
+	SKU              string            `json:"sku"`
+	Barcode          string            `json:"barcode"`
+	Weight           Weight            `json:"weight"`
+	Dimensions       Dimensions        `json:"dimensions"`
+	VolumetricWeight Weight            `json:"volumetric_weight"`
+	Status           string            `json:"status"`
+	ReorderPoint     int               `json:"reorder_point"`
+	SafetyStock      int               `json:"safety_stock"`
+	Attributes       Attributes        `json:"attributes,omitempty"`
+	ParentID         string            `json:"parent_id,omitempty"`
+	VariantAxes      []VariantAxis     `json:"variant_axes,omitempty"`
+	Options          map[string]string `json:"options,omitempty"`
+	PriceOverride    *float64          `json:"price_override,omitempty"`
+	Bundle           *Bundle           `json:"bundle,omitempty"`
+	History          []ProductHistory  `json:"history,omitempty"`
 }
 
 // ProductInput представляет собой структуру для создания/обновления продукта
 type ProductInput struct {
-	Name        string   `json:"name" binding:"required"`
-	Description string   `json:"description"`
-	Price       float64  `json:"price" binding:"required,gt=0"`
-	Category    string   `json:"category" binding:"required"`
-	Stock       int      `json:"stock" binding:"required,gte=0"`
-	Discount    float64  `json:"discount" binding:"gte=0,lte=100"`
-	Featured    bool     `json:"featured"`
-	Tags        []string `json:"tags"`
-	SKU         string   `json:"sku"`
-	Barcode     string   `json:"barcode"`
-	Weight      float64  `json:"weight"`
-	Dimensions  string   `json:"dimensions"`
-	Status      string   `json:"status"`
+	Name         string     `json:"name" binding:"required"`
+	Description  string     `json:"description"`
+	Price        float64    `json:"price" binding:"required,gt=0"`
+	Category     string     `json:"category" binding:"required"`
+	Stock        int        `json:"stock" binding:"required,gte=0"`
+	Discount     float64    `json:"discount" binding:"gte=0,lte=100"`
+	Featured     bool       `json:"featured"`
+	Tags         []string   `json:"tags"`
+	SKU          string     `json:"sku"`
+	Barcode      string     `json:"barcode"`
+	Weight       Weight     `json:"weight"`
+	Dimensions   Dimensions `json:"dimensions"`
+	Status       string     `json:"status"`
+	ReorderPoint int        `json:"reorder_point" binding:"gte=0"`
+	SafetyStock  int        `json:"safety_stock" binding:"gte=0"`
+	Attributes   Attributes `json:"attributes"`
+}
+
+// NewProduct создает продукт с новым ID из входных данных
+func NewProduct(input ProductInput, now time.Time) Product {
+	product := Product{
+		ID:        uuid.New().String(),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	product.ApplyInput(input)
+	return product
+}
+
+// ApplyInput переносит входные данные в продукт
+func (p *Product) ApplyInput(input ProductInput) {
+	p.Name = input.Name
+	p.Description = input.Description
+	p.Price = input.Price
+	p.Category = input.Category
+	p.Stock = input.Stock
+	p.Discount = input.Discount
+	p.Featured = input.Featured
+	p.Tags = input.Tags
+	p.SKU = input.SKU
+	p.Barcode = input.Barcode
+	p.Weight = input.Weight
+	p.Dimensions = input.Dimensions
+	// Объемный вес хранится вместе с продуктом, чтобы по нему можно было фильтровать
+	p.VolumetricWeight = input.Dimensions.VolumetricWeight()
+	p.Status = input.Status
+	p.ReorderPoint = input.ReorderPoint
+	p.SafetyStock = input.SafetyStock
+	p.Attributes = input.Attributes
+}
+
+// Clone возвращает глубокую копию продукта, не разделяющую с ним срезы и
+// карты тегов, истории, атрибутов, вариантов и состава набора. Емкость
+// срезов копии равна длине, поэтому append к ним всегда выделяет новый
+// массив и не затрагивает другие копии.
+func (p Product) Clone() Product {
+	clone := p
+	if p.Tags != nil {
+		clone.Tags = make([]string, len(p.Tags))
+		copy(clone.Tags, p.Tags)
+	}
+	if p.Attributes != nil {
+		clone.Attributes = p.Attributes.Clone()
+	}
+	if p.VariantAxes != nil {
+		clone.VariantAxes = make([]VariantAxis, len(p.VariantAxes))
+		for i, axis := range p.VariantAxes {
+			axis.Values = append([]string(nil), axis.Values...)
+			clone.VariantAxes[i] = axis
+		}
+	}
+	if p.Options != nil {
+		clone.Options = make(map[string]string, len(p.Options))
+		for name, value := range p.Options {
+			clone.Options[name] = value
+		}
+	}
+	if p.PriceOverride != nil {
+		price := *p.PriceOverride
+		clone.PriceOverride = &price
+	}
+	clone.Bundle = p.Bundle.Clone()
+	if p.History != nil {
+		clone.History = make([]ProductHistory, len(p.History))
+		for i, entry := range p.History {
+			entry.OldValue = cloneValue(entry.OldValue)
+			entry.NewValue = cloneValue(entry.NewValue)
+			clone.History[i] = entry
+		}
+	}
+	return clone
+}
+
+// cloneValue копирует значение истории. Значения, восстановленные из JSON,
+// могут быть картами и срезами; остальные значения скалярные.
+func cloneValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		clone := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			clone[key] = cloneValue(item)
+		}
+		return clone
+	case []interface{}:
+		clone := make([]interface{}, len(v))
+		for i, item := range v {
+			clone[i] = cloneValue(item)
+		}
+		return clone
+	default:
+		return value
+	}
 }
 
 // ProductHistory представляет историю изменений продукта
@@ -0,0 +1,16 @@
+package models
+
+// SimilarityScores содержит составляющие оценки сходства продуктов, каждая от 0 до 1
+type SimilarityScores struct {
+	Category    float64 `json:"category"`
+	Tags        float64 `json:"tags"`
+	Price       float64 `json:"price"`
+	Description float64 `json:"description"`
+}
+
+// SimilarProduct представляет похожий продукт с итоговой оценкой и ее составляющими
+type SimilarProduct struct {
+	Product Product          `json:"product"`
+	Score   float64          `json:"score"`
+	Scores  SimilarityScores `json:"scores"`
+}
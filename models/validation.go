@@ -0,0 +1,75 @@
+package models
+
+import (
+	"time"
+)
+
+// Уровни серьезности нарушений правил проверки
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// ValidationError описывает нарушение правила проверки поля продукта.
+// Нарушения уровня error запрещают запись продукта, warning только
+// попадают в отчеты о качестве каталога.
+type ValidationError struct {
+	Field    string `json:"field"`
+	Message  string `json:"message"`
+	Severity string `json:"severity"`
+	Rule     string `json:"rule"`
+}
+
+// Error возвращает описание ошибки в виде "поле: сообщение"
+func (e ValidationError) Error() string {
+	return e.Field + ": " + e.Message
+}
+
+// ValidationReport представляет результат проверки продукта
+type ValidationReport struct {
+	ProductID string            `json:"product_id"`
+	Name      string            `json:"name,omitempty"`
+	Category  string            `json:"category,omitempty"`
+	Valid     bool              `json:"valid"`
+	Checks    map[string]bool   `json:"checks,omitempty"`
+	Errors    []ValidationError `json:"errors"`
+	Warnings  []ValidationError `json:"warnings"`
+}
+
+// CatalogValidationReport представляет отчет о качестве каталога. В список
+// продуктов попадают только продукты с нарушениями.
+type CatalogValidationReport struct {
+	GeneratedAt  time.Time          `json:"generated_at"`
+	Total        int                `json:"total"`
+	Valid        int                `json:"valid"`
+	WithErrors   int                `json:"with_errors"`
+	WithWarnings int                `json:"with_warnings"`
+	ByRule       map[string]int     `json:"by_rule"`
+	Products     []ValidationReport `json:"products"`
+}
+
+// ValidationRule описывает правило проверки из файла конфигурации. Type
+// выбирает вид правила, остальные параметры зависят от вида. Правило
+// применяется только к категориям Categories, если они заданы.
+type ValidationRule struct {
+	Name       string   `json:"name"`
+	Type       string   `json:"type"`
+	Severity   string   `json:"severity"`
+	Categories []string `json:"categories,omitempty"`
+	Fields     []string `json:"fields,omitempty"`
+	Min        *float64 `json:"min,omitempty"`
+	Max        *float64 `json:"max,omitempty"`
+	Tags       []string `json:"tags,omitempty"`
+}
+
+// SKUPattern задает регулярное выражение для SKU продуктов категории.
+// Шаблон категории "*" применяется к категориям без собственного шаблона.
+type SKUPattern struct {
+	Category string `json:"category"`
+	Pattern  string `json:"pattern"`
+}
+
+// SKUPatternInput представляет структуру для установки шаблона SKU
+type SKUPatternInput struct {
+	Pattern string `json:"pattern" binding:"required"`
+}
@@ -0,0 +1,186 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// VariantAxis задает ось вариантов продукта, например размер или цвет,
+// и ее допустимые значения
+type VariantAxis struct {
+	Name   string   `json:"name" binding:"required"`
+	Values []string `json:"values" binding:"required,min=1"`
+}
+
+// VariantAxesInput задает оси вариантов родительского продукта
+type VariantAxesInput struct {
+	Axes []VariantAxis `json:"axes" binding:"required,min=1,dive"`
+}
+
+// VariantInput представляет структуру для создания/обновления варианта.
+// Название, описание, категория и атрибуты наследуются от родителя; без
+// price вариант продается по цене родителя.
+type VariantInput struct {
+	Options map[string]string `json:"options" binding:"required"`
+	SKU     string            `json:"sku"`
+	Barcode string            `json:"barcode"`
+	Price   *float64          `json:"price" binding:"omitempty,gt=0"`
+	Stock   int               `json:"stock" binding:"gte=0"`
+	Status  string            `json:"status"`
+}
+
+// VariantAvailability сводит наличие вариантов родительского продукта
+type VariantAvailability struct {
+	TotalStock         int  `json:"total_stock"`
+	Variants           int  `json:"variants"`
+	InStockVariants    int  `json:"in_stock_variants"`
+	OutOfStockVariants int  `json:"out_of_stock_variants"`
+	Available          bool `json:"available"`
+}
+
+// ProductVariants представляет родительский продукт вместе с вариантами
+type ProductVariants struct {
+	Parent       Product             `json:"parent"`
+	Variants     []Product           `json:"variants"`
+	Availability VariantAvailability `json:"availability"`
+}
+
+// IsVariantParent сообщает, что у продукта заданы оси вариантов
+func (p Product) IsVariantParent() bool {
+	return len(p.VariantAxes) > 0
+}
+
+// IsVariant сообщает, что продукт является вариантом другого продукта
+func (p Product) IsVariant() bool {
+	return p.ParentID != ""
+}
+
+// NewVariant создает вариант родительского продукта с новым ID. Общие поля
+// копируются из родителя, собственные — из входных данных.
+func NewVariant(parent Product, input VariantInput, now time.Time) Product {
+	variant := parent.Clone()
+	variant.ID = uuid.New().String()
+	variant.CreatedAt = now
+	variant.UpdatedAt = now
+	variant.ParentID = parent.ID
+	variant.VariantAxes = nil
+	variant.Popularity = 0
+	variant.Views = 0
+	variant.History = nil
+	variant.ApplyVariantInput(input)
+	variant.ApplyParent(parent)
+	return variant
+}
+
+// ApplyVariantInput переносит собственные поля варианта из входных данных
+func (p *Product) ApplyVariantInput(input VariantInput) {
+	p.Options = input.Options
+	p.SKU = input.SKU
+	p.Barcode = input.Barcode
+	p.PriceOverride = input.Price
+	p.Stock = input.Stock
+	p.Status = input.Status
+}
+
+// ApplyParent приводит поля варианта, которые всегда совпадают с
+// родителем, в соответствие с ним: название с опциями, категорию и цену,
+// если она не переопределена
+func (p *Product) ApplyParent(parent Product) {
+	p.Name = parent.Name + " (" + strings.Join(p.optionValues(parent.VariantAxes), ", ") + ")"
+	p.Category = parent.Category
+	if p.PriceOverride != nil {
+		p.Price = *p.PriceOverride
+	} else {
+		p.Price = parent.Price
+	}
+}
+
+// optionValues возвращает значения опций варианта в порядке осей
+func (p Product) optionValues(axes []VariantAxis) []string {
+	values := make([]string, 0, len(axes))
+	for _, axis := range axes {
+		if value, exists := p.Options[axis.Name]; exists {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// OptionsKey возвращает строку, однозначно задающую сочетание опций по осям
+func OptionsKey(axes []VariantAxis, options map[string]string) string {
+	parts := make([]string, len(axes))
+	for i, axis := range axes {
+		parts[i] = axis.Name + "=" + options[axis.Name]
+	}
+	return strings.Join(parts, ";")
+}
+
+// ValidateAxes проверяет, что имена осей и их значения уникальны и не пусты
+func ValidateAxes(axes []VariantAxis) error {
+	names := make(map[string]bool, len(axes))
+	for _, axis := range axes {
+		if axis.Name == "" {
+			return errors.New("у оси вариантов должно быть имя")
+		}
+		if names[axis.Name] {
+			return fmt.Errorf("ось вариантов %q описана повторно", axis.Name)
+		}
+		names[axis.Name] = true
+
+		values := make(map[string]bool, len(axis.Values))
+		for _, value := range axis.Values {
+			if value == "" {
+				return fmt.Errorf("у оси %q есть пустое значение", axis.Name)
+			}
+			if values[value] {
+				return fmt.Errorf("значение %q оси %q указано повторно", value, axis.Name)
+			}
+			values[value] = true
+		}
+	}
+	return nil
+}
+
+// ValidateOptions проверяет, что опции варианта задают по одному допустимому
+// значению для каждой оси и не содержат других осей
+func ValidateOptions(axes []VariantAxis, options map[string]string) error {
+	for _, axis := range axes {
+		value, exists := options[axis.Name]
+		if !exists {
+			return fmt.Errorf("не задано значение оси %q", axis.Name)
+		}
+		if !containsString(axis.Values, value) {
+			return fmt.Errorf("значение %q не входит в ось %q", value, axis.Name)
+		}
+	}
+	if len(options) != len(axes) {
+		for name := range options {
+			if !hasAxis(axes, name) {
+				return fmt.Errorf("у продукта нет оси вариантов %q", name)
+			}
+		}
+	}
+	return nil
+}
+
+func hasAxis(axes []VariantAxis, name string) bool {
+	for _, axis := range axes {
+		if axis.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,66 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Статусы доставки вебхука
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+)
+
+// Webhook представляет подписку внешнего сервиса на события продуктов.
+// Events содержит типы событий из EventTypes или "*" для всех событий.
+type Webhook struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	Secret    string    `json:"secret,omitempty"`
+	Active    bool      `json:"active"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Matches сообщает, подписан ли вебхук на событие указанного типа
+func (w Webhook) Matches(eventType string) bool {
+	for _, e := range w.Events {
+		if e == "*" || e == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookInput представляет структуру для создания/обновления вебхука
+type WebhookInput struct {
+	URL    string   `json:"url" binding:"required,url"`
+	Events []string `json:"events" binding:"required,min=1"`
+	Secret string   `json:"secret"`
+	Active *bool    `json:"active"`
+}
+
+// WebhookDelivery представляет доставку одного события на вебхук
+type WebhookDelivery struct {
+	ID           string            `json:"id"`
+	WebhookID    string            `json:"webhook_id"`
+	EventID      string            `json:"event_id"`
+	EventType    string            `json:"event_type"`
+	Payload      json.RawMessage   `json:"payload"`
+	Status       string            `json:"status"`
+	Attempts     []DeliveryAttempt `json:"attempts"`
+	RedeliveryOf string            `json:"redelivery_of,omitempty"`
+	CreatedAt    time.Time         `json:"created_at"`
+	UpdatedAt    time.Time         `json:"updated_at"`
+}
+
+// DeliveryAttempt представляет одну попытку доставки вебхука
+type DeliveryAttempt struct {
+	Number     int       `json:"number"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	DurationMs int64     `json:"duration_ms"`
+	Timestamp  time.Time `json:"timestamp"`
+}
@@ -0,0 +1,137 @@
+package outbox
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/Afra1m/product_api/models"
+	"github.com/Afra1m/product_api/storage"
+)
+
+// Sink принимает события из outbox. Publish должен вернуть ошибку, если
+// событие не было принято; тогда оно будет отправлено повторно. Событие
+// может прийти в приемник больше одного раза, поэтому получатели должны
+// устранять дубликаты по ID события.
+type Sink interface {
+	Name() string
+	Publish(entry models.OutboxEntry) error
+}
+
+// Relay публикует записи outbox во все приемники с семантикой
+// "хотя бы один раз". Записи обрабатываются по порядку; при ошибке
+// обработка пакета прерывается, чтобы не нарушить порядок событий.
+type Relay struct {
+	storage *storage.ProductStorage
+	sinks   []Sink
+
+	// PollInterval задает период проверки outbox без сигнала о новых записях
+	PollInterval time.Duration
+	// BatchSize ограничивает число записей, обрабатываемых за один проход
+	BatchSize int
+	// MaxAttempts задает число попыток, после которого запись получает статус failed
+	MaxAttempts int
+	// BaseDelay задает задержку перед второй попыткой, далее она удваивается
+	BaseDelay time.Duration
+	// MaxDelay ограничивает задержку между попытками
+	MaxDelay time.Duration
+}
+
+// NewRelay создает новый ретранслятор outbox
+func NewRelay(storage *storage.ProductStorage, sinks ...Sink) *Relay {
+	return &Relay{
+		storage:      storage,
+		sinks:        sinks,
+		PollInterval: time.Second,
+		BatchSize:    100,
+		MaxAttempts:  10,
+		BaseDelay:    time.Second,
+		MaxDelay:     5 * time.Minute,
+	}
+}
+
+// Run обрабатывает outbox до отмены контекста
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		for r.processBatch() {
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-r.storage.OutboxNotify():
+		case <-ticker.C:
+		}
+	}
+}
+
+// processBatch публикует один пакет записей и сообщает, стоит ли сразу
+// обработать следующий
+func (r *Relay) processBatch() bool {
+	entries := r.storage.PendingOutbox(time.Now(), r.BatchSize)
+	for _, entry := range entries {
+		if !r.publish(entry) {
+			return false
+		}
+	}
+	return len(entries) == r.BatchSize
+}
+
+// publish отправляет запись во все приемники, которые ее еще не приняли,
+// и сообщает, была ли она доставлена полностью
+func (r *Relay) publish(entry models.OutboxEntry) bool {
+	delivered := append([]string{}, entry.DeliveredTo...)
+	var errs []string
+
+	for _, sink := range r.sinks {
+		if containsString(delivered, sink.Name()) {
+			continue
+		}
+		if err := sink.Publish(entry); err != nil {
+			errs = append(errs, sink.Name()+": "+err.Error())
+			continue
+		}
+		delivered = append(delivered, sink.Name())
+	}
+
+	if len(errs) == 0 {
+		if err := r.storage.MarkOutboxDelivered(entry.ID, delivered); err != nil {
+			log.Println("Не удалось подтвердить запись outbox:", err)
+		}
+		return true
+	}
+
+	attempt := entry.Attempts + 1
+	failed := attempt >= r.MaxAttempts
+	nextAttemptAt := time.Now().Add(r.backoff(attempt))
+	if err := r.storage.MarkOutboxAttemptFailed(entry.ID, delivered, strings.Join(errs, "; "), nextAttemptAt, failed); err != nil {
+		log.Println("Не удалось сохранить результат попытки outbox:", err)
+	}
+	// Запись, исчерпавшая попытки, больше не задерживает следующие
+	return failed
+}
+
+// backoff возвращает задержку после неудачной попытки с указанным номером
+func (r *Relay) backoff(attempt int) time.Duration {
+	delay := r.BaseDelay
+	for i := 1; i < attempt; i++ {
+		delay *= 2
+		if delay >= r.MaxDelay {
+			return r.MaxDelay
+		}
+	}
+	return delay
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,120 @@
+package outbox
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/Afra1m/product_api/events"
+	"github.com/Afra1m/product_api/models"
+	"github.com/Afra1m/product_api/webhooks"
+)
+
+// WebhookSink передает события диспетчеру вебхуков, который сам выполняет
+// доставку и повторы для каждого подписчика
+type WebhookSink struct {
+	dispatcher *webhooks.Dispatcher
+}
+
+// NewWebhookSink создает приемник для доставки событий на вебхуки
+func NewWebhookSink(dispatcher *webhooks.Dispatcher) *WebhookSink {
+	return &WebhookSink{dispatcher: dispatcher}
+}
+
+// Name возвращает имя приемника
+func (s *WebhookSink) Name() string {
+	return "webhook"
+}
+
+// Publish передает событие диспетчеру вебхуков
+func (s *WebhookSink) Publish(entry models.OutboxEntry) error {
+	return s.dispatcher.HandleEvent(entry.Event)
+}
+
+// BusSink публикует события во внутреннюю шину, из которой их получают
+// клиенты потока событий
+type BusSink struct {
+	broker *events.Broker
+}
+
+// NewBusSink создает приемник для внутренней шины событий
+func NewBusSink(broker *events.Broker) *BusSink {
+	return &BusSink{broker: broker}
+}
+
+// Name возвращает имя приемника
+func (s *BusSink) Name() string {
+	return "bus"
+}
+
+// Publish публикует событие в шину
+func (s *BusSink) Publish(entry models.OutboxEntry) error {
+	s.broker.Publish(entry.ID, entry.Event)
+	return nil
+}
+
+// WriterSink записывает события в формате NDJSON: одна запись outbox на строку
+type WriterSink struct {
+	name string
+	w    io.Writer
+	mu   sync.Mutex
+}
+
+// NewWriterSink создает приемник, записывающий события в w
+func NewWriterSink(name string, w io.Writer) *WriterSink {
+	return &WriterSink{name: name, w: w}
+}
+
+// NewStdoutSink создает приемник, записывающий события в стандартный вывод
+func NewStdoutSink() *WriterSink {
+	return NewWriterSink("stdout", os.Stdout)
+}
+
+// Name возвращает имя приемника
+func (s *WriterSink) Name() string {
+	return s.name
+}
+
+// Publish записывает событие строкой NDJSON
+func (s *WriterSink) Publish(entry models.OutboxEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err = s.w.Write(line)
+	return err
+}
+
+// FileSink дописывает события в файл в формате NDJSON
+type FileSink struct {
+	*WriterSink
+	file *os.File
+}
+
+// NewFileSink открывает файл для дозаписи и создает приемник
+func NewFileSink(path string) (*FileSink, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &FileSink{WriterSink: NewWriterSink("file", file), file: file}, nil
+}
+
+// Publish записывает событие в файл и сбрасывает его на диск
+func (s *FileSink) Publish(entry models.OutboxEntry) error {
+	if err := s.WriterSink.Publish(entry); err != nil {
+		return err
+	}
+	return s.file.Sync()
+}
+
+// Close закрывает файл
+func (s *FileSink) Close() error {
+	return s.file.Close()
+}
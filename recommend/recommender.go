@@ -0,0 +1,64 @@
+package recommend
+
+import (
+	"errors"
+	"time"
+
+	"github.com/Afra1m/product_api/models"
+	"github.com/Afra1m/product_api/storage"
+)
+
+// MaxClockSkew задает, насколько время события может опережать часы сервера:
+// больший сдвиг означает неверные часы клиента
+const MaxClockSkew = 5 * time.Minute
+
+// ErrFutureEvent означает, что время события опережает часы сервера больше,
+// чем на MaxClockSkew
+var ErrFutureEvent = errors.New("время события в будущем")
+
+// Recommender объединяет модели рекомендаций и распределяет между ними
+// события поведения покупателей
+type Recommender struct {
+	Similar  *Similar
+	Related  *Related
+	Trending *Trending
+
+	storage *storage.ProductStorage
+}
+
+// NewRecommender создает модели рекомендаций с периодом полураспада трендов halfLife
+func NewRecommender(storage *storage.ProductStorage, halfLife time.Duration) *Recommender {
+	return &Recommender{
+		Similar:  NewSimilar(),
+		Related:  NewRelated(storage),
+		Trending: NewTrending(storage, halfLife),
+		storage:  storage,
+	}
+}
+
+// Record учитывает событие в трендах, счетчиках продукта и, если известна
+// сессия, в модели совместных действий. Просмотр увеличивает счетчик
+// просмотров, покупка — популярность продукта. События из будущего
+// отклоняются: иначе они держали бы продукт в трендах и сессию открытой.
+func (r *Recommender) Record(event models.ActivityEvent) error {
+	if event.Timestamp.After(time.Now().Add(MaxClockSkew)) {
+		return ErrFutureEvent
+	}
+
+	views, popularity := 0, 0
+	switch event.Type {
+	case models.ActivityView:
+		views = 1
+	case models.ActivityPurchase:
+		popularity = 1
+	}
+	if err := r.storage.IncrementCounters(event.ProductID, views, popularity); err != nil {
+		return err
+	}
+
+	r.Trending.Record(event)
+	if event.SessionID != "" {
+		r.Related.Record(event)
+	}
+	return nil
+}
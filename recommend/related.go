@@ -0,0 +1,213 @@
+package recommend
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Afra1m/product_api/models"
+	"github.com/Afra1m/product_api/storage"
+)
+
+// Параметры модели совместных действий
+const (
+	// SessionTTL задает время бездействия, после которого сессия забывается
+	SessionTTL = 30 * time.Minute
+	// MaxSessionProducts ограничивает число продуктов, запоминаемых в сессии
+	MaxSessionProducts = 50
+	// CoOccurrenceWeight задает вклад совместных действий в оценку, остальное дают общие теги
+	CoOccurrenceWeight = 0.7
+	// MaxPairs ограничивает число связей, хранимых для продукта: при вдвое
+	// большем числе остаются MaxPairs самых сильных
+	MaxPairs = 200
+)
+
+// Вес события: покупка вместе говорит о связи сильнее, чем просмотр
+var activityWeights = map[string]float64{
+	models.ActivityView:      1,
+	models.ActivityAddToCart: 2,
+	models.ActivityPurchase:  3,
+}
+
+// session хранит самое сильное действие с каждым продуктом сессии
+type session struct {
+	products map[string]float64
+	lastSeen time.Time
+}
+
+// Related строит связи продуктов по совместным действиям в сессиях. Пара
+// продуктов получает вес более слабого из двух действий в каждой сессии,
+// где встретились оба продукта; итоговая связь нормализуется по общей
+// активности обоих продуктов и смешивается с пересечением тегов. Связи
+// удаленных продуктов забываются вместе с неактивными сессиями.
+type Related struct {
+	storage  *storage.ProductStorage
+	sessions map[string]*session
+	pairs    map[string]map[string]float64
+	totals   map[string]float64
+	events   int
+	mu       sync.RWMutex
+}
+
+// NewRelated создает модель связанных продуктов каталога storage
+func NewRelated(storage *storage.ProductStorage) *Related {
+	return &Related{
+		storage:  storage,
+		sessions: make(map[string]*session),
+		pairs:    make(map[string]map[string]float64),
+		totals:   make(map[string]float64),
+	}
+}
+
+// Record учитывает событие в модели совместных действий. Неактивные сессии
+// удаляются по часам сервера, а не по времени события, которое задает клиент.
+func (r *Related) Record(event models.ActivityEvent) {
+	weight := activityWeights[event.Type]
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.events++
+	if r.events%1000 == 0 {
+		r.pruneSessions(time.Now())
+		r.pruneDeleted()
+	}
+
+	s, exists := r.sessions[event.SessionID]
+	if !exists || event.Timestamp.Sub(s.lastSeen) > SessionTTL {
+		s = &session{products: make(map[string]float64)}
+		r.sessions[event.SessionID] = s
+	}
+	if event.Timestamp.After(s.lastSeen) {
+		s.lastSeen = event.Timestamp
+	}
+
+	previous, seen := s.products[event.ProductID]
+	if weight <= previous || (!seen && len(s.products) >= MaxSessionProducts) {
+		return
+	}
+	s.products[event.ProductID] = weight
+	r.totals[event.ProductID] += weight - previous
+
+	for other, otherWeight := range s.products {
+		if other == event.ProductID {
+			continue
+		}
+		delta := math.Min(weight, otherWeight) - math.Min(previous, otherWeight)
+		if delta > 0 {
+			r.addPair(event.ProductID, other, delta)
+			r.addPair(other, event.ProductID, delta)
+		}
+	}
+}
+
+func (r *Related) addPair(a, b string, delta float64) {
+	if r.pairs[a] == nil {
+		r.pairs[a] = make(map[string]float64)
+	}
+	r.pairs[a][b] += delta
+	if len(r.pairs[a]) > 2*MaxPairs {
+		r.trimPairs(a)
+	}
+}
+
+// trimPairs оставляет MaxPairs самых сильных связей продукта. Вызывается под
+// блокировкой.
+func (r *Related) trimPairs(productID string) {
+	pairs := r.pairs[productID]
+	others := make([]string, 0, len(pairs))
+	for other := range pairs {
+		others = append(others, other)
+	}
+	sort.Slice(others, func(i, j int) bool {
+		if pairs[others[i]] != pairs[others[j]] {
+			return pairs[others[i]] > pairs[others[j]]
+		}
+		return others[i] < others[j]
+	})
+	for _, other := range others[MaxPairs:] {
+		delete(pairs, other)
+	}
+}
+
+// pruneSessions удаляет сессии, неактивные дольше SessionTTL. Вызывается под блокировкой.
+func (r *Related) pruneSessions(now time.Time) {
+	for id, s := range r.sessions {
+		if now.Sub(s.lastSeen) > SessionTTL {
+			delete(r.sessions, id)
+		}
+	}
+}
+
+// pruneDeleted забывает связи и активность удаленных продуктов. Вызывается
+// под блокировкой.
+func (r *Related) pruneDeleted() {
+	ids := make([]string, 0, len(r.totals))
+	for id := range r.totals {
+		ids = append(ids, id)
+	}
+	existing := r.storage.ExistingIDs(ids)
+	for _, id := range ids {
+		if existing[id] {
+			continue
+		}
+		for other := range r.pairs[id] {
+			delete(r.pairs[other], id)
+		}
+		delete(r.pairs, id)
+		delete(r.totals, id)
+	}
+}
+
+// Find возвращает до limit продуктов снимка каталога snapshot, связанных
+// с продуктом product, по убыванию оценки. Оцениваются только продукты с
+// совместными действиями и продукты с общими тегами из индекса тегов
+// хранилища; продукты, которых нет в снимке, пропускаются.
+func (r *Related) Find(snapshot *storage.Snapshot, product models.Product, limit int) []models.RelatedProduct {
+	r.mu.RLock()
+	coOccurrence := make(map[string]float64, len(r.pairs[product.ID]))
+	for other, weight := range r.pairs[product.ID] {
+		coOccurrence[other] = weight / math.Sqrt(r.totals[product.ID]*r.totals[other])
+	}
+	r.mu.RUnlock()
+
+	candidates := make(map[string]bool, len(coOccurrence))
+	for id := range coOccurrence {
+		candidates[id] = true
+	}
+	for _, id := range r.storage.TaggedIDs(product.Tags) {
+		candidates[id] = true
+	}
+	delete(candidates, product.ID)
+
+	var related []models.RelatedProduct
+	for id := range candidates {
+		other, err := snapshot.GetByID(id)
+		if err != nil {
+			continue
+		}
+
+		scores := models.RelatedScores{
+			CoOccurrence: round(math.Min(coOccurrence[other.ID], 1)),
+			Tags:         round(tagOverlap(product.Tags, other.Tags)),
+		}
+		if scores.CoOccurrence == 0 && scores.Tags == 0 {
+			continue
+		}
+
+		score := CoOccurrenceWeight*scores.CoOccurrence + (1-CoOccurrenceWeight)*scores.Tags
+		related = append(related, models.RelatedProduct{Product: other, Score: round(score), Scores: scores})
+	}
+
+	sort.Slice(related, func(i, j int) bool {
+		if related[i].Score != related[j].Score {
+			return related[i].Score > related[j].Score
+		}
+		return related[i].Product.ID < related[j].Product.ID
+	})
+	if limit > len(related) {
+		limit = len(related)
+	}
+	return related[:limit]
+}
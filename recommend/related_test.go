@@ -0,0 +1,85 @@
+package recommend
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Afra1m/product_api/models"
+)
+
+// TestRelatedFind проверяет, что связанными считаются продукты с
+// совместными действиями и с общими тегами, а остальные не возвращаются
+func TestRelatedFind(t *testing.T) {
+	s := newTestStorage(t, 10)
+	for i, tags := range map[int][]string{0: {"a", "b"}, 1: {"b"}, 2: {"c"}} {
+		product, err := s.GetByID(fmt.Sprintf("p%06d", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		product.Tags = tags
+		if err := s.Update(product.ID, product); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	related := NewRelated(s)
+	now := time.Now()
+	for _, id := range []string{"p000000", "p000003"} {
+		related.Record(models.ActivityEvent{Type: models.ActivityPurchase, ProductID: id, SessionID: "session", Timestamp: now})
+	}
+
+	product, _ := s.GetByID("p000000")
+	found := related.Find(s.Snapshot(), product, 10)
+	if len(found) != 2 {
+		t.Fatalf("найдено %d связанных продуктов, ожидалось 2: %v", len(found), found)
+	}
+	if found[0].Product.ID != "p000003" || found[0].Scores.CoOccurrence != 1 {
+		t.Fatalf("первым найден %s с оценками %+v", found[0].Product.ID, found[0].Scores)
+	}
+	if found[1].Product.ID != "p000001" || found[1].Scores.Tags != 0.5 {
+		t.Fatalf("вторым найден %s с оценками %+v", found[1].Product.ID, found[1].Scores)
+	}
+}
+
+// TestRelatedPairsBounded проверяет, что связи продукта ограничены MaxPairs
+// самыми сильными, а связи удаленных продуктов забываются
+func TestRelatedPairsBounded(t *testing.T) {
+	const products = 3*MaxPairs + 1
+	s := newTestStorage(t, products)
+	related := NewRelated(s)
+	now := time.Now()
+
+	// p000000 покупают вместе с продуктами в отдельных сессиях: первые
+	// MaxPairs продуктов покупают, остальные только смотрят
+	for i := 1; i < products; i++ {
+		eventType := models.ActivityView
+		if i <= MaxPairs {
+			eventType = models.ActivityPurchase
+		}
+		session := fmt.Sprintf("s%d", i)
+		related.Record(models.ActivityEvent{Type: models.ActivityPurchase, ProductID: "p000000", SessionID: session, Timestamp: now})
+		related.Record(models.ActivityEvent{Type: eventType, ProductID: fmt.Sprintf("p%06d", i), SessionID: session, Timestamp: now})
+	}
+
+	related.mu.RLock()
+	pairs := len(related.pairs["p000000"])
+	_, strongest := related.pairs["p000000"]["p000001"]
+	related.mu.RUnlock()
+	if pairs > 2*MaxPairs || !strongest {
+		t.Fatalf("у продукта %d связей, связь с самым сильным продуктом сохранена: %v", pairs, strongest)
+	}
+
+	if err := s.Delete("p000001"); err != nil {
+		t.Fatal(err)
+	}
+	related.mu.Lock()
+	related.pruneDeleted()
+	_, pair := related.pairs["p000000"]["p000001"]
+	_, own := related.pairs["p000001"]
+	_, total := related.totals["p000001"]
+	related.mu.Unlock()
+	if pair || own || total {
+		t.Fatal("связи удаленного продукта не забыты")
+	}
+}
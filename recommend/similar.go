@@ -0,0 +1,270 @@
+package recommend
+
+import (
+	"errors"
+	"math"
+	"slices"
+	"sort"
+	"sync"
+
+	"github.com/Afra1m/product_api/models"
+	"github.com/Afra1m/product_api/storage"
+)
+
+// MaxNeighbors ограничивает число соседей, хранимых в кэше для продукта
+const MaxNeighbors = 100
+
+// Weights задает вклад составляющих в итоговую оценку сходства
+type Weights struct {
+	Category    float64
+	Tags        float64
+	Price       float64
+	Description float64
+}
+
+// DefaultWeights содержит веса составляющих сходства по умолчанию
+var DefaultWeights = Weights{Category: 0.3, Tags: 0.25, Price: 0.15, Description: 0.3}
+
+// neighborsKey определяет запись кэша соседей
+type neighborsKey struct {
+	productID string
+	inStock   bool
+}
+
+// Similar находит похожие продукты по категории, общим тегам, близости цены
+// и TF-IDF сходству описаний. Списки соседей кэшируются для каждого продукта;
+// при изменении полей, от которых зависит сходство, кэш и TF-IDF векторы
+// перестраиваются, так как изменение одного продукта меняет веса слов и
+// оценки для всех остальных. Сохранение счетчиков и изменение других полей
+// кэш не сбрасывает.
+type Similar struct {
+	weights Weights
+
+	index    *similarIndex
+	building chan struct{}
+	mu       sync.Mutex
+}
+
+// similarIndex содержит продукты и TF-IDF векторы каталога и кэш соседей по
+// ним. version является версией содержимого каталога (см.
+// storage.Snapshot.ContentVersion), по которой индекс актуален, и меняется
+// под блокировкой Similar. Продукты и векторы после построения не меняются,
+// поэтому читаются без блокировки; mu защищает только кэш соседей.
+type similarIndex struct {
+	version   uint64
+	products  map[string]models.Product
+	vectors   map[string]vector
+	neighbors map[neighborsKey][]models.SimilarProduct
+	mu        sync.Mutex
+}
+
+// NewSimilar создает поиск похожих продуктов с весами DefaultWeights
+func NewSimilar() *Similar {
+	return &Similar{weights: DefaultWeights}
+}
+
+// Find возвращает до limit продуктов, наиболее похожих на продукт id, по
+// убыванию оценки. Оценки строятся по снимку каталога snapshot или по более
+// новой версии каталога, если индекс уже построен по ней, а продукты
+// возвращаются из снимка. Продукты с нулевой оценкой не возвращаются; при
+// inStock продукты без запаса исключаются.
+func (s *Similar) Find(snapshot *storage.Snapshot, id string, limit int, inStock bool) ([]models.SimilarProduct, error) {
+	index := s.indexFor(snapshot)
+
+	product, exists := index.products[id]
+	if !exists {
+		return nil, errors.New("продукт не найден")
+	}
+
+	key := neighborsKey{productID: id, inStock: inStock}
+	index.mu.Lock()
+	neighbors, cached := index.neighbors[key]
+	index.mu.Unlock()
+	if !cached {
+		neighbors = s.rank(index, product, inStock)
+		index.mu.Lock()
+		index.neighbors[key] = neighbors
+		index.mu.Unlock()
+	}
+
+	similar := make([]models.SimilarProduct, 0, min(limit, len(neighbors)))
+	for _, neighbor := range neighbors {
+		if len(similar) == limit {
+			break
+		}
+		// Поля вне оценки, например счетчики, берутся из снимка. Продукта
+		// может не быть в снимке старше индекса.
+		current, err := snapshot.GetByID(neighbor.Product.ID)
+		if err != nil {
+			continue
+		}
+		neighbor.Product = current
+		similar = append(similar, neighbor)
+	}
+	return similar, nil
+}
+
+// indexFor возвращает индекс, построенный по версии содержимого каталога не
+// старше снимка. Снимок старше построенного индекса не вызывает перестроения.
+// Индекс строится вне блокировки и не больше чем одним запросом за раз:
+// остальные запросы ждут окончания построения и проверяют индекс заново.
+func (s *Similar) indexFor(snapshot *storage.Snapshot) *similarIndex {
+	version := snapshot.ContentVersion()
+	for {
+		s.mu.Lock()
+		if index := s.index; index != nil && index.version >= version {
+			s.mu.Unlock()
+			return index
+		}
+		if building := s.building; building != nil {
+			s.mu.Unlock()
+			<-building
+			continue
+		}
+		s.building = make(chan struct{})
+		previous := s.index
+		s.mu.Unlock()
+
+		return s.build(snapshot, previous)
+	}
+}
+
+// build строит индекс по снимку и публикует его, снимая отметку о
+// построении, даже если построение прервалось паникой. Если поля, от которых
+// зависит сходство, не изменились с индекса previous, он остается в силе
+// для версии снимка.
+func (s *Similar) build(snapshot *storage.Snapshot, previous *similarIndex) *similarIndex {
+	var index *similarIndex
+	defer func() {
+		s.mu.Lock()
+		if index != nil {
+			index.version = snapshot.ContentVersion()
+			s.index = index
+		}
+		close(s.building)
+		s.building = nil
+		s.mu.Unlock()
+	}()
+
+	products := snapshot.GetAll()
+	if previous != nil && !changedSimilarity(previous.products, products) {
+		index = previous
+		return index
+	}
+
+	built := &similarIndex{
+		products:  make(map[string]models.Product, len(products)),
+		neighbors: make(map[neighborsKey][]models.SimilarProduct),
+	}
+	documents := make(map[string]string, len(products))
+	for _, product := range products {
+		built.products[product.ID] = product
+		documents[product.ID] = product.Name + " " + product.Description
+	}
+	built.vectors = buildVectors(documents)
+	index = built
+	return index
+}
+
+// changedSimilarity сообщает, отличаются ли products от проиндексированных
+// продуктов indexed набором продуктов или полями, от которых зависит
+// сходство: названием, описанием, тегами, категорией, ценой и запасом
+func changedSimilarity(indexed map[string]models.Product, products []models.Product) bool {
+	if len(indexed) != len(products) {
+		return true
+	}
+	for _, product := range products {
+		old, exists := indexed[product.ID]
+		if !exists ||
+			old.Name != product.Name ||
+			old.Description != product.Description ||
+			old.Category != product.Category ||
+			old.Price != product.Price ||
+			old.Stock != product.Stock ||
+			!slices.Equal(old.Tags, product.Tags) {
+			return true
+		}
+	}
+	return false
+}
+
+// rank оценивает сходство продукта со всеми остальными и возвращает лучших
+func (s *Similar) rank(index *similarIndex, product models.Product, inStock bool) []models.SimilarProduct {
+	var ranked []models.SimilarProduct
+	for id, other := range index.products {
+		if id == product.ID || (inStock && other.Stock <= 0) {
+			continue
+		}
+
+		scores := models.SimilarityScores{
+			Tags:        round(tagOverlap(product.Tags, other.Tags)),
+			Price:       round(priceProximity(product.Price, other.Price)),
+			Description: round(cosine(index.vectors[product.ID], index.vectors[id])),
+		}
+		if product.Category != "" && product.Category == other.Category {
+			scores.Category = 1
+		}
+
+		// Одна близость цены не делает продукты похожими
+		if scores.Category == 0 && scores.Tags == 0 && scores.Description == 0 {
+			continue
+		}
+		score := s.weights.Category*scores.Category +
+			s.weights.Tags*scores.Tags +
+			s.weights.Price*scores.Price +
+			s.weights.Description*scores.Description
+
+		ranked = append(ranked, models.SimilarProduct{Product: other, Score: round(score), Scores: scores})
+	}
+
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].Score != ranked[j].Score {
+			return ranked[i].Score > ranked[j].Score
+		}
+		return ranked[i].Product.ID < ranked[j].Product.ID
+	})
+	if len(ranked) > MaxNeighbors {
+		ranked = ranked[:MaxNeighbors]
+	}
+	return ranked
+}
+
+// tagOverlap возвращает коэффициент Жаккара множеств тегов
+func tagOverlap(a, b []string) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+
+	set := make(map[string]bool, len(a))
+	for _, tag := range a {
+		set[tag] = true
+	}
+	shared := 0
+	union := len(set)
+	seen := make(map[string]bool, len(b))
+	for _, tag := range b {
+		if seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		if set[tag] {
+			shared++
+		} else {
+			union++
+		}
+	}
+	return float64(shared) / float64(union)
+}
+
+// priceProximity возвращает 1 для равных цен и стремится к 0 по мере их расхождения
+func priceProximity(a, b float64) float64 {
+	max := math.Max(a, b)
+	if max <= 0 {
+		return 0
+	}
+	return 1 - math.Abs(a-b)/max
+}
+
+func round(value float64) float64 {
+	return math.Round(value*1000) / 1000
+}
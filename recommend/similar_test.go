@@ -0,0 +1,75 @@
+package recommend
+
+import (
+	"testing"
+)
+
+// TestSimilarIndexIgnoresCounters проверяет, что сохранение счетчиков и
+// изменение полей вне оценки не перестраивают индекс похожих продуктов, а
+// продукты в ответе берутся из текущего снимка. Изменение описания
+// перестраивает индекс.
+func TestSimilarIndexIgnoresCounters(t *testing.T) {
+	s := newTestStorage(t, 50)
+	similar := NewSimilar()
+	if _, err := similar.Find(s.Snapshot(), "p000001", 5, false); err != nil {
+		t.Fatal(err)
+	}
+	built := similar.index
+
+	if err := s.IncrementCounters("p000011", 3, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.FlushCounters(); err != nil {
+		t.Fatal(err)
+	}
+	snapshot := s.Snapshot()
+	if snapshot.ContentVersion() == snapshot.Version() {
+		t.Fatal("сохранение счетчиков изменило версию содержимого каталога")
+	}
+
+	product, err := s.GetByID("p000021")
+	if err != nil {
+		t.Fatal(err)
+	}
+	product.SKU = "SKU-CHANGED"
+	if err := s.Update(product.ID, product); err != nil {
+		t.Fatal(err)
+	}
+
+	found, err := similar.Find(s.Snapshot(), "p000001", 5, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if similar.index != built {
+		t.Fatal("индекс перестроен после изменения полей вне оценки")
+	}
+	checked := 0
+	for _, neighbor := range found {
+		switch neighbor.Product.ID {
+		case "p000011":
+			checked++
+			if neighbor.Product.Views != 3 {
+				t.Fatalf("продукт %s возвращен с %d просмотрами", neighbor.Product.ID, neighbor.Product.Views)
+			}
+		case "p000021":
+			checked++
+			if neighbor.Product.SKU != "SKU-CHANGED" {
+				t.Fatalf("продукт %s возвращен с SKU %q", neighbor.Product.ID, neighbor.Product.SKU)
+			}
+		}
+	}
+	if checked != 2 {
+		t.Fatalf("среди похожих нет измененных продуктов той же категории: %v", found)
+	}
+
+	product.Description = "новое описание"
+	if err := s.Update(product.ID, product); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := similar.Find(s.Snapshot(), "p000001", 5, false); err != nil {
+		t.Fatal(err)
+	}
+	if similar.index == built {
+		t.Fatal("индекс не перестроен после изменения описания")
+	}
+}
@@ -0,0 +1,81 @@
+package recommend
+
+import (
+	"math"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// stopWords содержит частые слова, не влияющие на сходство описаний
+var stopWords = map[string]bool{
+	"и": true, "в": true, "во": true, "на": true, "с": true, "со": true, "для": true, "по": true,
+	"из": true, "от": true, "до": true, "не": true, "это": true, "как": true, "а": true, "или": true,
+	"the": true, "and": true, "for": true, "with": true, "of": true, "to": true, "in": true, "on": true,
+	"a": true, "an": true, "is": true, "or": true,
+}
+
+// tokenize разбивает текст на слова в нижнем регистре без стоп-слов и
+// однобуквенных слов
+func tokenize(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	tokens := words[:0]
+	for _, word := range words {
+		if utf8.RuneCountInString(word) > 1 && !stopWords[word] {
+			tokens = append(tokens, word)
+		}
+	}
+	return tokens
+}
+
+// vector представляет нормализованный TF-IDF вектор документа
+type vector map[string]float64
+
+// buildVectors строит TF-IDF векторы документов единичной длины
+func buildVectors(documents map[string]string) map[string]vector {
+	terms := make(map[string]map[string]int, len(documents))
+	documentFrequency := make(map[string]int)
+	for id, text := range documents {
+		counts := make(map[string]int)
+		for _, token := range tokenize(text) {
+			counts[token]++
+		}
+		for term := range counts {
+			documentFrequency[term]++
+		}
+		terms[id] = counts
+	}
+
+	total := float64(len(documents))
+	vectors := make(map[string]vector, len(documents))
+	for id, counts := range terms {
+		v := make(vector, len(counts))
+		norm := 0.0
+		for term, count := range counts {
+			weight := float64(count) * math.Log(1+total/float64(documentFrequency[term]))
+			v[term] = weight
+			norm += weight * weight
+		}
+		norm = math.Sqrt(norm)
+		for term := range v {
+			v[term] /= norm
+		}
+		vectors[id] = v
+	}
+	return vectors
+}
+
+// cosine возвращает косинусное сходство векторов единичной длины
+func cosine(a, b vector) float64 {
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+	sum := 0.0
+	for term, weight := range a {
+		sum += weight * b[term]
+	}
+	return sum
+}
@@ -0,0 +1,250 @@
+package recommend
+
+import (
+	"container/heap"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/Afra1m/product_api/models"
+	"github.com/Afra1m/product_api/skiplist"
+	"github.com/Afra1m/product_api/storage"
+)
+
+// Параметры трендов по умолчанию
+const (
+	// DefaultHalfLife задает время, за которое вклад события уменьшается вдвое
+	DefaultHalfLife = 24 * time.Hour
+	// BucketSize задает ширину интервала, в котором события суммируются
+	BucketSize = time.Hour
+	// Retention задает срок хранения интервалов; вклад более старых событий пренебрежимо мал
+	Retention = 30 * 24 * time.Hour
+)
+
+// Вклад события в оценку трендов
+var trendingWeights = map[string]float64{
+	models.ActivityView:      1,
+	models.ActivityAddToCart: 3,
+	models.ActivityPurchase:  5,
+}
+
+// Trending считает события продуктов по часовым интервалам и оценивает
+// популярность с экспоненциальным затуханием: вклад интервала уменьшается
+// вдвое за каждый период полураспада, считая от середины интервала. В
+// отличие от общей популярности оценка отражает недавний интерес к продукту.
+//
+// Для периода HalfLife оценка каждого продукта ведется нарастающим итогом,
+// приведенным к моменту reference: при затухании оценки всех продуктов
+// умножаются на один и тот же множитель, поэтому их порядок не зависит от
+// момента запроса. Продукты упорядочены по этой оценке в списке с
+// пропусками, и первые k продуктов выбираются за O(k log n). Для другого
+// периода полураспада оценки считаются заново по всем интервалам.
+type Trending struct {
+	storage *storage.ProductStorage
+	// HalfLife задает период полураспада по умолчанию. Задается при
+	// создании: по нему ведутся оценки продуктов.
+	HalfLife time.Duration
+
+	buckets   map[string]map[int64]float64
+	scores    map[string]float64
+	ranked    *skiplist.List[float64]
+	reference time.Time
+	events    int
+	mu        sync.RWMutex
+}
+
+// maxReferenceAge задает, на сколько периодов полураспада события могут
+// опережать reference, прежде чем оценки будут приведены к новому моменту:
+// вклад события растет как 2^возраст, и без приведения оценки переполнились бы
+const maxReferenceAge = 64
+
+// NewTrending создает оценку трендов с периодом полураспада halfLife
+func NewTrending(storage *storage.ProductStorage, halfLife time.Duration) *Trending {
+	return &Trending{
+		storage:   storage,
+		HalfLife:  halfLife,
+		buckets:   make(map[string]map[int64]float64),
+		scores:    make(map[string]float64),
+		ranked:    skiplist.New[float64](),
+		reference: time.Now().Truncate(BucketSize),
+	}
+}
+
+// Record учитывает событие в интервале его времени. Старые интервалы
+// удаляются по часам сервера, а не по времени события, которое задает клиент.
+func (t *Trending) Record(event models.ActivityEvent) {
+	bucket := event.Timestamp.Truncate(BucketSize).Unix()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.events++
+	if t.events%1000 == 0 {
+		t.prune(time.Now())
+	}
+	if event.Timestamp.Sub(t.reference) > maxReferenceAge*t.HalfLife {
+		t.rebase(event.Timestamp.Truncate(BucketSize))
+	}
+
+	if t.buckets[event.ProductID] == nil {
+		t.buckets[event.ProductID] = make(map[int64]float64)
+	}
+	weight := trendingWeights[event.Type]
+	t.buckets[event.ProductID][bucket] += weight
+	t.setScore(event.ProductID, t.scores[event.ProductID]+weight*t.growth(bucket))
+}
+
+// prune удаляет интервалы старше Retention вместе с их вкладом в оценки.
+// Вызывается под блокировкой.
+func (t *Trending) prune(now time.Time) {
+	oldest := now.Add(-Retention).Unix()
+	for productID, buckets := range t.buckets {
+		score, pruned := t.scores[productID], false
+		for bucket, weight := range buckets {
+			if bucket < oldest {
+				delete(buckets, bucket)
+				score -= weight * t.growth(bucket)
+				pruned = true
+			}
+		}
+		switch {
+		case len(buckets) == 0:
+			delete(t.buckets, productID)
+			t.ranked.Remove(-t.scores[productID], productID)
+			delete(t.scores, productID)
+		case pruned:
+			t.setScore(productID, score)
+		}
+	}
+}
+
+// growth возвращает вклад единичного веса интервала bucket в оценку,
+// приведенную к reference. Вызывается под блокировкой.
+func (t *Trending) growth(bucket int64) float64 {
+	middle := time.Unix(bucket, 0).Add(BucketSize / 2)
+	return math.Exp2(float64(middle.Sub(t.reference)) / float64(t.HalfLife))
+}
+
+// setScore заменяет оценку продукта. В списке хранится оценка со знаком
+// минус, чтобы при равных оценках продукты шли по возрастанию ID.
+// Вызывается под блокировкой.
+func (t *Trending) setScore(productID string, score float64) {
+	if old, exists := t.scores[productID]; exists {
+		t.ranked.Remove(-old, productID)
+	}
+	t.scores[productID] = score
+	t.ranked.Insert(-score, productID)
+}
+
+// rebase приводит оценки к новому моменту reference. Порядок продуктов не
+// меняется, но список перестраивается, так как меняются его ключи.
+// Вызывается под блокировкой.
+func (t *Trending) rebase(reference time.Time) {
+	factor := math.Exp2(float64(t.reference.Sub(reference)) / float64(t.HalfLife))
+	t.reference = reference
+	t.ranked = skiplist.New[float64]()
+	for productID, score := range t.scores {
+		t.scores[productID] = score * factor
+		t.ranked.Insert(-t.scores[productID], productID)
+	}
+}
+
+// Top возвращает до limit продуктов с наибольшей оценкой на момент now.
+// Если halfLife не положителен, используется HalfLife.
+func (t *Trending) Top(now time.Time, halfLife time.Duration, limit int) []models.TrendingProduct {
+	if halfLife <= 0 {
+		halfLife = t.HalfLife
+	}
+	if limit <= 0 {
+		return []models.TrendingProduct{}
+	}
+	if halfLife != t.HalfLife {
+		return t.scan(now, halfLife, limit)
+	}
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	decay := math.Exp2(float64(t.reference.Sub(now)) / float64(halfLife))
+	trending := []models.TrendingProduct{}
+	t.ranked.Ascend(func(productID string) bool {
+		// Удаленные продукты пропускаются
+		product, err := t.storage.GetByID(productID)
+		if err == nil {
+			trending = append(trending, models.TrendingProduct{
+				Product: product,
+				Score:   round(t.scores[productID] * decay),
+			})
+		}
+		return len(trending) < limit
+	})
+	return trending
+}
+
+// scan выбирает продукты для периода полураспада, отличного от HalfLife:
+// оценки всех продуктов считаются по их интервалам, а limit лучших
+// отбираются кучей размера limit за O(n log k)
+func (t *Trending) scan(now time.Time, halfLife time.Duration, limit int) []models.TrendingProduct {
+	scores := make(map[string]float64)
+	t.mu.RLock()
+	for productID, buckets := range t.buckets {
+		score := 0.0
+		for bucket, weight := range buckets {
+			age := now.Sub(time.Unix(bucket, 0).Add(BucketSize / 2))
+			score += weight * math.Exp2(-float64(age)/float64(halfLife))
+		}
+		scores[productID] = score
+	}
+	t.mu.RUnlock()
+
+	top := make(trendingHeap, 0, limit)
+	for productID, score := range scores {
+		candidate := models.TrendingProduct{Product: models.Product{ID: productID}, Score: round(score)}
+		if len(top) == limit && !top.better(candidate, top[0]) {
+			continue
+		}
+		product, err := t.storage.GetByID(productID)
+		if err != nil {
+			continue
+		}
+		candidate.Product = product
+		if len(top) < limit {
+			heap.Push(&top, candidate)
+		} else {
+			top[0] = candidate
+			heap.Fix(&top, 0)
+		}
+	}
+
+	trending := make([]models.TrendingProduct, len(top))
+	for i := len(top) - 1; i >= 0; i-- {
+		trending[i] = heap.Pop(&top).(models.TrendingProduct)
+	}
+	return trending
+}
+
+// trendingHeap является кучей с наименее трендовым продуктом в вершине
+type trendingHeap []models.TrendingProduct
+
+// better сообщает, что a должен стоять в выдаче выше b
+func (h trendingHeap) better(a, b models.TrendingProduct) bool {
+	if a.Score != b.Score {
+		return a.Score > b.Score
+	}
+	return a.Product.ID < b.Product.ID
+}
+
+func (h trendingHeap) Len() int           { return len(h) }
+func (h trendingHeap) Less(i, j int) bool { return h.better(h[j], h[i]) }
+func (h trendingHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *trendingHeap) Push(x any) {
+	*h = append(*h, x.(models.TrendingProduct))
+}
+
+func (h *trendingHeap) Pop() any {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
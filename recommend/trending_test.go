@@ -0,0 +1,142 @@
+package recommend
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/Afra1m/product_api/models"
+	"github.com/Afra1m/product_api/storage"
+)
+
+// newTestStorage создает хранилище с n продуктами
+func newTestStorage(tb testing.TB, n int) *storage.ProductStorage {
+	tb.Helper()
+	s := storage.NewProductStorage()
+	products := make([]models.Product, n)
+	for i := range products {
+		products[i] = models.Product{
+			ID:       fmt.Sprintf("p%06d", i),
+			Name:     fmt.Sprintf("Product %d", i),
+			Price:    float64(i%1000) + 1,
+			Category: fmt.Sprintf("c%d", i%10),
+			Stock:    i % 50,
+			SKU:      fmt.Sprintf("SKU-%06d", i),
+		}
+	}
+	if err := s.CreateBatch(products); err != nil {
+		tb.Fatal(err)
+	}
+	return s
+}
+
+// recordRandom записывает events случайных событий за последние две недели
+// по n продуктам
+func recordRandom(t *Trending, n, events int, now time.Time) {
+	rnd := rand.New(rand.NewSource(1))
+	types := []string{models.ActivityView, models.ActivityAddToCart, models.ActivityPurchase}
+	for i := 0; i < events; i++ {
+		t.Record(models.ActivityEvent{
+			Type:      types[rnd.Intn(len(types))],
+			ProductID: fmt.Sprintf("p%06d", rnd.Intn(n)),
+			SessionID: "session",
+			Timestamp: now.Add(-time.Duration(rnd.Int63n(int64(14 * 24 * time.Hour)))),
+		})
+	}
+}
+
+// closeScores сравнивает оценки с учетом округления и погрешности приведения
+func closeScores(a, b float64) bool {
+	return math.Abs(a-b) <= 1e-6*math.Max(1, math.Abs(b))
+}
+
+// TestTrendingTopMatchesScan проверяет, что выборка по индексу нарастающих
+// оценок совпадает с пересчетом оценок по интервалам, в том числе после
+// приведения оценок к новому моменту
+func TestTrendingTopMatchesScan(t *testing.T) {
+	const products = 500
+	s := newTestStorage(t, products)
+	now := time.Now()
+	trending := NewTrending(s, 6*time.Hour)
+	recordRandom(trending, products, 5000, now)
+
+	check := func(step string, now time.Time) {
+		t.Helper()
+		for _, limit := range []int{1, 20, products} {
+			indexed := trending.Top(now, 0, limit)
+			scanned := trending.scan(now, trending.HalfLife, limit)
+			if len(indexed) != len(scanned) {
+				t.Fatalf("%s, limit %d: по индексу %d продуктов, пересчетом %d", step, limit, len(indexed), len(scanned))
+			}
+			for i := range indexed {
+				if !closeScores(indexed[i].Score, scanned[i].Score) {
+					t.Fatalf("%s, limit %d, позиция %d: по индексу %s (%v), пересчетом %s (%v)", step, limit, i,
+						indexed[i].Product.ID, indexed[i].Score, scanned[i].Product.ID, scanned[i].Score)
+				}
+			}
+		}
+	}
+	check("исходные события", now)
+	check("через сутки", now.Add(24*time.Hour))
+
+	// Событие далеко в будущем приводит оценки к новому моменту
+	trending.Record(models.ActivityEvent{
+		Type:      models.ActivityPurchase,
+		ProductID: "p000001",
+		SessionID: "session",
+		Timestamp: now.Add(maxReferenceAge * trending.HalfLife * 2),
+	})
+	check("после приведения", now)
+}
+
+// TestTrendingPrune проверяет, что удаленные интервалы вычитаются из оценок,
+// а продукты без интервалов покидают индекс
+func TestTrendingPrune(t *testing.T) {
+	s := newTestStorage(t, 2)
+	now := time.Now()
+	trending := NewTrending(s, DefaultHalfLife)
+	record := func(productID string, at time.Time) {
+		trending.Record(models.ActivityEvent{Type: models.ActivityView, ProductID: productID, SessionID: "session", Timestamp: at})
+	}
+	record("p000000", now.Add(-Retention-2*BucketSize))
+	record("p000001", now.Add(-Retention-2*BucketSize))
+	record("p000001", now)
+
+	trending.mu.Lock()
+	trending.prune(now)
+	trending.mu.Unlock()
+
+	top := trending.Top(now, 0, 10)
+	if len(top) != 1 || top[0].Product.ID != "p000001" {
+		t.Fatalf("после удаления старых интервалов в трендах %v", top)
+	}
+	if want := trending.scan(now, trending.HalfLife, 10); !closeScores(top[0].Score, want[0].Score) {
+		t.Fatalf("оценка %v после удаления интервала, пересчетом %v", top[0].Score, want[0].Score)
+	}
+	if trending.ranked.Len() != 1 || len(trending.scores) != 1 {
+		t.Fatalf("в индексе %d продуктов, оценок %d", trending.ranked.Len(), len(trending.scores))
+	}
+}
+
+// BenchmarkTrendingTop сравнивает выборку трендов по индексу нарастающих
+// оценок с пересчетом оценок по интервалам на 100000 продуктах
+func BenchmarkTrendingTop(b *testing.B) {
+	const products = 100000
+	s := newTestStorage(b, products)
+	now := time.Now()
+	trending := NewTrending(s, DefaultHalfLife)
+	recordRandom(trending, products, 200000, now)
+
+	b.Run("index", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			trending.Top(now, 0, 20)
+		}
+	})
+	b.Run("scan", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			trending.Top(now, time.Hour, 20)
+		}
+	})
+}
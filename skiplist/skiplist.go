@@ -0,0 +1,158 @@
+// Package skiplist реализует упорядоченный список с пропусками, которым
+// хранилище и рекомендации индексируют продукты по числовому ключу.
+package skiplist
+
+import (
+	"cmp"
+	"math/rand"
+)
+
+const (
+	maxLevel = 24
+	p        = 0.25
+)
+
+// List хранит ID, упорядоченные по ключу, в виде списка с пропусками:
+// вставка и удаление занимают O(log n), а обход первых или последних k
+// записей — O(k). Записи с равными ключами упорядочены по ID. Список не
+// синхронизирован и изменяется под блокировкой владельца.
+type List[K cmp.Ordered] struct {
+	head   *node[K]
+	tail   *node[K]
+	level  int
+	length int
+	random *rand.Rand
+}
+
+type node[K cmp.Ordered] struct {
+	key  K
+	id   string
+	next []*node[K]
+	prev *node[K]
+}
+
+// New создает пустой список
+func New[K cmp.Ordered]() *List[K] {
+	return &List[K]{
+		head:   &node[K]{next: make([]*node[K], maxLevel)},
+		level:  1,
+		random: rand.New(rand.NewSource(1)),
+	}
+}
+
+// Len возвращает число записей списка
+func (x *List[K]) Len() int {
+	return x.length
+}
+
+func (n *node[K]) before(key K, id string) bool {
+	if c := cmp.Compare(n.key, key); c != 0 {
+		return c < 0
+	}
+	return n.id < id
+}
+
+// search заполняет update последними узлами каждого уровня, стоящими перед (key, id)
+func (x *List[K]) search(key K, id string, update []*node[K]) {
+	node := x.head
+	for level := x.level - 1; level >= 0; level-- {
+		for node.next[level] != nil && node.next[level].before(key, id) {
+			node = node.next[level]
+		}
+		update[level] = node
+	}
+}
+
+// Insert добавляет запись
+func (x *List[K]) Insert(key K, id string) {
+	update := make([]*node[K], maxLevel)
+	x.search(key, id, update)
+
+	level := 1
+	for level < maxLevel && x.random.Float64() < p {
+		level++
+	}
+	for ; x.level < level; x.level++ {
+		update[x.level] = x.head
+	}
+
+	node := &node[K]{key: key, id: id, next: make([]*node[K], level)}
+	for i := 0; i < level; i++ {
+		node.next[i] = update[i].next[i]
+		update[i].next[i] = node
+	}
+	if update[0] != x.head {
+		node.prev = update[0]
+	}
+	if node.next[0] != nil {
+		node.next[0].prev = node
+	} else {
+		x.tail = node
+	}
+	x.length++
+}
+
+// Remove удаляет запись и сообщает, была ли она в списке
+func (x *List[K]) Remove(key K, id string) bool {
+	update := make([]*node[K], maxLevel)
+	x.search(key, id, update)
+
+	node := update[0].next[0]
+	if node == nil || node.key != key || node.id != id {
+		return false
+	}
+
+	for i := 0; i < len(node.next); i++ {
+		update[i].next[i] = node.next[i]
+	}
+	if node.next[0] != nil {
+		node.next[0].prev = node.prev
+	} else {
+		x.tail = node.prev
+	}
+	for x.level > 1 && x.head.next[x.level-1] == nil {
+		x.level--
+	}
+	x.length--
+	return true
+}
+
+// Ascend обходит ID по возрастанию ключа, пока fn возвращает true
+func (x *List[K]) Ascend(fn func(id string) bool) {
+	for node := x.head.next[0]; node != nil; node = node.next[0] {
+		if !fn(node.id) {
+			return
+		}
+	}
+}
+
+// AscendRange обходит по возрастанию ключа ID записей с ключами от from до
+// to включительно, пока fn возвращает true. Незаданная граница не ограничивает
+// обход; начало диапазона находится за O(log n).
+func (x *List[K]) AscendRange(from, to *K, fn func(id string) bool) {
+	node := x.head
+	if from != nil {
+		for level := x.level - 1; level >= 0; level-- {
+			for node.next[level] != nil && node.next[level].key < *from {
+				node = node.next[level]
+			}
+		}
+	}
+	for node = node.next[0]; node != nil; node = node.next[0] {
+		if to != nil && node.key > *to {
+			return
+		}
+		if !fn(node.id) {
+			return
+		}
+	}
+}
+
+// Descend обходит ID по убыванию ключа, пока fn возвращает true
+func (x *List[K]) Descend(fn func(id string) bool) {
+	for node := x.tail; node != nil; node = node.prev {
+		if !fn(node.id) {
+			return
+		}
+	}
+}
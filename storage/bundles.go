@@ -0,0 +1,203 @@
+package storage
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/Afra1m/product_api/models"
+)
+
+// Набор хранится как продукт со списком компонентов. Его остаток всегда
+// равен числу наборов, которое можно собрать из остатков компонентов, а
+// продажа набора списывает компоненты одной записью под блокировкой всех
+// затронутых продуктов.
+
+// Ошибки наборов и изменения остатков
+var (
+	ErrNotBundle         = errors.New("продукт не является набором")
+	ErrInvalidComponent  = errors.New("компонентом набора может быть только обычный продукт или вариант")
+	ErrComponentInUse    = errors.New("продукт входит в набор")
+	ErrInsufficientStock = errors.New("недостаточно товара на складе")
+)
+
+// GetBundle возвращает набор вместе с компонентами и их наличием
+func (s *ProductStorage) GetBundle(id string) (models.BundleDetails, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	product, exists := s.get(id)
+	if !exists {
+		return models.BundleDetails{}, errors.New("продукт не найден")
+	}
+	if !product.IsBundle() {
+		return models.BundleDetails{}, ErrNotBundle
+	}
+
+	details := models.BundleDetails{
+		Bundle:     product.Clone(),
+		Components: make([]models.BundleComponentAvailability, 0, len(product.Bundle.Components)),
+	}
+	details.Available, details.ComponentsPrice = bundleTotals(*product.Bundle, s.get)
+	for _, component := range product.Bundle.Components {
+		componentProduct, _ := s.get(component.ProductID)
+		details.Components = append(details.Components, models.BundleComponentAvailability{
+			Product:   componentProduct.Clone(),
+			Quantity:  component.Quantity,
+			Available: componentProduct.Stock / component.Quantity,
+		})
+	}
+	return details, nil
+}
+
+// SetBundle задает состав набора. Компоненты должны существовать и не быть
+// наборами или родительскими продуктами; сам набор не может входить в
+// другие наборы или иметь варианты.
+func (s *ProductStorage) SetBundle(id string, bundle *models.Bundle) (models.Product, error) {
+	ids := []string{id}
+	for _, component := range bundle.Components {
+		ids = append(ids, component.ProductID)
+	}
+	defer s.lockWrite(ids...)()
+
+	product, exists := s.get(id)
+	if !exists {
+		return models.Product{}, errors.New("продукт не найден")
+	}
+	if product.IsVariant() || product.IsVariantParent() {
+		return models.Product{}, ErrBundleVariants
+	}
+	if len(s.fields.byComponent[id]) > 0 {
+		return models.Product{}, ErrComponentInUse
+	}
+	for _, component := range bundle.Components {
+		componentProduct, exists := s.get(component.ProductID)
+		if !exists {
+			return models.Product{}, errors.New("компонент " + component.ProductID + " не найден")
+		}
+		if component.ProductID == id || componentProduct.IsBundle() || componentProduct.IsVariantParent() {
+			return models.Product{}, ErrInvalidComponent
+		}
+	}
+
+	product.Bundle = bundle
+	product.UpdatedAt = time.Now()
+	if err := s.commitSave(product); err != nil {
+		return models.Product{}, err
+	}
+	product, _ = s.get(id)
+	return product.Clone(), nil
+}
+
+// AdjustStock изменяет остаток продукта на delta. Для набора изменение
+// применяется к каждому компоненту с учетом количества, поэтому продажа
+// набора списывает все его компоненты; если какого-то компонента не
+// хватает, остатки не меняются.
+func (s *ProductStorage) AdjustStock(id string, delta int) (models.Product, error) {
+	defer s.lockWrite(id)()
+
+	product, exists := s.get(id)
+	if !exists {
+		return models.Product{}, errors.New("продукт не найден")
+	}
+	if err := s.adjustStock(product, delta); err != nil {
+		return models.Product{}, err
+	}
+	product, _ = s.get(id)
+	return product.Clone(), nil
+}
+
+// adjustStock изменяет остаток продукта или компонентов набора на delta.
+// Остатки всех компонентов сохраняются одной транзакцией, поэтому остаток
+// набора пересчитывается один раз, без промежуточных состояний и событий.
+// Вызывается под блокировкой продукта и связанных с ним продуктов.
+func (s *ProductStorage) adjustStock(product models.Product, delta int) error {
+	if product.IsVariantParent() {
+		return ErrVariantParentStock
+	}
+	if !product.IsBundle() {
+		if product.Stock+delta < 0 {
+			return ErrInsufficientStock
+		}
+		return s.setStock(product, product.Stock+delta)
+	}
+
+	components := make([]models.Product, len(product.Bundle.Components))
+	for i, component := range product.Bundle.Components {
+		components[i], _ = s.get(component.ProductID)
+		if components[i].Stock+delta*component.Quantity < 0 {
+			return ErrInsufficientStock
+		}
+	}
+
+	t := s.begin()
+	for i, component := range product.Bundle.Components {
+		t.save(withStock(components[i], components[i].Stock+delta*component.Quantity))
+	}
+	return t.commit()
+}
+
+// setStock записывает новый остаток продукта вместе с записью в истории.
+// Вызывается под блокировкой.
+func (s *ProductStorage) setStock(product models.Product, stock int) error {
+	return s.commitSave(withStock(product, stock))
+}
+
+// withStock возвращает продукт с новым остатком и записью об изменении
+// остатка в истории
+func withStock(product models.Product, stock int) models.Product {
+	oldStock := product.Stock
+	product.Stock = stock
+	product.UpdatedAt = time.Now()
+
+	// Добавляем запись в историю
+	historyEntry := models.ProductHistory{
+		Field:     "stock",
+		OldValue:  oldStock,
+		NewValue:  stock,
+		Timestamp: time.Now(),
+	}
+	product.History = append(product.History, historyEntry)
+	return product
+}
+
+// bundleTotals возвращает число наборов, которое можно собрать из остатков
+// компонентов, и суммарную цену компонентов. Компоненты читаются через get.
+func bundleTotals(bundle models.Bundle, get func(id string) (models.Product, bool)) (int, float64) {
+	available := 0
+	var componentsPrice float64
+	for i, component := range bundle.Components {
+		product, exists := get(component.ProductID)
+		if !exists {
+			return 0, componentsPrice
+		}
+		if count := product.Stock / component.Quantity; i == 0 || count < available {
+			available = count
+		}
+		componentsPrice += product.Price * float64(component.Quantity)
+	}
+	return available, componentsPrice
+}
+
+// checkComponentsUnused проверяет, что ни продукт, ни его варианты не входят
+// в наборы
+func (t *tx) checkComponentsUnused(product models.Product) error {
+	for _, id := range append([]string{product.ID}, t.variantIDs(product.ID)...) {
+		if len(t.bundleIDs(id)) > 0 {
+			return ErrComponentInUse
+		}
+	}
+	return nil
+}
+
+// bundleIDs возвращает упорядоченные ID наборов, в которые входит продукт.
+// Вызывается под блокировкой.
+func (s *ProductStorage) bundleIDs(id string) []string {
+	set := s.fields.byComponent[id]
+	ids := make([]string, 0, len(set))
+	for bundleID := range set {
+		ids = append(ids, bundleID)
+	}
+	sort.Strings(ids)
+	return ids
+}
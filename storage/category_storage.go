@@ -0,0 +1,516 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Afra1m/product_api/models"
+)
+
+// Ошибки дерева категорий
+var (
+	ErrCategoryNotFound = errors.New("категория не найдена")
+	ErrDuplicateSlug    = errors.New("категория с таким slug уже существует")
+	ErrCategoryCycle    = errors.New("категория не может быть вложена в себя или своего потомка")
+	ErrCategoryNotEmpty = errors.New("у категории есть дочерние категории")
+)
+
+// slugPattern допускает буквы и цифры, разделенные дефисами или подчеркиваниями
+var slugPattern = regexp.MustCompile(`^[\p{L}\p{N}]+(?:[-_][\p{L}\p{N}]+)*$`)
+
+// CategoryStorage представляет собой хранилище дерева категорий. Если
+// задан файл, дерево целиком переписывается в него после каждого изменения,
+// а изменение, которое не удалось сохранить, отменяется.
+type CategoryStorage struct {
+	categories map[string]models.Category
+	bySlug     map[string]string
+	path       string
+	mu         sync.RWMutex
+}
+
+// NewCategoryStorage создает новое хранилище категорий в памяти
+func NewCategoryStorage() *CategoryStorage {
+	return &CategoryStorage{
+		categories: make(map[string]models.Category),
+		bySlug:     make(map[string]string),
+	}
+}
+
+// OpenCategoryStorage открывает хранилище категорий, сохраняемое в файл
+// path в формате JSON, и загружает из него дерево, если файл существует
+func OpenCategoryStorage(path string) (*CategoryStorage, error) {
+	s := NewCategoryStorage()
+	s.path = path
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var categories []models.Category
+	if err := json.Unmarshal(data, &categories); err != nil {
+		return nil, errors.New("неверный формат файла категорий: " + err.Error())
+	}
+	for _, category := range categories {
+		s.categories[category.ID] = category
+		s.bySlug[category.Slug] = category.ID
+	}
+	return s, nil
+}
+
+// GetAll возвращает все категории, упорядоченные по родителю и позиции
+func (s *CategoryStorage) GetAll() []models.Category {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.all()
+}
+
+// all возвращает все категории, упорядоченные по родителю и позиции.
+// Вызывается под блокировкой.
+func (s *CategoryStorage) all() []models.Category {
+	categories := make([]models.Category, 0, len(s.categories))
+	for _, category := range s.categories {
+		categories = append(categories, category)
+	}
+	sort.Slice(categories, func(i, j int) bool {
+		if categories[i].ParentID != categories[j].ParentID {
+			return categories[i].ParentID < categories[j].ParentID
+		}
+		return lessCategory(categories[i], categories[j])
+	})
+	return categories
+}
+
+// Tree возвращает дерево категорий, начиная с корневых
+func (s *CategoryStorage) Tree() []models.CategoryNode {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.subtree("")
+}
+
+// subtree строит дерево дочерних категорий parentID. Вызывается под блокировкой.
+func (s *CategoryStorage) subtree(parentID string) []models.CategoryNode {
+	children := s.children(parentID)
+	nodes := make([]models.CategoryNode, len(children))
+	for i, child := range children {
+		nodes[i] = models.CategoryNode{Category: child, Children: s.subtree(child.ID)}
+	}
+	return nodes
+}
+
+// Get возвращает категорию по ID или slug
+func (s *CategoryStorage) Get(ref string) (models.Category, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.get(ref)
+}
+
+// get находит категорию по ID или slug. Вызывается под блокировкой.
+func (s *CategoryStorage) get(ref string) (models.Category, error) {
+	if category, exists := s.categories[ref]; exists {
+		return category, nil
+	}
+	if id, exists := s.bySlug[ref]; exists {
+		return s.categories[id], nil
+	}
+	return models.Category{}, ErrCategoryNotFound
+}
+
+// Create создает новую категорию
+func (s *CategoryStorage) Create(category models.Category) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.categories[category.ID]; exists {
+		return errors.New("категория с таким ID уже существует")
+	}
+	if err := s.checkSlug(category.Slug, category.ID); err != nil {
+		return err
+	}
+	if err := models.ValidateDefinitions(category.Attributes); err != nil {
+		return err
+	}
+	if category.ParentID != "" {
+		if _, exists := s.categories[category.ParentID]; !exists {
+			return errors.New("родительская категория не найдена")
+		}
+	}
+
+	before := s.backup()
+	s.categories[category.ID] = category
+	s.bySlug[category.Slug] = category.ID
+	return s.commit(before)
+}
+
+// Update изменяет slug, название, родителя, позицию и схему атрибутов
+// категории и возвращает
+// категорию до и после изменения
+func (s *CategoryStorage) Update(id string, input models.CategoryInput) (models.Category, models.Category, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	oldCategory, category, err := s.change(id, input)
+	if err != nil {
+		return oldCategory, models.Category{}, err
+	}
+
+	before := s.backup()
+	s.replace(oldCategory, category)
+	if err := s.commit(before); err != nil {
+		return oldCategory, models.Category{}, err
+	}
+	return oldCategory, category, nil
+}
+
+// Preview возвращает копию дерева, в которой категория id уже изменена так,
+// как ее изменит Update с input. Копия не сохраняется в файл: по ее схемам
+// продукты проверяются до изменения дерева.
+func (s *CategoryStorage) Preview(id string, input models.CategoryInput) (*CategoryStorage, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	oldCategory, category, err := s.change(id, input)
+	if err != nil {
+		return nil, err
+	}
+
+	preview := NewCategoryStorage()
+	for key, existing := range s.categories {
+		preview.categories[key] = existing
+		preview.bySlug[existing.Slug] = key
+	}
+	preview.replace(oldCategory, category)
+	return preview, nil
+}
+
+// change проверяет изменение категории id и возвращает категорию до и
+// после него. Вызывается под блокировкой.
+func (s *CategoryStorage) change(id string, input models.CategoryInput) (models.Category, models.Category, error) {
+	oldCategory, exists := s.categories[id]
+	if !exists {
+		return models.Category{}, models.Category{}, ErrCategoryNotFound
+	}
+	if err := s.checkSlug(input.Slug, id); err != nil {
+		return oldCategory, models.Category{}, err
+	}
+	if err := s.checkParent(id, input.ParentID); err != nil {
+		return oldCategory, models.Category{}, err
+	}
+	if err := models.ValidateDefinitions(input.Attributes); err != nil {
+		return oldCategory, models.Category{}, err
+	}
+
+	category := oldCategory
+	category.Slug = input.Slug
+	category.Name = input.Name
+	category.ParentID = input.ParentID
+	category.Position = input.Position
+	category.Attributes = input.Attributes
+	category.UpdatedAt = time.Now()
+	return oldCategory, category, nil
+}
+
+// replace заменяет категорию oldCategory на category. Вызывается под
+// блокировкой.
+func (s *CategoryStorage) replace(oldCategory, category models.Category) {
+	delete(s.bySlug, oldCategory.Slug)
+	s.bySlug[category.Slug] = category.ID
+	s.categories[category.ID] = category
+}
+
+// Move переносит категорию вместе с потомками к родителю parentID. Если
+// position не задана, позиция сохраняется.
+func (s *CategoryStorage) Move(id, parentID string, position *int) (models.Category, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	category, exists := s.categories[id]
+	if !exists {
+		return models.Category{}, ErrCategoryNotFound
+	}
+	if err := s.checkParent(id, parentID); err != nil {
+		return models.Category{}, err
+	}
+
+	category.ParentID = parentID
+	if position != nil {
+		category.Position = *position
+	}
+	category.UpdatedAt = time.Now()
+	before := s.backup()
+	s.categories[id] = category
+	if err := s.commit(before); err != nil {
+		return models.Category{}, err
+	}
+	return category, nil
+}
+
+// Merge сливает категорию sourceID в targetID: дочерние категории источника
+// переходят к targetID, а сам источник удаляется. Перенос продуктов
+// выполняет вызывающий код. Возвращает источник, итоговую категорию и
+// перенесенные дочерние категории в состоянии до слияния, по которым
+// слияние можно отменить через Restore.
+func (s *CategoryStorage) Merge(sourceID, targetID string) (models.Category, models.Category, []models.Category, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	source, exists := s.categories[sourceID]
+	if !exists {
+		return models.Category{}, models.Category{}, nil, ErrCategoryNotFound
+	}
+	target, exists := s.categories[targetID]
+	if !exists {
+		return models.Category{}, models.Category{}, nil, ErrCategoryNotFound
+	}
+	if sourceID == targetID || s.isDescendant(targetID, sourceID) {
+		return models.Category{}, models.Category{}, nil, ErrCategoryCycle
+	}
+
+	before := s.backup()
+	now := time.Now()
+	children := s.children(sourceID)
+	for _, child := range children {
+		child.ParentID = targetID
+		child.UpdatedAt = now
+		s.categories[child.ID] = child
+	}
+
+	delete(s.categories, sourceID)
+	delete(s.bySlug, source.Slug)
+	if err := s.commit(before); err != nil {
+		return models.Category{}, models.Category{}, nil, err
+	}
+	return source, target, children, nil
+}
+
+// Restore возвращает категориям указанное состояние, создавая удаленные.
+// Используется для отмены изменения дерева, если перенос продуктов после
+// него не удался.
+func (s *CategoryStorage) Restore(categories ...models.Category) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, category := range categories {
+		if err := s.checkSlug(category.Slug, category.ID); err != nil {
+			return err
+		}
+	}
+
+	before := s.backup()
+	for _, category := range categories {
+		if current, exists := s.categories[category.ID]; exists {
+			delete(s.bySlug, current.Slug)
+		}
+		s.categories[category.ID] = category
+		s.bySlug[category.Slug] = category.ID
+	}
+	return s.commit(before)
+}
+
+// Delete удаляет категорию без дочерних категорий
+func (s *CategoryStorage) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	category, exists := s.categories[id]
+	if !exists {
+		return ErrCategoryNotFound
+	}
+	if len(s.children(id)) > 0 {
+		return ErrCategoryNotEmpty
+	}
+
+	before := s.backup()
+	delete(s.categories, id)
+	delete(s.bySlug, category.Slug)
+	return s.commit(before)
+}
+
+// Descendants возвращает всех потомков категории в порядке обхода дерева
+func (s *CategoryStorage) Descendants(id string) []models.Category {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var descendants []models.Category
+	var walk func(parentID string)
+	walk = func(parentID string) {
+		for _, child := range s.children(parentID) {
+			descendants = append(descendants, child)
+			walk(child.ID)
+		}
+	}
+	walk(id)
+	return descendants
+}
+
+// Breadcrumbs возвращает путь от корня дерева до категории со slug или ID
+// ref. Для незарегистрированной категории путь пуст.
+func (s *CategoryStorage) Breadcrumbs(ref string) []models.Breadcrumb {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	breadcrumbs := []models.Breadcrumb{}
+	category, err := s.get(ref)
+	if err != nil {
+		return breadcrumbs
+	}
+	for {
+		breadcrumbs = append(breadcrumbs, models.Breadcrumb{ID: category.ID, Slug: category.Slug, Name: category.Name})
+		parent, exists := s.categories[category.ParentID]
+		if !exists {
+			break
+		}
+		category = parent
+	}
+
+	for i, j := 0, len(breadcrumbs)-1; i < j; i, j = i+1, j-1 {
+		breadcrumbs[i], breadcrumbs[j] = breadcrumbs[j], breadcrumbs[i]
+	}
+	return breadcrumbs
+}
+
+// Schema возвращает схему атрибутов категории со slug или ID ref вместе с
+// унаследованными от предков определениями. Определение потомка заменяет
+// одноименное определение предка. Для незарегистрированной категории схема
+// пуста.
+func (s *CategoryStorage) Schema(ref string) []models.AttributeDefinition {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	category, err := s.get(ref)
+	if err != nil {
+		return nil
+	}
+	path := []models.Category{category}
+	for parent, exists := s.categories[category.ParentID]; exists; parent, exists = s.categories[parent.ParentID] {
+		path = append(path, parent)
+	}
+
+	var schema []models.AttributeDefinition
+	positions := make(map[string]int)
+	for i := len(path) - 1; i >= 0; i-- {
+		for _, definition := range path[i].Attributes {
+			if position, exists := positions[definition.Name]; exists {
+				schema[position] = definition
+				continue
+			}
+			positions[definition.Name] = len(schema)
+			schema = append(schema, definition)
+		}
+	}
+	return schema
+}
+
+// backup возвращает копию категорий для отмены изменения, если дерево
+// сохраняется в файл. Вызывается под блокировкой.
+func (s *CategoryStorage) backup() map[string]models.Category {
+	if s.path == "" {
+		return nil
+	}
+	categories := make(map[string]models.Category, len(s.categories))
+	for id, category := range s.categories {
+		categories[id] = category
+	}
+	return categories
+}
+
+// commit сохраняет дерево в файл. Новый файл записывается рядом и
+// переименовывается поверх старого; если сохранить дерево не удалось, оно
+// возвращается к состоянию before. Вызывается под блокировкой.
+func (s *CategoryStorage) commit(before map[string]models.Category) error {
+	if s.path == "" {
+		return nil
+	}
+
+	err := writeJSONFile(s.path, s.all())
+	if err != nil {
+		s.categories = before
+		s.bySlug = make(map[string]string, len(before))
+		for id, category := range before {
+			s.bySlug[category.Slug] = id
+		}
+	}
+	return err
+}
+
+// writeJSONFile записывает value в файл path через временный файл
+func writeJSONFile(path string, value interface{}) error {
+	data, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// children возвращает дочерние категории по порядку. Вызывается под блокировкой.
+func (s *CategoryStorage) children(parentID string) []models.Category {
+	var children []models.Category
+	for _, category := range s.categories {
+		if category.ParentID == parentID {
+			children = append(children, category)
+		}
+	}
+	sort.Slice(children, func(i, j int) bool {
+		return lessCategory(children[i], children[j])
+	})
+	return children
+}
+
+// isDescendant сообщает, что категория id находится в поддереве ancestorID.
+// Вызывается под блокировкой.
+func (s *CategoryStorage) isDescendant(id, ancestorID string) bool {
+	for category, exists := s.categories[id]; exists; category, exists = s.categories[category.ParentID] {
+		if category.ParentID == ancestorID {
+			return true
+		}
+	}
+	return false
+}
+
+// checkSlug проверяет формат slug и что он не занят другой категорией.
+// Вызывается под блокировкой.
+func (s *CategoryStorage) checkSlug(slug, id string) error {
+	if !slugPattern.MatchString(slug) {
+		return errors.New("slug может содержать только буквы, цифры, дефисы и подчеркивания")
+	}
+	if owner, exists := s.bySlug[slug]; exists && owner != id {
+		return ErrDuplicateSlug
+	}
+	return nil
+}
+
+// checkParent проверяет, что категорию id можно поместить в parentID.
+// Вызывается под блокировкой.
+func (s *CategoryStorage) checkParent(id, parentID string) error {
+	if parentID == "" {
+		return nil
+	}
+	if _, exists := s.categories[parentID]; !exists {
+		return errors.New("родительская категория не найдена")
+	}
+	if parentID == id || s.isDescendant(parentID, id) {
+		return ErrCategoryCycle
+	}
+	return nil
+}
+
+func lessCategory(a, b models.Category) bool {
+	if a.Position != b.Position {
+		return a.Position < b.Position
+	}
+	return a.Name < b.Name
+}
@@ -0,0 +1,316 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/Afra1m/product_api/models"
+)
+
+// DefaultCompactAfter задает число записей ленты, начиная с которого лента
+// уплотняется, если большая часть записей устарела
+const DefaultCompactAfter = 10000
+
+// ChangeLog хранит упорядоченную ленту изменений продуктов с глобальным
+// монотонно возрастающим номером записи. Запись содержит продукт без
+// истории и только добавленные ею записи истории (см. models.ProductChange).
+// Лента периодически уплотняется: от каждого продукта остается последняя
+// запись с полной историей, а номера записей сохраняются.
+type ChangeLog interface {
+	// Append присваивает записям следующие номера и сохраняет их одной
+	// группой: либо все записи, либо ни одной
+	Append(changes ...models.ProductChange) ([]models.ProductChange, error)
+	// Since возвращает не более limit записей с номером больше seq
+	Since(seq uint64, limit int) []models.ProductChange
+	// LastSeq возвращает номер последней записи
+	LastSeq() uint64
+}
+
+// MemoryChangeLog хранит ленту изменений в памяти
+type MemoryChangeLog struct {
+	changes  []models.ProductChange
+	products map[string]struct{}
+	lastSeq  uint64
+	mu       sync.RWMutex
+
+	// CompactAfter задает число записей, начиная с которого лента
+	// уплотняется, если записей больше чем вдвое больше, чем продуктов в ней
+	CompactAfter int
+}
+
+// NewMemoryChangeLog создает ленту изменений в памяти
+func NewMemoryChangeLog() *MemoryChangeLog {
+	return &MemoryChangeLog{
+		products:     make(map[string]struct{}),
+		CompactAfter: DefaultCompactAfter,
+	}
+}
+
+// Append добавляет группу записей в ленту
+func (l *MemoryChangeLog) Append(changes ...models.ProductChange) ([]models.ProductChange, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	changes = numberChanges(changes, l.lastSeq)
+	l.add(changes...)
+	l.compact()
+	return changes, nil
+}
+
+// add добавляет записи в конец ленты. Вызывается под блокировкой.
+func (l *MemoryChangeLog) add(changes ...models.ProductChange) {
+	for _, change := range changes {
+		l.changes = append(l.changes, change)
+		l.products[change.ProductID] = struct{}{}
+		l.lastSeq = change.Seq
+	}
+}
+
+// compact уплотняет ленту, если в ней накопилось много устаревших записей,
+// и сообщает, было ли уплотнение. Вызывается под блокировкой.
+func (l *MemoryChangeLog) compact() bool {
+	if len(l.changes) < l.CompactAfter || len(l.changes) <= 2*len(l.products) {
+		return false
+	}
+	l.changes = compactChanges(l.changes)
+	return true
+}
+
+// numberChanges возвращает копию группы записей с номерами после lastSeq и
+// отметками продолжения группы
+func numberChanges(changes []models.ProductChange, lastSeq uint64) []models.ProductChange {
+	numbered := make([]models.ProductChange, len(changes))
+	for i, change := range changes {
+		change.Seq = lastSeq + uint64(i) + 1
+		change.Continued = i < len(changes)-1
+		numbered[i] = change
+	}
+	return numbered
+}
+
+// compactChanges оставляет от каждого продукта последнюю запись. Записи
+// истории из отброшенных записей переносятся в оставшуюся запись, которая
+// после этого содержит всю историю продукта. Удаления сохраняются, чтобы
+// читатели ленты с устаревшей позиции узнали о них. Группы после уплотнения
+// не восстанавливаются.
+func compactChanges(changes []models.ProductChange) []models.ProductChange {
+	history := make(map[string][]models.ProductHistory)
+	last := make(map[string]int)
+	for i, change := range changes {
+		history[change.ProductID] = replayHistory(history[change.ProductID], change)
+		last[change.ProductID] = i
+	}
+
+	compacted := make([]models.ProductChange, 0, len(last))
+	for i, change := range changes {
+		if last[change.ProductID] != i {
+			continue
+		}
+		change.Continued = false
+		if change.Product != nil {
+			product := *change.Product
+			product.History = nil
+			change.Product = &product
+			change.History = history[change.ProductID]
+			change.HistoryReset = true
+		}
+		compacted = append(compacted, change)
+	}
+	return compacted
+}
+
+// replayHistory возвращает историю продукта после записи change, если до
+// нее история была равна history. Новые записи добавляются к history на
+// месте, поэтому history должна принадлежать вызывающему коду; сама запись
+// change не изменяется.
+func replayHistory(history []models.ProductHistory, change models.ProductChange) []models.ProductHistory {
+	switch {
+	case change.Product == nil:
+		return nil
+	case change.Product.History != nil:
+		// Запись старого формата с полной историей в продукте
+		return append([]models.ProductHistory(nil), change.Product.History...)
+	case change.HistoryReset:
+		return append([]models.ProductHistory(nil), change.History...)
+	default:
+		return append(history, change.History...)
+	}
+}
+
+// Since возвращает записи с номером больше seq
+func (l *MemoryChangeLog) Since(seq uint64, limit int) []models.ProductChange {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	start := sort.Search(len(l.changes), func(i int) bool {
+		return l.changes[i].Seq > seq
+	})
+	end := len(l.changes)
+	if limit > 0 && start+limit < end {
+		end = start + limit
+	}
+
+	changes := make([]models.ProductChange, end-start)
+	copy(changes, l.changes[start:end])
+	return changes
+}
+
+// LastSeq возвращает номер последней записи
+func (l *MemoryChangeLog) LastSeq() uint64 {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return l.lastSeq
+}
+
+// FileChangeLog хранит ленту изменений в файле в формате NDJSON и держит
+// ее копию в памяти для чтения. Каждая запись передается операционной
+// системе сразу при добавлении, поэтому лента переживает перезапуск процесса.
+// После уплотнения ленты в памяти файл переписывается заново.
+type FileChangeLog struct {
+	*MemoryChangeLog
+	path string
+	file *os.File
+	size int64
+	mu   sync.Mutex
+}
+
+// OpenFileChangeLog открывает файл ленты изменений, загружая уже сохраненные
+// записи. Незавершенная последняя строка и незавершенная последняя группа
+// записей, оставшиеся после аварийной остановки, отбрасываются.
+func OpenFileChangeLog(path string) (*FileChangeLog, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	memory := NewMemoryChangeLog()
+	var group []models.ProductChange
+	var read, valid int64
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			// Строка без перевода строки записана не полностью
+			break
+		}
+		var change models.ProductChange
+		if err := json.Unmarshal(line, &change); err != nil {
+			break
+		}
+		group = append(group, change)
+		read += int64(len(line))
+		if !change.Continued {
+			memory.add(group...)
+			group = group[:0]
+			valid = read
+		}
+	}
+
+	if err := file.Truncate(valid); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if _, err := file.Seek(valid, 0); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	l := &FileChangeLog{MemoryChangeLog: memory, path: path, file: file, size: valid}
+	if memory.compact() {
+		if err := l.rewrite(); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+// Append записывает группу записей в файл одним вызовом и добавляет ее в
+// ленту. Если запись не удалась, файл обрезается до прежнего размера.
+func (l *FileChangeLog) Append(changes ...models.ProductChange) ([]models.ProductChange, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	changes = numberChanges(changes, l.LastSeq())
+	var data []byte
+	for _, change := range changes {
+		line, err := json.Marshal(change)
+		if err != nil {
+			return nil, err
+		}
+		data = append(append(data, line...), '\n')
+	}
+	if _, err := l.file.Write(data); err != nil {
+		l.file.Truncate(l.size)
+		l.file.Seek(l.size, 0)
+		return nil, err
+	}
+	l.size += int64(len(data))
+
+	l.MemoryChangeLog.mu.Lock()
+	l.add(changes...)
+	compacted := l.compact()
+	l.MemoryChangeLog.mu.Unlock()
+
+	if compacted {
+		// Несжатый файл остается верным, поэтому ошибка перезаписи не
+		// отменяет уже сохраненную группу
+		l.rewrite()
+	}
+	return changes, nil
+}
+
+// rewrite заменяет файл ленты записями из памяти. Новый файл записывается
+// рядом и переименовывается поверх старого, поэтому при сбое остается один
+// из двух целых файлов. Вызывается под блокировкой файла.
+func (l *FileChangeLog) rewrite() error {
+	changes := l.Since(0, 0)
+
+	tmp := l.path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(file)
+	var size int64
+	for _, change := range changes {
+		line, err := json.Marshal(change)
+		if err != nil {
+			file.Close()
+			return err
+		}
+		n, _ := writer.Write(append(line, '\n'))
+		size += int64(n)
+	}
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, l.path); err != nil {
+		return err
+	}
+
+	reopened, err := os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	l.file.Close()
+	l.file = reopened
+	l.size = size
+	return nil
+}
+
+// Close закрывает файл ленты изменений
+func (l *FileChangeLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.file.Close()
+}
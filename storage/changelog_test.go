@@ -0,0 +1,209 @@
+package storage
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/Afra1m/product_api/models"
+)
+
+func historyOf(fields ...string) []models.ProductHistory {
+	history := make([]models.ProductHistory, len(fields))
+	for i, field := range fields {
+		history[i] = models.ProductHistory{Field: field}
+	}
+	return history
+}
+
+func testUpsert(id string, history []models.ProductHistory) models.ProductChange {
+	return models.ProductChange{
+		Type:      models.ChangeUpsert,
+		ProductID: id,
+		Product:   &models.Product{ID: id, Name: id},
+		History:   history,
+	}
+}
+
+func TestReplayHistory(t *testing.T) {
+	legacy := testUpsert("p", nil)
+	legacy.Product.History = historyOf("legacy")
+	reset := testUpsert("p", historyOf("reset"))
+	reset.HistoryReset = true
+
+	tests := []struct {
+		name   string
+		change models.ProductChange
+		want   []models.ProductHistory
+	}{
+		{"добавление", testUpsert("p", historyOf("price")), historyOf("name", "price")},
+		{"без новых записей", testUpsert("p", nil), historyOf("name")},
+		{"удаление", models.ProductChange{Type: models.ChangeDelete, ProductID: "p"}, nil},
+		{"старый формат", legacy, historyOf("legacy")},
+		{"сброс", reset, historyOf("reset")},
+	}
+	for _, tt := range tests {
+		got := replayHistory(historyOf("name"), tt.change)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: история %v, ожидалось %v", tt.name, got, tt.want)
+		}
+	}
+
+	// Продолжение истории не меняет записи, из которых она собрана
+	got := replayHistory(nil, reset)
+	got = replayHistory(got, testUpsert("p", historyOf("stock")))
+	got[0].Field = "changed"
+	if reset.History[0].Field != "reset" {
+		t.Fatal("воспроизведение истории изменило запись ленты")
+	}
+}
+
+func TestCompactChanges(t *testing.T) {
+	changes := numberChanges([]models.ProductChange{
+		testUpsert("p1", historyOf("created")),
+		testUpsert("p2", historyOf("created")),
+	}, 0)
+	changes = append(changes, numberChanges([]models.ProductChange{
+		testUpsert("p1", historyOf("price")),
+		{Type: models.ChangeDelete, ProductID: "p2"},
+		testUpsert("p3", historyOf("created")),
+	}, 2)...)
+	changes = append(changes, numberChanges([]models.ProductChange{
+		testUpsert("p1", historyOf("stock")),
+	}, 5)...)
+	original, _ := json.Marshal(changes)
+
+	compacted := compactChanges(changes)
+
+	if len(compacted) != 3 {
+		t.Fatalf("после уплотнения %d записей, ожидалось 3", len(compacted))
+	}
+	wantIDs := []string{"p2", "p3", "p1"}
+	wantSeqs := []uint64{4, 5, 6}
+	for i, change := range compacted {
+		if change.ProductID != wantIDs[i] || change.Seq != wantSeqs[i] || change.Continued {
+			t.Fatalf("запись %d: продукт %s, номер %d, продолжение %v", i, change.ProductID, change.Seq, change.Continued)
+		}
+	}
+	if compacted[0].Type != models.ChangeDelete || compacted[0].Product != nil {
+		t.Fatalf("удаление p2 не сохранено: %+v", compacted[0])
+	}
+	p1 := compacted[2]
+	if !p1.HistoryReset || !reflect.DeepEqual(p1.History, historyOf("created", "price", "stock")) {
+		t.Fatalf("история p1 после уплотнения %v, сброс %v", p1.History, p1.HistoryReset)
+	}
+	if !compacted[1].HistoryReset || !reflect.DeepEqual(compacted[1].History, historyOf("created")) {
+		t.Fatalf("история p3 после уплотнения %v", compacted[1].History)
+	}
+
+	if after, _ := json.Marshal(changes); string(after) != string(original) {
+		t.Fatal("уплотнение изменило исходные записи")
+	}
+
+	// Воспроизведение уплотненной ленты дает ту же историю, что и полной
+	var full, short []models.ProductHistory
+	for _, change := range changes {
+		if change.ProductID == "p1" {
+			full = replayHistory(full, change)
+		}
+	}
+	short = replayHistory(short, p1)
+	if !reflect.DeepEqual(full, short) {
+		t.Fatalf("история по полной ленте %v, по уплотненной %v", full, short)
+	}
+}
+
+func TestMemoryChangeLogCompacts(t *testing.T) {
+	log := NewMemoryChangeLog()
+	log.CompactAfter = 10
+	for i := 0; i < 10; i++ {
+		if _, err := log.Append(testUpsert("p", historyOf("price"))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	changes := log.Since(0, 0)
+	if len(changes) != 1 || changes[0].Seq != 10 || log.LastSeq() != 10 {
+		t.Fatalf("после уплотнения в ленте %d записей, последний номер %d", len(changes), log.LastSeq())
+	}
+	if len(changes[0].History) != 10 {
+		t.Fatalf("после уплотнения в истории %d записей, ожидалось 10", len(changes[0].History))
+	}
+	if changes := log.Since(3, 0); len(changes) != 1 || changes[0].Seq != 10 {
+		t.Fatalf("чтение с устаревшей позиции вернуло %v", changes)
+	}
+}
+
+// TestFileChangeLogTornGroup проверяет, что при открытии ленты
+// отбрасываются оборванная последняя строка и незавершенная последняя
+// группа, а файл обрезается так, что следующие группы читаются после
+// перезапуска
+func TestFileChangeLogTornGroup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "changes.ndjson")
+	log, err := OpenFileChangeLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := log.Append(testUpsert("p1", historyOf("created")), testUpsert("p2", historyOf("created"))); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := log.Append(testUpsert("p1", historyOf("price"))); err != nil {
+		t.Fatal(err)
+	}
+	if err := log.Close(); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	complete := info.Size()
+
+	// Группа из трех записей, из которых записаны две, а вторая оборвана
+	torn := numberChanges([]models.ProductChange{
+		testUpsert("p3", historyOf("created")),
+		testUpsert("p4", historyOf("created")),
+		testUpsert("p5", historyOf("created")),
+	}, 3)
+	first, _ := json.Marshal(torn[0])
+	second, _ := json.Marshal(torn[1])
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Write(append(first, '\n'))
+	file.Write(second[:len(second)/2])
+	file.Close()
+
+	log, err = OpenFileChangeLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if log.LastSeq() != 3 || len(log.Since(0, 0)) != 3 {
+		t.Fatalf("после открытия последний номер %d, записей %d", log.LastSeq(), len(log.Since(0, 0)))
+	}
+	if info, _ := os.Stat(path); info.Size() != complete {
+		t.Fatalf("размер файла %d, ожидался %d", info.Size(), complete)
+	}
+
+	appended, err := log.Append(testUpsert("p6", historyOf("created")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if appended[0].Seq != 4 {
+		t.Fatalf("новая запись получила номер %d, ожидался 4", appended[0].Seq)
+	}
+	log.Close()
+
+	log, err = OpenFileChangeLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+	changes := log.Since(0, 0)
+	if len(changes) != 4 || changes[3].ProductID != "p6" || !changes[0].Continued || changes[1].Continued {
+		t.Fatalf("после повторного открытия записи %+v", changes)
+	}
+}
@@ -0,0 +1,316 @@
+package storage
+
+import (
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/Afra1m/product_api/models"
+)
+
+// Все изменения продуктов проходят через транзакцию tx. Операция хранилища
+// под блокировкой lockWrite собирает в ней новые состояния продуктов: при
+// сохранении производные поля продукта приводятся в соответствие со
+// связанными продуктами, а изменение распространяется на них (см.
+// family.go); блокировки связанных продуктов берет lockWrite. На этом шаге
+// хранилище заблокировано только на чтение, и записи в разные сегменты
+// выполняются параллельно. Затем commit под блокировкой хранилища на запись
+// проверяет уникальность SKU и штрихкода и записывает все изменения в ленту
+// изменений одной группой: если проверка или запись не удалась, ни один
+// продукт не меняется и события не создаются. Только после этого изменения
+// применяются к хранилищу и индексам, а события записываются в outbox.
+// Хранилище сохраняет глубокую копию продукта, поэтому вызывающий код может
+// и дальше изменять переданное значение; сохраненные продукты не изменяются
+// на месте, а при чтении возвращаются их копии.
+
+// tx накапливает изменения продуктов одной операции. staged хранит новые
+// состояния затронутых продуктов (nil для удаленных), original — их
+// состояния до транзакции, а order — порядок, в котором они были затронуты.
+// byParent и byComponent дополняют одноименные индексы хранилища
+// сохраненными в транзакции вариантами и наборами, а skus связывает SKU
+// сохраненных в ней продуктов с их ID. Изменения транзакции с
+// silent записываются в ленту изменений, но не порождают событий. checked
+// отмечает продукты, сохраненные самой операцией, а не пересчетом
+// производных полей: они проверяются перед записью (см. ProductValidator).
+type tx struct {
+	s           *ProductStorage
+	staged      map[string]*models.Product
+	original    map[string]models.Product
+	existed     map[string]bool
+	order       []string
+	byParent    map[string]idSet
+	byComponent map[string]idSet
+	skus        map[string]string
+	checked     map[string]bool
+	silent      bool
+}
+
+// begin начинает транзакцию. Вызывается под блокировкой.
+func (s *ProductStorage) begin() *tx {
+	return &tx{
+		s:        s,
+		staged:   make(map[string]*models.Product),
+		original: make(map[string]models.Product),
+		existed:  make(map[string]bool),
+
+		byParent:    make(map[string]idSet),
+		byComponent: make(map[string]idSet),
+		skus:        make(map[string]string),
+		checked:     make(map[string]bool),
+	}
+}
+
+// get возвращает продукт с учетом изменений транзакции
+func (t *tx) get(id string) (models.Product, bool) {
+	if product, staged := t.staged[id]; staged {
+		if product == nil {
+			return models.Product{}, false
+		}
+		return *product, true
+	}
+	return t.s.get(id)
+}
+
+// touch запоминает исходное состояние продукта перед первым изменением
+func (t *tx) touch(id string) {
+	if _, staged := t.staged[id]; staged {
+		return
+	}
+	t.original[id], t.existed[id] = t.s.get(id)
+	t.order = append(t.order, id)
+}
+
+// save добавляет в транзакцию новое состояние продукта, которое будет
+// проверено перед записью
+func (t *tx) save(product models.Product) {
+	t.checked[product.ID] = true
+	t.stage(product)
+}
+
+// stage добавляет в транзакцию новое состояние продукта
+func (t *tx) stage(product models.Product) {
+	product = product.Clone()
+	t.applyFamily(&product)
+	oldProduct, _ := t.get(product.ID)
+
+	t.touch(product.ID)
+	t.unstageSKU(product.ID)
+	t.staged[product.ID] = &product
+	if _, taken := t.skus[product.SKU]; product.SKU != "" && !taken {
+		t.skus[product.SKU] = product.ID
+	}
+	if product.IsVariant() {
+		addToSet(t.byParent, product.ParentID, product.ID)
+	}
+	if product.IsBundle() {
+		for _, component := range product.Bundle.Components {
+			addToSet(t.byComponent, component.ProductID, product.ID)
+		}
+	}
+	t.syncFamily(oldProduct, product)
+}
+
+// unstageSKU убирает из skus SKU, сохраненный в транзакции для продукта id
+func (t *tx) unstageSKU(id string) {
+	if product := t.staged[id]; product != nil && t.skus[product.SKU] == id {
+		delete(t.skus, product.SKU)
+	}
+}
+
+// delete добавляет в транзакцию удаление продукта вместе с его вариантами.
+// Продукт, входящий в набор, удалить нельзя.
+func (t *tx) delete(product models.Product) error {
+	if err := t.checkComponentsUnused(product); err != nil {
+		return err
+	}
+
+	t.touch(product.ID)
+	t.unstageSKU(product.ID)
+	t.staged[product.ID] = nil
+	for _, id := range t.variantIDs(product.ID) {
+		variant, _ := t.get(id)
+		if err := t.delete(variant); err != nil {
+			return err
+		}
+	}
+	t.syncFamily(product, models.Product{})
+	return nil
+}
+
+// commit записывает изменения транзакции в ленту изменений и применяет их.
+// Записи ленты и события готовятся под блокировкой хранилища на чтение, а
+// на запись оно блокируется только для проверки ключей, записи в ленту и
+// применения изменений.
+func (t *tx) commit() error {
+	if err := t.validate(); err != nil {
+		return err
+	}
+
+	var changes []models.ProductChange
+	var events []models.ProductEvent
+	now := time.Now()
+	for _, id := range t.order {
+		product, existed := t.staged[id], t.existed[id]
+		switch {
+		case product != nil:
+			changes = append(changes, upsertChange(t.original[id], *product, now))
+		case existed:
+			changes = append(changes, models.ProductChange{Type: models.ChangeDelete, ProductID: id, Timestamp: now})
+		default:
+			// Продукт создан и удален в одной транзакции
+			continue
+		}
+		if !t.silent {
+			events = append(events, t.s.changeEvents(t.original[id], existed, product)...)
+		}
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+
+	return t.s.exclusive(func() error {
+		return t.apply(changes, events)
+	})
+}
+
+// apply проверяет ключи, записывает изменения транзакции в ленту изменений
+// и применяет их. Вызывается под блокировкой хранилища на запись.
+func (t *tx) apply(changes []models.ProductChange, events []models.ProductEvent) error {
+	if err := t.checkKeys(); err != nil {
+		return err
+	}
+
+	changes, err := t.s.changes.Append(changes...)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range t.order {
+		if t.existed[id] {
+			t.s.unindex(t.original[id])
+		}
+		if product := t.staged[id]; product != nil {
+			t.s.put(*product)
+			t.s.index(*product)
+		} else {
+			t.s.remove(id)
+		}
+	}
+	t.s.version = changes[len(changes)-1].Seq
+	if !t.silent {
+		t.s.contentVersion = t.s.version
+	}
+	t.s.record(t.s.version, events...)
+	return nil
+}
+
+// upsertChange возвращает запись ленты о сохранении продукта. Запись
+// содержит продукт без истории и добавленные к истории записи; если история
+// изменилась не только добавлением в конец, запись содержит ее целиком.
+func upsertChange(oldProduct, product models.Product, now time.Time) models.ProductChange {
+	change := models.ProductChange{
+		Type:      models.ChangeUpsert,
+		ProductID: product.ID,
+		Timestamp: now,
+	}
+	old := oldProduct.History
+	if len(product.History) >= len(old) && reflect.DeepEqual(product.History[:len(old)], old) {
+		change.History = product.History[len(old):]
+	} else {
+		change.History = product.History
+		change.HistoryReset = true
+	}
+	product.History = nil
+	change.Product = &product
+	return change
+}
+
+// variantIDs возвращает упорядоченные ID вариантов продукта с учетом
+// изменений транзакции
+func (t *tx) variantIDs(parentID string) []string {
+	return t.overlay(t.s.fields.byParent[parentID], t.byParent[parentID], func(product models.Product) bool {
+		return product.ParentID == parentID
+	})
+}
+
+// bundleIDs возвращает упорядоченные ID наборов, в которые входит продукт,
+// с учетом изменений транзакции
+func (t *tx) bundleIDs(id string) []string {
+	return t.overlay(t.s.fields.byComponent[id], t.byComponent[id], func(product models.Product) bool {
+		return hasComponent(product, id)
+	})
+}
+
+// overlay возвращает упорядоченные ID из индекса хранилища committed и
+// индекса транзакции staged. Измененные в транзакции продукты берутся из
+// staged, куда попадает каждый сохраненный продукт, и остаются, только если
+// для их текущего состояния выполняется match.
+func (t *tx) overlay(committed, staged idSet, match func(product models.Product) bool) []string {
+	ids := make([]string, 0, len(committed)+len(staged))
+	for id := range committed {
+		if _, changed := t.staged[id]; !changed {
+			ids = append(ids, id)
+		}
+	}
+	for id := range staged {
+		if product := t.staged[id]; product != nil && match(*product) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// commitSave сохраняет новый или измененный продукт отдельной транзакцией
+func (s *ProductStorage) commitSave(product models.Product) error {
+	t := s.begin()
+	t.save(product)
+	return t.commit()
+}
+
+// commitDelete удаляет продукт вместе с его вариантами отдельной транзакцией
+func (s *ProductStorage) commitDelete(product models.Product) error {
+	t := s.begin()
+	if err := t.delete(product); err != nil {
+		return err
+	}
+	return t.commit()
+}
+
+// Version возвращает номер версии каталога, равный номеру последней записи
+// ленты изменений, поэтому с постоянной лентой версия не уменьшается после
+// перезапуска. По ней производные данные, например кэши рекомендаций,
+// определяют, что их нужно перестроить.
+func (s *ProductStorage) Version() uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.version
+}
+
+// GetChanges возвращает страницу ленты изменений после номера since
+func (s *ProductStorage) GetChanges(since uint64, limit int) models.ChangeFeed {
+	changes := s.changes.Since(since, limit+1)
+
+	feed := models.ChangeFeed{
+		Changes:   changes,
+		NextSince: since,
+	}
+	if len(changes) > limit {
+		feed.Changes = changes[:limit]
+		feed.HasMore = true
+	}
+	for i, change := range feed.Changes {
+		if change.Product != nil {
+			product := change.Product.Clone()
+			feed.Changes[i].Product = &product
+		}
+		if change.History != nil {
+			feed.Changes[i].History = append([]models.ProductHistory(nil), change.History...)
+		}
+	}
+	if len(feed.Changes) > 0 {
+		feed.NextSince = feed.Changes[len(feed.Changes)-1].Seq
+	}
+	return feed
+}
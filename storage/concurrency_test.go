@@ -0,0 +1,388 @@
+package storage
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Afra1m/product_api/models"
+)
+
+// testProduct возвращает продукт с номером i
+func testProduct(i int) models.Product {
+	now := time.Now()
+	return models.Product{
+		ID:        fmt.Sprintf("p%06d", i),
+		Name:      fmt.Sprintf("Product %d", i),
+		Price:     float64(i%1000) + 1,
+		Category:  fmt.Sprintf("c%d", i%10),
+		Stock:     i % 50,
+		Tags:      []string{fmt.Sprintf("t%d", i%7)},
+		SKU:       fmt.Sprintf("SKU-%06d", i),
+		CreatedAt: now.Add(time.Duration(i) * time.Millisecond),
+		UpdatedAt: now,
+	}
+}
+
+// newTestStorage создает хранилище с n продуктами
+func newTestStorage(tb testing.TB, n int) *ProductStorage {
+	tb.Helper()
+	s := NewProductStorage()
+	products := make([]models.Product, n)
+	for i := range products {
+		products[i] = testProduct(i)
+	}
+	if err := s.CreateBatch(products); err != nil {
+		tb.Fatal(err)
+	}
+	return s
+}
+
+// TestConcurrentWrites проверяет под детектором гонок, что параллельные
+// записи в разные и связанные продукты вместе с чтениями оставляют
+// производные поля, версию и ленту изменений согласованными
+func TestConcurrentWrites(t *testing.T) {
+	const products = 64
+	s := newTestStorage(t, products)
+
+	parent := testProduct(1000)
+	parent.Stock = 0
+	if err := s.Create(parent); err != nil {
+		t.Fatal(err)
+	}
+	axes := []models.VariantAxis{{Name: "size", Values: []string{"s", "m", "l"}}}
+	if _, err := s.SetVariantAxes(parent.ID, axes); err != nil {
+		t.Fatal(err)
+	}
+	for i, size := range axes[0].Values {
+		variant := testProduct(1001 + i)
+		variant.ParentID = parent.ID
+		variant.Options = map[string]string{"size": size}
+		if _, err := s.CreateVariant(parent.ID, variant); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	bundle := testProduct(2000)
+	components := []models.BundleComponent{{ProductID: testProduct(0).ID, Quantity: 1}, {ProductID: testProduct(1).ID, Quantity: 2}}
+	if err := s.Create(bundle); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.SetBundle(bundle.ID, &models.Bundle{Components: components, Pricing: models.BundlePricingDerived}); err != nil {
+		t.Fatal(err)
+	}
+
+	var writers, readers sync.WaitGroup
+	var stop atomic.Bool
+	var views atomic.Int64
+	for w := 0; w < 8; w++ {
+		writers.Add(1)
+		go func(w int) {
+			defer writers.Done()
+			for i := 0; i < 200; i++ {
+				id := testProduct((w*31 + i) % products).ID
+				switch i % 5 {
+				case 0:
+					s.UpdateStock(id, i)
+				case 1:
+					s.AdjustStock(bundle.ID, 1)
+				case 2:
+					s.UpdateStock(testProduct(1001+i%3).ID, i)
+				case 3:
+					if s.IncrementCounters(id, 1, 0) == nil {
+						views.Add(1)
+					}
+					if i%2 == 0 {
+						s.FlushCounters()
+					}
+				case 4:
+					product, err := s.GetByID(id)
+					if err == nil {
+						product.Price++
+						product.Tags = append(product.Tags, "updated")
+						s.Update(id, product)
+					}
+				}
+			}
+		}(w)
+	}
+	for r := 0; r < 4; r++ {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for !stop.Load() {
+				s.GetSorted(SortPrice, false, models.ProductFilter{Category: "c1"}, 0, 10)
+				s.GetByCategory("c2")
+				s.Snapshot().GetAll()
+				s.GetByID(bundle.ID)
+				s.Version()
+			}
+		}()
+	}
+
+	writers.Wait()
+	stop.Store(true)
+	readers.Wait()
+
+	if err := s.FlushCounters(); err != nil {
+		t.Fatal(err)
+	}
+	total := 0
+	for _, product := range s.GetAll() {
+		total += product.Views
+	}
+	if int64(total) != views.Load() {
+		t.Fatalf("сохранено %d просмотров, учтено %d", total, views.Load())
+	}
+
+	if version, lastSeq := s.Version(), s.changes.LastSeq(); version != lastSeq {
+		t.Fatalf("версия %d не равна номеру последней записи ленты %d", version, lastSeq)
+	}
+
+	gotParent, _ := s.GetByID(parent.ID)
+	stock := 0
+	for i := range axes[0].Values {
+		variant, _ := s.GetByID(testProduct(1001 + i).ID)
+		stock += variant.Stock
+	}
+	if gotParent.Stock != stock {
+		t.Fatalf("остаток родителя %d, сумма остатков вариантов %d", gotParent.Stock, stock)
+	}
+
+	gotBundle, _ := s.GetByID(bundle.ID)
+	first, _ := s.GetByID(components[0].ProductID)
+	second, _ := s.GetByID(components[1].ProductID)
+	available := first.Stock
+	if second.Stock/2 < available {
+		available = second.Stock / 2
+	}
+	if gotBundle.Stock != available {
+		t.Fatalf("остаток набора %d, из компонентов можно собрать %d", gotBundle.Stock, available)
+	}
+}
+
+// mutate изменяет на месте все срезы и карты продукта и дописывает в срезы
+// новые элементы
+func mutate(product *models.Product) {
+	for i := range product.Tags {
+		product.Tags[i] = "mutated"
+	}
+	product.Tags = append(product.Tags, "mutated")
+	for name := range product.Attributes {
+		product.Attributes[name] = "mutated"
+	}
+	for i := range product.VariantAxes {
+		product.VariantAxes[i].Values[0] = "mutated"
+		product.VariantAxes[i].Values = append(product.VariantAxes[i].Values, "mutated")
+	}
+	for i := range product.History {
+		product.History[i].Field = "mutated"
+	}
+	product.History = append(product.History, models.ProductHistory{Field: "mutated"})
+	if product.Bundle != nil {
+		for i := range product.Bundle.Components {
+			product.Bundle.Components[i].Quantity = 100
+		}
+		product.Bundle.Components = append(product.Bundle.Components, models.BundleComponent{ProductID: "mutated", Quantity: 1})
+	}
+}
+
+// TestProductsAreCopies проверяет под детектором гонок, что хранилище не
+// разделяет срезы и карты с переданными ему и возвращенными им продуктами:
+// их изменение, в том числе параллельно с записью, не меняет сохраненную копию
+func TestProductsAreCopies(t *testing.T) {
+	s := newTestStorage(t, 2)
+
+	parent := testProduct(100)
+	parent.Stock = 0
+	parent.Attributes = models.Attributes{"ram": 8.0, "ports": []interface{}{"usb", "hdmi"}}
+	if err := s.Create(parent); err != nil {
+		t.Fatal(err)
+	}
+	axes := []models.VariantAxis{{Name: "size", Values: []string{"s", "m"}}}
+	if _, err := s.SetVariantAxes(parent.ID, axes); err != nil {
+		t.Fatal(err)
+	}
+
+	bundle := testProduct(200)
+	components := &models.Bundle{
+		Components: []models.BundleComponent{{ProductID: testProduct(0).ID, Quantity: 1}, {ProductID: testProduct(1).ID, Quantity: 2}},
+		Pricing:    models.BundlePricingDerived,
+	}
+	if err := s.Create(bundle); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.SetBundle(bundle.ID, components); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		product, _ := s.GetByID(parent.ID)
+		product.Name = fmt.Sprintf("Parent %d", i)
+		if err := s.Update(parent.ID, product); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Изменение переданных продуктов не затрагивает сохраненные
+	wantParent, _ := s.GetByID(parent.ID)
+	wantBundle, _ := s.GetByID(bundle.ID)
+	mutate(&parent)
+	mutate(&bundle)
+	axes[0].Values[0] = "mutated"
+	components.Components[0].Quantity = 100
+
+	var wg sync.WaitGroup
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				for _, id := range []string{parent.ID, bundle.ID} {
+					product, _ := s.GetByID(id)
+					mutate(&product)
+				}
+				for _, product := range s.Snapshot().GetAll() {
+					mutate(&product)
+				}
+				for _, product := range s.GetAll() {
+					mutate(&product)
+				}
+			}
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		// Запись дописывает историю и пересчитывает остаток набора
+		// параллельно с изменением возвращенных копий
+		for i := 0; i < 50; i++ {
+			s.UpdateStock(testProduct(0).ID, i)
+		}
+	}()
+	wg.Wait()
+
+	gotParent, _ := s.GetByID(parent.ID)
+	gotBundle, _ := s.GetByID(bundle.ID)
+	if !reflect.DeepEqual(gotParent, wantParent) {
+		t.Fatalf("сохраненный продукт изменился:\n%+v\n%+v", gotParent, wantParent)
+	}
+	if !reflect.DeepEqual(gotBundle.Bundle, wantBundle.Bundle) || !reflect.DeepEqual(gotBundle.Tags, wantBundle.Tags) {
+		t.Fatalf("сохраненный набор изменился:\n%+v\n%+v", gotBundle, wantBundle)
+	}
+}
+
+// TestChangeCategories проверяет, что запись продукта ждет окончания
+// изменения дерева категорий, а перенос продуктов внутри него не ждет
+// и учитывает только сохраненные продукты, без вариантов
+func TestChangeCategories(t *testing.T) {
+	s := NewProductStorage()
+	parent := testProduct(0)
+	parent.Stock = 0
+	if err := s.Create(parent); err != nil {
+		t.Fatal(err)
+	}
+	axes := []models.VariantAxis{{Name: "size", Values: []string{"s", "m"}}}
+	if _, err := s.SetVariantAxes(parent.ID, axes); err != nil {
+		t.Fatal(err)
+	}
+	for i, size := range axes[0].Values {
+		variant := testProduct(1 + i)
+		variant.ParentID = parent.ID
+		variant.Options = map[string]string{"size": size}
+		if _, err := s.CreateVariant(parent.ID, variant); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	written := make(chan struct{})
+	err := s.ChangeCategories(func(change CategoryChange) error {
+		go func() {
+			product := testProduct(10)
+			product.Category = parent.Category
+			s.Create(product)
+			close(written)
+		}()
+		select {
+		case <-written:
+			t.Error("запись продукта выполнена во время изменения дерева категорий")
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		moved, err := change.ReassignCategory(parent.Category, "moved")
+		if err != nil {
+			return err
+		}
+		if moved != 1 {
+			t.Errorf("перенесено %d продуктов, ожидался 1", moved)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-written
+
+	if n := len(s.GetByCategory("moved")); n != 3 {
+		t.Fatalf("в новой категории %d продуктов, ожидалось 3 вместе с вариантами", n)
+	}
+	if n := len(s.GetByCategory(parent.Category)); n != 1 {
+		t.Fatalf("в старой категории %d продуктов, ожидался созданный после переноса", n)
+	}
+}
+
+// BenchmarkParallelUpdateStock измеряет параллельную запись в разные продукты
+func BenchmarkParallelUpdateStock(b *testing.B) {
+	const products = 10000
+	s := newTestStorage(b, products)
+	var next atomic.Int64
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			i := int(next.Add(1))
+			if err := s.UpdateStock(testProduct(i%products).ID, i%100); err != nil {
+				b.Error(err)
+			}
+		}
+	})
+}
+
+// BenchmarkParallelCreate измеряет параллельное создание продуктов
+func BenchmarkParallelCreate(b *testing.B) {
+	s := NewProductStorage()
+	var next atomic.Int64
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if err := s.Create(testProduct(int(next.Add(1)))); err != nil {
+				b.Error(err)
+			}
+		}
+	})
+}
+
+// BenchmarkParallelMixed измеряет чтение по ID вперемешку с записью, одна
+// операция из десяти — запись
+func BenchmarkParallelMixed(b *testing.B) {
+	const products = 10000
+	s := newTestStorage(b, products)
+	var next atomic.Int64
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			i := int(next.Add(1))
+			id := testProduct(i % products).ID
+			if i%10 == 0 {
+				s.UpdateStock(id, i%100)
+			} else {
+				s.GetByID(id)
+			}
+		}
+	})
+}
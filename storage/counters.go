@@ -0,0 +1,140 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultCounterFlushInterval задает период сброса накопленных счетчиков
+// просмотров и популярности в хранилище
+const DefaultCounterFlushInterval = 5 * time.Second
+
+// counterDelta хранит еще не сохраненные приращения счетчиков продукта
+type counterDelta struct {
+	views      int
+	popularity int
+}
+
+// counterBuffer накапливает приращения счетчиков продуктов одного сегмента.
+// У буфера своя блокировка, поэтому учет просмотра не ждет записи в
+// хранилище и не мешает ей.
+type counterBuffer struct {
+	deltas map[string]counterDelta
+	mu     sync.Mutex
+}
+
+func newCounterBuffers() []*counterBuffer {
+	buffers := make([]*counterBuffer, ShardCount)
+	for i := range buffers {
+		buffers[i] = &counterBuffer{deltas: make(map[string]counterDelta)}
+	}
+	return buffers
+}
+
+// add добавляет приращения счетчиков продукта
+func (b *counterBuffer) add(id string, delta counterDelta) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	current := b.deltas[id]
+	current.views += delta.views
+	current.popularity += delta.popularity
+	b.deltas[id] = current
+}
+
+// take забирает накопленные приращения
+func (b *counterBuffer) take() map[string]counterDelta {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	deltas := b.deltas
+	b.deltas = make(map[string]counterDelta)
+	return deltas
+}
+
+// IncrementCounters увеличивает счетчики просмотров и популярности продукта.
+// Счетчики меняются часто, поэтому приращения накапливаются в буфере
+// сегмента и сохраняются FlushCounters: до сброса они не видны при чтении
+// продукта, а учет не блокирует хранилище.
+func (s *ProductStorage) IncrementCounters(id string, views, popularity int) error {
+	sh := s.shardFor(id)
+	sh.mu.RLock()
+	_, exists := sh.products[id]
+	sh.mu.RUnlock()
+	if !exists {
+		return errors.New("продукт не найден")
+	}
+
+	s.counters[s.shardIndex(id)].add(id, counterDelta{views: views, popularity: popularity})
+	return nil
+}
+
+// FlushCounters сохраняет накопленные приращения счетчиков. Счетчики
+// каждого сегмента записываются одной транзакцией в ленту изменений, но не
+// порождают событий изменения продукта. Если запись не удалась, приращения
+// возвращаются в буфер до следующего сброса.
+func (s *ProductStorage) FlushCounters() error {
+	var flushErr error
+	for _, buffer := range s.counters {
+		deltas := buffer.take()
+		if len(deltas) == 0 {
+			continue
+		}
+		if err := s.flushCounters(deltas); err != nil {
+			for id, delta := range deltas {
+				buffer.add(id, delta)
+			}
+			flushErr = err
+		}
+	}
+	return flushErr
+}
+
+// flushCounters записывает приращения счетчиков продуктов одной транзакцией.
+// Приращения удаленных продуктов отбрасываются.
+func (s *ProductStorage) flushCounters(deltas map[string]counterDelta) error {
+	ids := make([]string, 0, len(deltas))
+	for id := range deltas {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	defer s.lockWrite(ids...)()
+
+	t := s.begin()
+	t.silent = true
+	for _, id := range ids {
+		product, exists := s.get(id)
+		if !exists {
+			continue
+		}
+		product.Views += deltas[id].views
+		product.Popularity += deltas[id].popularity
+		t.save(product)
+	}
+	return t.commit()
+}
+
+// RunCounterFlush сбрасывает накопленные счетчики с периодом interval до
+// отмены контекста, после которой сбрасывает их последний раз
+func (s *ProductStorage) RunCounterFlush(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			if err := s.FlushCounters(); err != nil {
+				log.Println("Не удалось сохранить счетчики продуктов:", err)
+			}
+			return
+		case <-ticker.C:
+			if err := s.FlushCounters(); err != nil {
+				log.Println("Не удалось сохранить счетчики продуктов:", err)
+			}
+		}
+	}
+}
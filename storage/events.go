@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/Afra1m/product_api/models"
+)
+
+// record записывает в outbox события изменений, записанных в ленту до
+// номера changeSeq включительно. Вызывается под блокировкой после того, как
+// транзакция записана в ленту и применена, поэтому события сохраняются тогда
+// и только тогда, когда применена вся транзакция.
+func (s *ProductStorage) record(changeSeq uint64, events ...models.ProductEvent) {
+	s.outbox.append(changeSeq, events...)
+}
+
+// changeEvents возвращает события перехода продукта из состояния oldProduct
+// (existed сообщает, существовал ли он) в состояние product, равное nil при
+// удалении
+func (s *ProductStorage) changeEvents(oldProduct models.Product, existed bool, product *models.Product) []models.ProductEvent {
+	switch {
+	case product != nil && existed:
+		return s.updatedEvents(oldProduct, *product)
+	case product != nil:
+		return s.createdEvents(*product)
+	case existed:
+		return s.deletedEvents(oldProduct)
+	}
+	return nil
+}
+
+// createdEvents возвращает события создания продукта
+func (s *ProductStorage) createdEvents(product models.Product) []models.ProductEvent {
+	events := []models.ProductEvent{newEvent(models.EventProductCreated, product, nil)}
+	if s.isLowStock(product, 0) {
+		events = append(events, newEvent(models.EventStockLow, product, nil))
+	}
+	return events
+}
+
+// updatedEvents возвращает события изменения продукта
+func (s *ProductStorage) updatedEvents(oldProduct, product models.Product) []models.ProductEvent {
+	events := []models.ProductEvent{newEvent(models.EventProductUpdated, product, &oldProduct)}
+	if oldProduct.Stock != product.Stock {
+		events = append(events, newEvent(models.EventStockChanged, product, &oldProduct))
+	}
+	if oldProduct.Price != product.Price {
+		events = append(events, newEvent(models.EventPriceChanged, product, &oldProduct))
+	}
+	// О низком запасе сообщаем только при переходе через порог
+	if s.isLowStock(product, 0) && !s.isLowStock(oldProduct, 0) {
+		events = append(events, newEvent(models.EventStockLow, product, &oldProduct))
+	}
+	return events
+}
+
+// deletedEvents возвращает события удаления продукта
+func (s *ProductStorage) deletedEvents(product models.Product) []models.ProductEvent {
+	return []models.ProductEvent{newEvent(models.EventProductDeleted, product, nil)}
+}
+
+func newEvent(eventType string, product models.Product, previous *models.Product) models.ProductEvent {
+	product = product.Clone()
+	if previous != nil {
+		clone := previous.Clone()
+		previous = &clone
+	}
+	return models.ProductEvent{
+		ID:        uuid.New().String(),
+		Type:      eventType,
+		ProductID: product.ID,
+		Product:   &product,
+		Previous:  previous,
+		Timestamp: time.Now(),
+	}
+}
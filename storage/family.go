@@ -0,0 +1,102 @@
+package storage
+
+import (
+	"time"
+
+	"github.com/Afra1m/product_api/models"
+)
+
+// Часть полей продукта выводится из связанных с ним продуктов: остаток
+// родителя — из остатков вариантов, название, категория и цена варианта —
+// из родителя, а остаток и расчетная цена набора — из компонентов.
+// Транзакция приводит эти поля в соответствие перед сохранением продукта
+// (applyFamily) и распространяет изменение на связанные продукты после него
+// (syncFamily), поэтому производные поля всех затронутых продуктов
+// записываются вместе с исходным изменением.
+
+// isStocked сообщает, что остаток продукта учитывается сам по себе, а не
+// выводится из остатков вариантов или компонентов
+func isStocked(product models.Product) bool {
+	return !product.IsVariantParent() && !product.IsBundle()
+}
+
+// hasComponent сообщает, что продукт является набором с компонентом id
+func hasComponent(product models.Product, id string) bool {
+	if !product.IsBundle() {
+		return false
+	}
+	for _, component := range product.Bundle.Components {
+		if component.ProductID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// applyFamily приводит производные поля продукта в соответствие со
+// связанными продуктами
+func (t *tx) applyFamily(product *models.Product) {
+	if product.IsVariantParent() {
+		stock := 0
+		for _, id := range t.variantIDs(product.ID) {
+			variant, _ := t.get(id)
+			stock += variant.Stock
+		}
+		product.Stock = stock
+	}
+	if product.IsVariant() {
+		if parent, exists := t.get(product.ParentID); exists {
+			product.ApplyParent(parent)
+		}
+	}
+	if product.IsBundle() {
+		available, componentsPrice := bundleTotals(*product.Bundle, t.get)
+		product.Stock = available
+		if product.Bundle.Pricing == models.BundlePricingDerived {
+			product.Price = product.Bundle.Price(componentsPrice)
+		}
+	}
+}
+
+// syncFamily распространяет изменение продукта на связанные продукты:
+// пересчитывает остаток родителя варианта и наборы, в которые входит
+// продукт, и обновляет варианты родителя
+func (t *tx) syncFamily(oldProduct, product models.Product) {
+	if oldProduct.IsVariant() && oldProduct.ParentID != product.ParentID {
+		t.refresh(oldProduct.ParentID)
+	}
+	if product.IsVariant() {
+		t.refresh(product.ParentID)
+	}
+
+	id := product.ID
+	if id == "" {
+		id = oldProduct.ID
+	}
+	for _, bundleID := range t.bundleIDs(id) {
+		t.refresh(bundleID)
+	}
+
+	if product.IsVariantParent() {
+		for _, variantID := range t.variantIDs(product.ID) {
+			t.refresh(variantID)
+		}
+	}
+}
+
+// refresh сохраняет продукт в транзакции, если его производные поля
+// разошлись со связанными продуктами
+func (t *tx) refresh(id string) {
+	oldProduct, exists := t.get(id)
+	if !exists {
+		return
+	}
+	product := oldProduct
+	t.applyFamily(&product)
+	if product.Stock == oldProduct.Stock && product.Price == oldProduct.Price &&
+		product.Name == oldProduct.Name && product.Category == oldProduct.Category {
+		return
+	}
+	product.UpdatedAt = time.Now()
+	t.stage(product)
+}
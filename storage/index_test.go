@@ -0,0 +1,381 @@
+package storage
+
+import (
+	"cmp"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Afra1m/product_api/models"
+	"github.com/Afra1m/product_api/skiplist"
+)
+
+// randomProduct возвращает продукт с номером i и случайными значениями
+// индексируемых полей из небольших наборов, чтобы ключи индексов совпадали
+func randomProduct(r *rand.Rand, i int) models.Product {
+	product := testProduct(i)
+	product.Category = fmt.Sprintf("c%d", r.Intn(4))
+	product.Tags = nil
+	for tag := 0; tag < 4; tag++ {
+		if r.Intn(3) == 0 {
+			product.Tags = append(product.Tags, fmt.Sprintf("t%d", tag))
+		}
+	}
+	product.Price = float64(r.Intn(10) + 1)
+	product.Stock = r.Intn(4)
+	product.Featured = r.Intn(3) == 0
+	if r.Intn(3) == 0 {
+		product.Discount = 10
+	}
+	product.SKU = fmt.Sprintf("SKU-%d", r.Intn(80))
+	product.Barcode = ""
+	if r.Intn(2) == 0 {
+		product.Barcode = fmt.Sprintf("BC-%d", r.Intn(80))
+	}
+	product.CreatedAt = time.Unix(int64(r.Intn(5)), 0)
+	return product
+}
+
+// TestIndexesMatchScan выполняет случайную последовательность записей, в том
+// числе отклоняемых, и после каждой сверяет все индексы хранилища с полным
+// обходом продуктов
+func TestIndexesMatchScan(t *testing.T) {
+	const (
+		steps = 3000
+		pool  = 60
+	)
+	r := rand.New(rand.NewSource(1))
+	s := NewProductStorage()
+	// Варианты получают номера из второй половины, чтобы не совпадать по ID
+	// с обычными продуктами
+	id := func() string {
+		return testProduct(r.Intn(2 * pool)).ID
+	}
+	batch := func() []models.Product {
+		products := make([]models.Product, 1+r.Intn(3))
+		for i := range products {
+			products[i] = randomProduct(r, r.Intn(pool))
+		}
+		return products
+	}
+
+	for step := 0; step < steps; step++ {
+		op := r.Intn(13)
+		switch op {
+		case 0:
+			s.Create(randomProduct(r, r.Intn(pool)))
+		case 1:
+			product := randomProduct(r, r.Intn(pool))
+			s.Update(product.ID, product)
+		case 2:
+			s.Delete(id())
+		case 3:
+			s.CreateBatch(batch())
+		case 4:
+			updates := make(map[string]models.Product)
+			for _, product := range batch() {
+				updates[product.ID] = product
+			}
+			s.UpdateBatch(updates)
+		case 5:
+			s.DeleteBatch([]string{id(), id()})
+		case 6:
+			s.UpsertBatch(batch())
+		case 7:
+			s.UpdateStock(id(), r.Intn(4))
+		case 8:
+			s.UpdateDiscount(id(), float64(r.Intn(2)*10))
+			s.UpdateFeature(id(), r.Intn(2) == 0)
+		case 9:
+			s.IncrementCounters(id(), 1+r.Intn(3), r.Intn(3))
+			if r.Intn(2) == 0 {
+				s.FlushCounters()
+			}
+		case 10:
+			parentID := id()
+			s.UpdateStock(parentID, 0)
+			axes := []models.VariantAxis{{Name: "size", Values: []string{"s", "m"}}}
+			if _, err := s.SetVariantAxes(parentID, axes); err == nil {
+				variant := randomProduct(r, pool+r.Intn(pool))
+				variant.ParentID = parentID
+				variant.Options = map[string]string{"size": axes[0].Values[r.Intn(2)]}
+				s.CreateVariant(parentID, variant)
+			}
+		case 11:
+			s.SetBundle(id(), &models.Bundle{
+				Components: []models.BundleComponent{{ProductID: id(), Quantity: 1 + r.Intn(2)}},
+				Pricing:    models.BundlePricingDerived,
+			})
+		case 12:
+			s.ReassignCategory(fmt.Sprintf("c%d", r.Intn(4)), fmt.Sprintf("c%d", r.Intn(4)))
+		}
+		checkIndexes(t, s, fmt.Sprintf("шаг %d, операция %d", step, op))
+	}
+}
+
+// TestGetSortedMatchesScan сверяет страницы GetSorted, выбранные по
+// упорядоченному индексу и по кандидатам вторичных индексов, с полным
+// обходом каталога
+func TestGetSortedMatchesScan(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+	s := NewProductStorage()
+	for i := 0; i < 300; i++ {
+		s.Create(randomProduct(r, i))
+	}
+
+	minPrice, maxPrice := 3.0, 7.0
+	inStock, featured := true, true
+	filters := []models.ProductFilter{
+		{},
+		{Category: "c1"},
+		{Category: "c2", Tag: "t1"},
+		{Category: "c3", Featured: &featured},
+		{MinPrice: &minPrice, MaxPrice: &maxPrice},
+		{InStock: &inStock, Tag: "t0"},
+	}
+	for _, filter := range filters {
+		for _, desc := range []bool{false, true} {
+			for _, page := range [][2]int{{0, 0}, {0, 5}, {7, 10}, {1000, 10}} {
+				got, err := s.GetSorted(SortPrice, desc, filter, page[0], page[1])
+				if err != nil {
+					t.Fatal(err)
+				}
+				want := scanSorted(s, desc, filter, page[0], page[1])
+				if !reflect.DeepEqual(productIDs(got), productIDs(want)) {
+					t.Fatalf("фильтр %+v, desc %v, страница %v: %v, ожидалось %v",
+						filter, desc, page, productIDs(got), productIDs(want))
+				}
+			}
+		}
+	}
+}
+
+// checkIndexes сверяет индексы хранилища с полным обходом продуктов
+func checkIndexes(t *testing.T, s *ProductStorage, step string) {
+	t.Helper()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	products := s.all()
+	skus := make(map[string]string)
+	barcodes := make(map[string]string)
+	fields := newFieldIndexes()
+	for _, product := range products {
+		if product.SKU != "" {
+			skus[product.SKU] = product.ID
+		}
+		if product.Barcode != "" {
+			barcodes[product.Barcode] = product.ID
+		}
+		addToSet(fields.byCategory, product.Category, product.ID)
+		for _, tag := range product.Tags {
+			addToSet(fields.byTag, tag, product.ID)
+		}
+		if product.IsVariant() {
+			addToSet(fields.byParent, product.ParentID, product.ID)
+		}
+		if product.IsBundle() {
+			for _, component := range product.Bundle.Components {
+				addToSet(fields.byComponent, component.ProductID, product.ID)
+			}
+		}
+		if product.Featured {
+			fields.featured[product.ID] = struct{}{}
+		}
+		if product.Discount > 0 {
+			fields.discounted[product.ID] = struct{}{}
+		}
+	}
+
+	if len(skus) != len(s.bySKU) || (len(skus) > 0 && !reflect.DeepEqual(skus, s.bySKU)) {
+		t.Fatalf("%s: индекс SKU %v, по продуктам %v", step, s.bySKU, skus)
+	}
+	if len(barcodes) != len(s.byBarcode) || (len(barcodes) > 0 && !reflect.DeepEqual(barcodes, s.byBarcode)) {
+		t.Fatalf("%s: индекс штрихкодов %v, по продуктам %v", step, s.byBarcode, barcodes)
+	}
+	if !reflect.DeepEqual(fields, s.fields) {
+		t.Fatalf("%s: индексы полей %v, по продуктам %v", step, s.fields, fields)
+	}
+
+	checkSorted(t, step, "popularity", s.sorted.popularity, products, func(p models.Product) int { return p.Popularity })
+	checkSorted(t, step, "views", s.sorted.views, products, func(p models.Product) int { return p.Views })
+	checkSorted(t, step, "created_at", s.sorted.createdAt, products, func(p models.Product) int64 { return p.CreatedAt.UnixNano() })
+	checkSorted(t, step, "price", s.sorted.price, products, func(p models.Product) float64 { return p.Price })
+	checkSorted(t, step, "stock", s.sorted.stock, products, func(p models.Product) int { return p.Stock })
+}
+
+// checkSorted сверяет упорядоченный индекс с продуктами, отсортированными
+// по ключу key и ID, в обоих направлениях обхода
+func checkSorted[K cmp.Ordered](t *testing.T, step, name string, index *skiplist.List[K], products []models.Product, key func(models.Product) K) {
+	t.Helper()
+	sorted := append([]models.Product(nil), products...)
+	sort.Slice(sorted, func(i, j int) bool {
+		if c := cmp.Compare(key(sorted[i]), key(sorted[j])); c != 0 {
+			return c < 0
+		}
+		return sorted[i].ID < sorted[j].ID
+	})
+	want := make([]string, len(sorted))
+	for i, product := range sorted {
+		want[i] = product.ID
+	}
+
+	var ascending, descending []string
+	index.Ascend(func(id string) bool {
+		ascending = append(ascending, id)
+		return true
+	})
+	index.Descend(func(id string) bool {
+		descending = append([]string{id}, descending...)
+		return true
+	})
+	if index.Len() != len(want) || !equalStrings(ascending, want) || !equalStrings(descending, want) {
+		t.Fatalf("%s: индекс %s содержит %v (в обратном порядке %v, длина %d), по продуктам %v",
+			step, name, ascending, descending, index.Len(), want)
+	}
+}
+
+// benchmarkProducts задает размер каталога для сравнения выборок по индексам
+// с полным обходом
+const benchmarkProducts = 100000
+
+var (
+	benchmarkStorage     *ProductStorage
+	benchmarkStorageOnce sync.Once
+)
+
+// newBenchmarkStorage возвращает общее для бенчмарков хранилище с
+// benchmarkProducts продуктами. Популярность продуктов различается, чтобы
+// индекс популярности не вырождался в порядок по ID.
+func newBenchmarkStorage(b *testing.B) *ProductStorage {
+	benchmarkStorageOnce.Do(func() {
+		benchmarkStorage = NewProductStorage()
+		products := make([]models.Product, benchmarkProducts)
+		for i := range products {
+			products[i] = testProduct(i)
+			products[i].Popularity = i * 7919 % 1000
+		}
+		if err := benchmarkStorage.CreateBatch(products); err != nil {
+			b.Fatal(err)
+		}
+	})
+	return benchmarkStorage
+}
+
+// scanSorted выбирает продукты так же, как GetSorted по цене, но полным
+// обходом каталога с сортировкой
+func scanSorted(s *ProductStorage, desc bool, filter models.ProductFilter, offset, limit int) []models.Product {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var matched []models.Product
+	for _, product := range s.all() {
+		if filter.Matches(product) {
+			matched = append(matched, product)
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool {
+		if matched[i].Price != matched[j].Price {
+			return (matched[i].Price < matched[j].Price) != desc
+		}
+		return (matched[i].ID < matched[j].ID) != desc
+	})
+
+	products := []models.Product{}
+	for i := offset; i < len(matched) && (limit <= 0 || len(products) < limit); i++ {
+		products = append(products, matched[i].Clone())
+	}
+	return products
+}
+
+// scanFiltered выбирает продукты так же, как GetFiltered, но полным обходом
+// каталога
+func scanFiltered(s *ProductStorage, filter models.ProductFilter) []models.Product {
+	products := []models.Product{}
+	s.forEachShard(func(product models.Product) {
+		if filter.Matches(product) {
+			products = append(products, product.Clone())
+		}
+	})
+	return products
+}
+
+// BenchmarkGetSorted сравнивает страницу выборки по индексу цены с полным
+// обходом и сортировкой каталога
+func BenchmarkGetSorted(b *testing.B) {
+	s := newBenchmarkStorage(b)
+	cases := []struct {
+		name   string
+		filter models.ProductFilter
+	}{
+		{"all", models.ProductFilter{}},
+		{"category", models.ProductFilter{Category: "c1"}},
+	}
+	for _, c := range cases {
+		b.Run(c.name+"/index", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				s.GetSorted(SortPrice, true, c.filter, 100, 20)
+			}
+		})
+		b.Run(c.name+"/scan", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				scanSorted(s, true, c.filter, 100, 20)
+			}
+		})
+	}
+}
+
+// BenchmarkGetFiltered сравнивает страницу списка с фильтром, кандидаты
+// которой берутся из вторичного индекса, с полным обходом и сортировкой
+// каталога
+func BenchmarkGetFiltered(b *testing.B) {
+	s := newBenchmarkStorage(b)
+	minPrice, maxPrice := 10.0, 12.0
+	inStock := false
+	featured := true
+	cases := []struct {
+		name   string
+		filter models.ProductFilter
+	}{
+		{"category_tag", models.ProductFilter{Category: "c1", Tag: "t3"}},
+		{"featured_category", models.ProductFilter{Category: "c1", Featured: &featured}},
+		{"price_range", models.ProductFilter{MinPrice: &minPrice, MaxPrice: &maxPrice}},
+		{"out_of_stock", models.ProductFilter{InStock: &inStock}},
+	}
+	for _, c := range cases {
+		b.Run(c.name+"/index", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				s.GetSorted(SortPrice, true, c.filter, 0, 20)
+			}
+		})
+		b.Run(c.name+"/scan", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				scanSorted(s, true, c.filter, 0, 20)
+			}
+		})
+	}
+}
+
+// BenchmarkGetPopular сравнивает первые продукты по популярности из индекса
+// с полным обходом каталога
+func BenchmarkGetPopular(b *testing.B) {
+	s := newBenchmarkStorage(b)
+	b.Run("index", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			s.GetPopular(20)
+		}
+	})
+	b.Run("scan", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			products := scanFiltered(s, models.ProductFilter{})
+			sort.Slice(products, func(i, j int) bool {
+				return products[i].Popularity > products[j].Popularity
+			})
+			_ = products[:20]
+		}
+	})
+}
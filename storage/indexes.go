@@ -0,0 +1,313 @@
+package storage
+
+import (
+	"cmp"
+	"errors"
+	"sort"
+
+	"github.com/Afra1m/product_api/models"
+	"github.com/Afra1m/product_api/skiplist"
+)
+
+// Поля, по которым хранилище поддерживает упорядоченную выборку
+const (
+	SortPopularity = "popularity"
+	SortViews      = "views"
+	SortCreatedAt  = "created_at"
+	SortPrice      = "price"
+)
+
+// sortIndexes содержит упорядоченные индексы продуктов. Индекс остатков
+// служит и для выборки по корзинам запаса: отсутствующие, в наличии и с
+// запасом не выше порога.
+type sortIndexes struct {
+	popularity *skiplist.List[int]
+	views      *skiplist.List[int]
+	createdAt  *skiplist.List[int64]
+	price      *skiplist.List[float64]
+	stock      *skiplist.List[int]
+}
+
+// idSet является множеством ID продуктов
+type idSet map[string]struct{}
+
+// fieldIndexes содержит вторичные индексы продуктов по значениям полей.
+// byParent связывает родительский продукт с его вариантами, а byComponent —
+// компонент с наборами, в которые он входит.
+type fieldIndexes struct {
+	byCategory  map[string]idSet
+	byTag       map[string]idSet
+	byParent    map[string]idSet
+	byComponent map[string]idSet
+	featured    idSet
+	discounted  idSet
+}
+
+func newFieldIndexes() fieldIndexes {
+	return fieldIndexes{
+		byCategory:  make(map[string]idSet),
+		byTag:       make(map[string]idSet),
+		byParent:    make(map[string]idSet),
+		byComponent: make(map[string]idSet),
+		featured:    make(idSet),
+		discounted:  make(idSet),
+	}
+}
+
+func addToSet(sets map[string]idSet, key, id string) {
+	set, exists := sets[key]
+	if !exists {
+		set = make(idSet)
+		sets[key] = set
+	}
+	set[id] = struct{}{}
+}
+
+func removeFromSet(sets map[string]idSet, key, id string) {
+	if set, exists := sets[key]; exists {
+		delete(set, id)
+		if len(set) == 0 {
+			delete(sets, key)
+		}
+	}
+}
+
+func newSortIndexes() sortIndexes {
+	return sortIndexes{
+		popularity: skiplist.New[int](),
+		views:      skiplist.New[int](),
+		createdAt:  skiplist.New[int64](),
+		price:      skiplist.New[float64](),
+		stock:      skiplist.New[int](),
+	}
+}
+
+// index добавляет продукт во все индексы. Вызывается под блокировкой в том
+// же шаге записи, что и изменение карты продуктов, поэтому индексы всегда
+// согласованы с ней.
+func (s *ProductStorage) index(product models.Product) {
+	s.indexKeys(product)
+	addToSet(s.fields.byCategory, product.Category, product.ID)
+	for _, tag := range product.Tags {
+		addToSet(s.fields.byTag, tag, product.ID)
+	}
+	if product.IsVariant() {
+		addToSet(s.fields.byParent, product.ParentID, product.ID)
+	}
+	if product.IsBundle() {
+		for _, component := range product.Bundle.Components {
+			addToSet(s.fields.byComponent, component.ProductID, product.ID)
+		}
+	}
+	if product.Featured {
+		s.fields.featured[product.ID] = struct{}{}
+	}
+	if product.Discount > 0 {
+		s.fields.discounted[product.ID] = struct{}{}
+	}
+	s.sorted.popularity.Insert(product.Popularity, product.ID)
+	s.sorted.views.Insert(product.Views, product.ID)
+	s.sorted.createdAt.Insert(product.CreatedAt.UnixNano(), product.ID)
+	s.sorted.price.Insert(product.Price, product.ID)
+	s.sorted.stock.Insert(product.Stock, product.ID)
+}
+
+// unindex удаляет продукт из всех индексов. Вызывается под блокировкой.
+func (s *ProductStorage) unindex(product models.Product) {
+	s.unindexKeys(product)
+	removeFromSet(s.fields.byCategory, product.Category, product.ID)
+	for _, tag := range product.Tags {
+		removeFromSet(s.fields.byTag, tag, product.ID)
+	}
+	removeFromSet(s.fields.byParent, product.ParentID, product.ID)
+	if product.IsBundle() {
+		for _, component := range product.Bundle.Components {
+			removeFromSet(s.fields.byComponent, component.ProductID, product.ID)
+		}
+	}
+	delete(s.fields.featured, product.ID)
+	delete(s.fields.discounted, product.ID)
+	s.sorted.popularity.Remove(product.Popularity, product.ID)
+	s.sorted.views.Remove(product.Views, product.ID)
+	s.sorted.createdAt.Remove(product.CreatedAt.UnixNano(), product.ID)
+	s.sorted.price.Remove(product.Price, product.ID)
+	s.sorted.stock.Remove(product.Stock, product.ID)
+}
+
+// scanIndexed вызывает fn для кандидатов из самого узкого индекса,
+// подходящего фильтру: наименьшего из множеств по категории, тегу и
+// рекомендации, иначе диапазона цен или корзины запаса. Кандидаты еще
+// нужно проверить фильтром. Если подходящего индекса нет, возвращает false.
+// Вызывается под блокировкой.
+func (s *ProductStorage) scanIndexed(filter models.ProductFilter, fn func(product models.Product)) bool {
+	visit := func(id string) bool {
+		product, _ := s.get(id)
+		fn(product)
+		return true
+	}
+
+	var candidates idSet
+	narrowed := false
+	narrow := func(set idSet) {
+		if !narrowed || len(set) < len(candidates) {
+			candidates, narrowed = set, true
+		}
+	}
+	if filter.Category != "" {
+		narrow(s.fields.byCategory[filter.Category])
+	}
+	if filter.Tag != "" {
+		narrow(s.fields.byTag[filter.Tag])
+	}
+	if filter.Featured != nil && *filter.Featured {
+		narrow(s.fields.featured)
+	}
+
+	switch {
+	case narrowed:
+		for id := range candidates {
+			visit(id)
+		}
+	case filter.MinPrice != nil || filter.MaxPrice != nil:
+		s.sorted.price.AscendRange(filter.MinPrice, filter.MaxPrice, visit)
+	case filter.InStock != nil:
+		inStock, outOfStock := 1, 0
+		if *filter.InStock {
+			s.sorted.stock.AscendRange(&inStock, nil, visit)
+		} else {
+			s.sorted.stock.AscendRange(nil, &outOfStock, visit)
+		}
+	default:
+		return false
+	}
+	return true
+}
+
+// collect возвращает продукты с указанными ID
+func (s *ProductStorage) collect(ids idSet) []models.Product {
+	var products []models.Product
+	for id := range ids {
+		product, _ := s.get(id)
+		products = append(products, product.Clone())
+	}
+	return products
+}
+
+// stockRange возвращает продукты с остатком от from до to включительно,
+// удовлетворяющие условию match
+func (s *ProductStorage) stockRange(from, to *int, match func(product models.Product) bool) []models.Product {
+	var products []models.Product
+	s.sorted.stock.AscendRange(from, to, func(id string) bool {
+		if product, _ := s.get(id); match == nil || match(product) {
+			products = append(products, product.Clone())
+		}
+		return true
+	})
+	return products
+}
+
+// walkSorted обходит ID продуктов в порядке поля field, пока fn возвращает
+// true. Вызывается под блокировкой.
+func (s *ProductStorage) walkSorted(field string, desc bool, fn func(id string) bool) error {
+	var ascend, descend func(func(string) bool)
+	switch field {
+	case SortPopularity:
+		ascend, descend = s.sorted.popularity.Ascend, s.sorted.popularity.Descend
+	case SortViews:
+		ascend, descend = s.sorted.views.Ascend, s.sorted.views.Descend
+	case SortCreatedAt:
+		ascend, descend = s.sorted.createdAt.Ascend, s.sorted.createdAt.Descend
+	case SortPrice:
+		ascend, descend = s.sorted.price.Ascend, s.sorted.price.Descend
+	default:
+		return errors.New("сортировка по полю " + field + " не поддерживается")
+	}
+
+	if desc {
+		descend(fn)
+	} else {
+		ascend(fn)
+	}
+	return nil
+}
+
+// GetSorted возвращает продукты, удовлетворяющие фильтру, в порядке поля
+// field, а при равенстве — ID, пропуская первые offset. Если limit
+// положителен, возвращается не больше limit продуктов. Если фильтру
+// подходит вторичный индекс (см. scanIndexed), упорядочиваются только его
+// кандидаты; иначе обходится упорядоченный индекс поля, и обход
+// останавливается на limit продуктах.
+func (s *ProductStorage) GetSorted(field string, desc bool, filter models.ProductFilter, offset, limit int) ([]models.Product, error) {
+	compare, err := compareBy(field)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var matched []models.Product
+	indexed := s.scanIndexed(filter, func(product models.Product) {
+		if filter.Matches(product) {
+			matched = append(matched, product)
+		}
+	})
+	if indexed {
+		sort.Slice(matched, func(i, j int) bool {
+			return (compare(matched[i], matched[j]) < 0) != desc
+		})
+		products := []models.Product{}
+		for i := offset; i < len(matched) && (limit <= 0 || len(products) < limit); i++ {
+			products = append(products, matched[i].Clone())
+		}
+		return products, nil
+	}
+
+	products := []models.Product{}
+	err = s.walkSorted(field, desc, func(id string) bool {
+		product, _ := s.get(id)
+		if !filter.Matches(product) {
+			return true
+		}
+		if offset > 0 {
+			offset--
+			return true
+		}
+		products = append(products, product.Clone())
+		return limit <= 0 || len(products) < limit
+	})
+	return products, err
+}
+
+// compareBy возвращает сравнение продуктов по полю field и ID в том же
+// порядке, что и упорядоченный индекс поля
+func compareBy(field string) (func(a, b models.Product) int, error) {
+	var key func(a, b models.Product) int
+	switch field {
+	case SortPopularity:
+		key = func(a, b models.Product) int { return cmp.Compare(a.Popularity, b.Popularity) }
+	case SortViews:
+		key = func(a, b models.Product) int { return cmp.Compare(a.Views, b.Views) }
+	case SortCreatedAt:
+		key = func(a, b models.Product) int { return cmp.Compare(a.CreatedAt.UnixNano(), b.CreatedAt.UnixNano()) }
+	case SortPrice:
+		key = func(a, b models.Product) int { return cmp.Compare(a.Price, b.Price) }
+	default:
+		return nil, errors.New("сортировка по полю " + field + " не поддерживается")
+	}
+	return func(a, b models.Product) int {
+		if c := key(a, b); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.ID, b.ID)
+	}, nil
+}
+
+// topSorted возвращает первые limit продуктов в порядке убывания поля field
+func (s *ProductStorage) topSorted(field string, limit int) []models.Product {
+	if limit <= 0 {
+		return []models.Product{}
+	}
+	products, _ := s.GetSorted(field, true, models.ProductFilter{}, 0, limit)
+	return products
+}
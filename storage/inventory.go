@@ -0,0 +1,182 @@
+package storage
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/Afra1m/product_api/models"
+)
+
+// DefaultReorderPoint используется, если точка перезаказа не задана ни для продукта, ни для категории
+const DefaultReorderPoint = 10
+
+// GetPolicies возвращает политики запасов всех категорий
+func (s *ProductStorage) GetPolicies() []models.InventoryPolicy {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	policies := make([]models.InventoryPolicy, 0, len(s.policies))
+	for _, policy := range s.policies {
+		policies = append(policies, policy)
+	}
+	sort.Slice(policies, func(i, j int) bool {
+		return policies[i].Category < policies[j].Category
+	})
+	return policies
+}
+
+// SetPolicy устанавливает политику запасов категории
+func (s *ProductStorage) SetPolicy(policy models.InventoryPolicy) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.policies[policy.Category] = policy
+}
+
+// DeletePolicy удаляет политику запасов категории
+func (s *ProductStorage) DeletePolicy(category string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.policies[category]; !exists {
+		return errors.New("политика для категории не найдена")
+	}
+	delete(s.policies, category)
+	return nil
+}
+
+// GetReorderReport возвращает продукты, запас которых опустился до точки перезаказа,
+// с рекомендуемым количеством для заказа. Скорость расхода считается по истории
+// изменений остатка за последние windowDays дней, заказ рассчитывается на coverDays дней.
+func (s *ProductStorage) GetReorderReport(category string, windowDays, coverDays int) models.ReorderReport {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := time.Now()
+	report := models.ReorderReport{
+		GeneratedAt: now,
+		WindowDays:  windowDays,
+		CoverDays:   coverDays,
+		Items:       []models.ReorderReportItem{},
+	}
+
+	since := now.AddDate(0, 0, -windowDays)
+	for _, product := range s.all() {
+		if (category != "" && product.Category != category) || !isStocked(product) {
+			continue
+		}
+
+		policy := s.resolvePolicy(product)
+		if product.Stock > policy.ReorderPoint {
+			continue
+		}
+
+		velocity := stockVelocity(product.History, since, windowDays)
+		target := policy.ReorderPoint + policy.SafetyStock + int(math.Ceil(velocity*float64(coverDays)))
+		suggested := target - product.Stock
+		if suggested < 0 {
+			suggested = 0
+		}
+
+		item := models.ReorderReportItem{
+			ProductID:         product.ID,
+			Name:              product.Name,
+			SKU:               product.SKU,
+			Category:          product.Category,
+			Stock:             product.Stock,
+			ReorderPoint:      policy.ReorderPoint,
+			SafetyStock:       policy.SafetyStock,
+			DailyVelocity:     velocity,
+			SuggestedQuantity: suggested,
+		}
+		if velocity > 0 {
+			days := float64(product.Stock) / velocity
+			item.DaysOfCover = &days
+		}
+		report.Items = append(report.Items, item)
+	}
+
+	// Сначала товары, которые закончатся раньше всего по текущему расходу.
+	// Товары без расхода идут после них, глубже всего ушедшие под точку
+	// перезаказа — первыми.
+	sort.Slice(report.Items, func(i, j int) bool {
+		a, b := report.Items[i], report.Items[j]
+		if (a.DaysOfCover == nil) != (b.DaysOfCover == nil) {
+			return a.DaysOfCover != nil
+		}
+		if a.DaysOfCover != nil && *a.DaysOfCover != *b.DaysOfCover {
+			return *a.DaysOfCover < *b.DaysOfCover
+		}
+		if a.Stock-a.ReorderPoint != b.Stock-b.ReorderPoint {
+			return a.Stock-a.ReorderPoint < b.Stock-b.ReorderPoint
+		}
+		return a.Name < b.Name
+	})
+	return report
+}
+
+// resolvePolicy определяет точку перезаказа и страховой запас продукта.
+// Значения продукта имеют приоритет над политикой категории, а если не задано
+// ни то, ни другое, используется DefaultReorderPoint. Вызывается под блокировкой.
+func (s *ProductStorage) resolvePolicy(product models.Product) models.InventoryPolicy {
+	policy := models.InventoryPolicy{
+		Category:     product.Category,
+		ReorderPoint: DefaultReorderPoint,
+	}
+	if categoryPolicy, exists := s.policies[product.Category]; exists {
+		if categoryPolicy.ReorderPoint > 0 {
+			policy.ReorderPoint = categoryPolicy.ReorderPoint
+		}
+		policy.SafetyStock = categoryPolicy.SafetyStock
+	}
+	if product.ReorderPoint > 0 {
+		policy.ReorderPoint = product.ReorderPoint
+	}
+	if product.SafetyStock > 0 {
+		policy.SafetyStock = product.SafetyStock
+	}
+	return policy
+}
+
+// isLowStock сообщает, что продукт в наличии, но его запас не выше порога.
+// Нулевой запас считается отсутствием товара, а не низким запасом.
+// Если threshold не положителен, порог берется из resolvePolicy.
+func (s *ProductStorage) isLowStock(product models.Product, threshold int) bool {
+	if threshold <= 0 {
+		threshold = s.resolvePolicy(product).ReorderPoint
+	}
+	return product.Stock > 0 && product.Stock <= threshold
+}
+
+// stockVelocity возвращает средний дневной расход товара по истории изменений остатка
+func stockVelocity(history []models.ProductHistory, since time.Time, windowDays int) float64 {
+	if windowDays <= 0 {
+		return 0
+	}
+
+	consumed := 0
+	for _, entry := range history {
+		if entry.Field != "stock" || entry.Timestamp.Before(since) {
+			continue
+		}
+		oldStock, okOld := toInt(entry.OldValue)
+		newStock, okNew := toInt(entry.NewValue)
+		if okOld && okNew && newStock < oldStock {
+			consumed += oldStock - newStock
+		}
+	}
+	return float64(consumed) / float64(windowDays)
+}
+
+func toInt(value interface{}) (int, bool) {
+	switch v := value.(type) {
+	case int:
+		return v, true
+	case float64:
+		return int(v), true
+	default:
+		return 0, false
+	}
+}
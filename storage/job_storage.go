@@ -0,0 +1,109 @@
+package storage
+
+import (
+	"errors"
+	"sort"
+	"sync"
+
+	"github.com/Afra1m/product_api/models"
+)
+
+// JobStorage представляет собой хранилище фоновых задач и их отчетов об ошибках.
+// Завершенные задачи остаются в хранилище для последующего просмотра.
+type JobStorage struct {
+	jobs   map[string]models.Job
+	errors map[string][]models.ImportRowError
+	mu     sync.RWMutex
+}
+
+// NewJobStorage создает новое хранилище задач
+func NewJobStorage() *JobStorage {
+	return &JobStorage{
+		jobs:   make(map[string]models.Job),
+		errors: make(map[string][]models.ImportRowError),
+	}
+}
+
+// GetAll возвращает все задачи, начиная с самых новых
+func (s *JobStorage) GetAll() []models.Job {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	jobs := make([]models.Job, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		jobs = append(jobs, job)
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt.After(jobs[j].CreatedAt)
+	})
+	return jobs
+}
+
+// GetByID возвращает задачу по ID
+func (s *JobStorage) GetByID(id string) (models.Job, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	job, exists := s.jobs[id]
+	if !exists {
+		return models.Job{}, errors.New("задача не найдена")
+	}
+	return job, nil
+}
+
+// Create сохраняет новую задачу
+func (s *JobStorage) Create(job models.Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.jobs[job.ID]; exists {
+		return errors.New("задача с таким ID уже существует")
+	}
+
+	s.jobs[job.ID] = job
+	return nil
+}
+
+// Update изменяет задачу функцией update. Завершенная задача не изменяется.
+func (s *JobStorage) Update(id string, update func(job *models.Job)) (models.Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, exists := s.jobs[id]
+	if !exists {
+		return models.Job{}, errors.New("задача не найдена")
+	}
+	if job.Finished() {
+		return job, errors.New("задача уже завершена")
+	}
+
+	update(&job)
+	s.jobs[id] = job
+	return job, nil
+}
+
+// AppendErrors добавляет ошибки строк в отчет задачи
+func (s *JobStorage) AppendErrors(id string, rowErrors []models.ImportRowError) {
+	if len(rowErrors) == 0 {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.errors[id] = append(s.errors[id], rowErrors...)
+}
+
+// GetErrors возвращает отчет об ошибках задачи
+func (s *JobStorage) GetErrors(id string) ([]models.ImportRowError, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, exists := s.jobs[id]; !exists {
+		return nil, errors.New("задача не найдена")
+	}
+
+	rowErrors := make([]models.ImportRowError, len(s.errors[id]))
+	copy(rowErrors, s.errors[id])
+	return rowErrors, nil
+}
@@ -0,0 +1,172 @@
+package storage
+
+import (
+	"errors"
+
+	"github.com/Afra1m/product_api/models"
+)
+
+// SKU и штрихкод являются естественными ключами продукта: непустое значение
+// может принадлежать только одному продукту. Индексы ключей обновляются
+// транзакцией вместе с самим продуктом.
+
+// Ошибки нарушения уникальности естественных ключей
+var (
+	ErrDuplicateSKU     = errors.New("продукт с таким SKU уже существует")
+	ErrDuplicateBarcode = errors.New("продукт с таким штрихкодом уже существует")
+)
+
+// IsConflict сообщает, что ошибка вызвана нарушением уникальности ключа
+func IsConflict(err error) bool {
+	return errors.Is(err, ErrDuplicateSKU) || errors.Is(err, ErrDuplicateBarcode)
+}
+
+// GetBySKU возвращает продукт по SKU
+func (s *ProductStorage) GetBySKU(sku string) (models.Product, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	id, exists := s.bySKU[sku]
+	if sku == "" || !exists {
+		return models.Product{}, errors.New("продукт не найден")
+	}
+	product, _ := s.get(id)
+	return product.Clone(), nil
+}
+
+// GetByBarcode возвращает продукт по штрихкоду
+func (s *ProductStorage) GetByBarcode(barcode string) (models.Product, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	id, exists := s.byBarcode[barcode]
+	if barcode == "" || !exists {
+		return models.Product{}, errors.New("продукт не найден")
+	}
+	product, _ := s.get(id)
+	return product.Clone(), nil
+}
+
+// Upsert обновляет продукт с SKU product.SKU или создает новый, если такого
+// SKU нет или он не задан. Обновляемый продукт сохраняет ID, дату создания,
+// счетчики и историю.
+func (s *ProductStorage) Upsert(product models.Product) (models.UpsertResult, error) {
+	defer s.lockUpsert(product)()
+
+	t := s.begin()
+	result, err := t.upsert(product)
+	if err != nil {
+		return models.UpsertResult{}, err
+	}
+	return result, t.commit()
+}
+
+// upsert сопоставляет продукт с существующим по SKU, учитывая продукты,
+// уже сохраненные в транзакции. Обновленный продукт сохраняет связи с
+// вариантами и состав набора.
+func (t *tx) upsert(product models.Product) (models.UpsertResult, error) {
+	id, exists := t.ownerOfSKU(product.SKU)
+	if !exists {
+		if _, exists := t.get(product.ID); exists {
+			return models.UpsertResult{}, errors.New("продукт с ID " + product.ID + " уже существует")
+		}
+		t.save(product)
+		return models.UpsertResult{Product: product, Created: true}, nil
+	}
+
+	oldProduct, _ := t.get(id)
+	product.ID = oldProduct.ID
+	product.CreatedAt = oldProduct.CreatedAt
+	product.Popularity = oldProduct.Popularity
+	product.Views = oldProduct.Views
+	product.ParentID = oldProduct.ParentID
+	product.VariantAxes = oldProduct.VariantAxes
+	product.Options = oldProduct.Options
+	product.PriceOverride = oldProduct.PriceOverride
+	product.Bundle = oldProduct.Bundle
+	t.applyFamily(&product)
+	product.History = changeHistory(oldProduct, product)
+	t.save(product)
+	return models.UpsertResult{Product: product}, nil
+}
+
+// ownerOfSKU возвращает ID продукта с указанным непустым SKU с учетом
+// изменений транзакции
+func (t *tx) ownerOfSKU(sku string) (string, bool) {
+	if sku == "" {
+		return "", false
+	}
+	if id, staged := t.skus[sku]; staged {
+		return id, true
+	}
+	id, exists := t.s.bySKU[sku]
+	if !exists {
+		return "", false
+	}
+	if product, staged := t.staged[id]; staged && (product == nil || product.SKU != sku) {
+		return "", false
+	}
+	return id, true
+}
+
+// checkKeys проверяет, что SKU и штрихкоды сохраняемых продуктов не заняты
+// другими продуктами ни в хранилище, ни в самой транзакции
+func (t *tx) checkKeys() error {
+	skus := make(map[string]string)
+	barcodes := make(map[string]string)
+	for _, id := range t.order {
+		product := t.staged[id]
+		if product == nil {
+			continue
+		}
+		if t.keyTaken(t.s.bySKU, skus, product.SKU, id, func(p models.Product) string { return p.SKU }) {
+			return ErrDuplicateSKU
+		}
+		if t.keyTaken(t.s.byBarcode, barcodes, product.Barcode, id, func(p models.Product) string { return p.Barcode }) {
+			return ErrDuplicateBarcode
+		}
+	}
+	return nil
+}
+
+// keyTaken сообщает, что непустой ключ key продукта id уже принадлежит
+// другому продукту: сохраненному ранее в транзакции (claimed) или
+// владельцу из индекса owners, если транзакция не освобождает этот ключ
+func (t *tx) keyTaken(owners, claimed map[string]string, key, id string, keyOf func(product models.Product) string) bool {
+	if key == "" {
+		return false
+	}
+	if owner, exists := claimed[key]; exists && owner != id {
+		return true
+	}
+	claimed[key] = id
+
+	owner, exists := owners[key]
+	if !exists || owner == id {
+		return false
+	}
+	if product, staged := t.staged[owner]; staged {
+		return product != nil && keyOf(*product) == key
+	}
+	return true
+}
+
+// indexKeys добавляет ключи продукта в индексы
+func (s *ProductStorage) indexKeys(product models.Product) {
+	if product.SKU != "" {
+		s.bySKU[product.SKU] = product.ID
+	}
+	if product.Barcode != "" {
+		s.byBarcode[product.Barcode] = product.ID
+	}
+}
+
+// unindexKeys удаляет ключи продукта из индексов
+func (s *ProductStorage) unindexKeys(product models.Product) {
+	if s.bySKU[product.SKU] == product.ID {
+		delete(s.bySKU, product.SKU)
+	}
+	if s.byBarcode[product.Barcode] == product.ID {
+		delete(s.byBarcode, product.Barcode)
+	}
+}
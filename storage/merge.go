@@ -0,0 +1,128 @@
+package storage
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/Afra1m/product_api/models"
+)
+
+// Ошибки слияния продуктов, связанных с другими продуктами
+var (
+	ErrMergeSource = errors.New("источник слияния не может иметь вариантов, быть набором или входить в набор")
+	ErrMergeTarget = errors.New("остаток итогового продукта слияния не может выводиться из вариантов или компонентов")
+)
+
+// Merge сливает продукты sourceIDs в продукт targetID. Продукт targetID
+// сохраняет свои значения; пустые поля заполняются значениями источников,
+// теги объединяются, запасы, популярность и просмотры суммируются. История
+// источников переносится в итоговый продукт вместе с записями о слиянии,
+// а сами источники удаляются. Все проверки выполняются до записи, а удаление
+// источников и обновление итогового продукта сохраняются одной транзакцией.
+func (s *ProductStorage) Merge(targetID string, sourceIDs []string) (models.Product, error) {
+	defer s.lockWrite(append([]string{targetID}, sourceIDs...)...)()
+
+	target, exists := s.get(targetID)
+	if !exists {
+		return models.Product{}, errors.New("продукт с ID " + targetID + " не найден")
+	}
+	if !isStocked(target) {
+		return models.Product{}, ErrMergeTarget
+	}
+
+	seen := map[string]bool{targetID: true}
+	sources := make([]models.Product, 0, len(sourceIDs))
+	for _, id := range sourceIDs {
+		if seen[id] {
+			return models.Product{}, errors.New("продукт с ID " + id + " указан в слиянии повторно")
+		}
+		seen[id] = true
+
+		source, exists := s.get(id)
+		if !exists {
+			return models.Product{}, errors.New("продукт с ID " + id + " не найден")
+		}
+		if !isStocked(source) || len(s.fields.byParent[id]) > 0 || len(s.fields.byComponent[id]) > 0 {
+			return models.Product{}, ErrMergeSource
+		}
+		sources = append(sources, source)
+	}
+
+	merged := mergeProducts(target, sources, time.Now())
+
+	// Источники удаляются в той же транзакции, поэтому их SKU и штрихкод
+	// могут перейти к итоговому продукту
+	t := s.begin()
+	for _, source := range sources {
+		if err := t.delete(source); err != nil {
+			return models.Product{}, err
+		}
+	}
+	t.save(merged)
+	if err := t.commit(); err != nil {
+		return models.Product{}, err
+	}
+	merged, _ = s.get(targetID)
+	return merged.Clone(), nil
+}
+
+func mergeProducts(target models.Product, sources []models.Product, now time.Time) models.Product {
+	merged := target
+	merged.Tags = append([]string(nil), target.Tags...)
+	merged.History = append([]models.ProductHistory(nil), target.History...)
+	tags := make(map[string]bool)
+	for _, tag := range target.Tags {
+		tags[tag] = true
+	}
+
+	for _, source := range sources {
+		if merged.Description == "" {
+			merged.Description = source.Description
+		}
+		if merged.SKU == "" {
+			merged.SKU = source.SKU
+		}
+		if merged.Barcode == "" {
+			merged.Barcode = source.Barcode
+		}
+		if merged.Weight.IsZero() {
+			merged.Weight = source.Weight
+		}
+		if merged.Dimensions.IsZero() {
+			merged.Dimensions = source.Dimensions
+			merged.VolumetricWeight = source.Dimensions.VolumetricWeight()
+		}
+		if merged.Status == "" {
+			merged.Status = source.Status
+		}
+		for _, tag := range source.Tags {
+			if !tags[tag] {
+				tags[tag] = true
+				merged.Tags = append(merged.Tags, tag)
+			}
+		}
+		if source.CreatedAt.Before(merged.CreatedAt) {
+			merged.CreatedAt = source.CreatedAt
+		}
+
+		merged.Stock += source.Stock
+		merged.Popularity += source.Popularity
+		merged.Views += source.Views
+		merged.History = append(merged.History, source.History...)
+		merged.History = append(merged.History, models.ProductHistory{
+			Field:     "merged_from",
+			OldValue:  source.ID,
+			NewValue:  target.ID,
+			Timestamp: now,
+		})
+	}
+
+	// Изменения полей итогового продукта записываются так же, как при обновлении
+	merged.History = append(merged.History, changeHistory(target, merged)[len(target.History):]...)
+	sort.SliceStable(merged.History, func(i, j int) bool {
+		return merged.History[i].Timestamp.Before(merged.History[j].Timestamp)
+	})
+	merged.UpdatedAt = now
+	return merged
+}
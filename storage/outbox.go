@@ -0,0 +1,328 @@
+package storage
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Afra1m/product_api/models"
+)
+
+// maxDeliveredOutbox ограничивает число хранимых доставленных записей outbox
+const maxDeliveredOutbox = 1000
+
+// outbox хранит события, ожидающие публикации. Записи добавляются под
+// блокировкой хранилища продуктов после того, как изменение записано в
+// ленту изменений, а читаются и подтверждаются ретранслятором под
+// собственной блокировкой outbox. С журналом каждое изменение записи
+// сохраняется в файл.
+type outbox struct {
+	entries map[uint64]models.OutboxEntry
+	seq     uint64
+	// delivered хранит ID доставленных записей в порядке доставки
+	delivered []uint64
+	journal   *OutboxJournal
+	notify    chan struct{}
+	mu        sync.Mutex
+}
+
+// newOutbox создает outbox и восстанавливает записи, сохраненные в журнале.
+// journal может быть nil, тогда outbox хранится только в памяти.
+func newOutbox(journal *OutboxJournal) *outbox {
+	o := &outbox{
+		entries: make(map[uint64]models.OutboxEntry),
+		journal: journal,
+		notify:  make(chan struct{}, 1),
+	}
+	if journal == nil {
+		return o
+	}
+
+	for id, entry := range journal.loaded {
+		o.entries[id] = entry
+		if id > o.seq {
+			o.seq = id
+		}
+		if entry.Status == models.OutboxDelivered {
+			o.delivered = append(o.delivered, id)
+		}
+	}
+	sort.Slice(o.delivered, func(i, j int) bool {
+		return o.delivered[i] < o.delivered[j]
+	})
+	o.prune()
+	journal.loaded = nil
+	o.compact(true)
+	return o
+}
+
+// append добавляет события, записанные вместе с изменениями ленты до номера
+// changeSeq включительно, и будит ретранслятор. Ошибка журнала не отменяет
+// уже примененное изменение: при следующем запуске недостающие события
+// восстанавливаются по ленте изменений (см. NewProductStorageWithLogs).
+func (o *outbox) append(changeSeq uint64, events ...models.ProductEvent) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	for _, event := range events {
+		o.seq++
+		entry := models.OutboxEntry{
+			ID:            o.seq,
+			ChangeSeq:     changeSeq,
+			Event:         event,
+			Status:        models.OutboxPending,
+			DeliveredTo:   []string{},
+			NextAttemptAt: event.Timestamp,
+			CreatedAt:     event.Timestamp,
+			UpdatedAt:     event.Timestamp,
+		}
+		o.entries[o.seq] = entry
+		o.save(entry)
+	}
+
+	select {
+	case o.notify <- struct{}{}:
+	default:
+	}
+}
+
+// changeSeq возвращает номер последней записи ленты изменений, события
+// которой есть в outbox
+func (o *outbox) changeSeq() uint64 {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	var seq uint64
+	for _, entry := range o.entries {
+		if entry.ChangeSeq > seq {
+			seq = entry.ChangeSeq
+		}
+	}
+	return seq
+}
+
+// save сохраняет запись в журнал. Вызывается под блокировкой outbox.
+func (o *outbox) save(entry models.OutboxEntry) error {
+	if o.journal == nil {
+		return nil
+	}
+	if err := o.journal.save(entry); err != nil {
+		return err
+	}
+	o.compact(false)
+	return nil
+}
+
+// compact переписывает журнал, если устаревших строк в нем больше, чем
+// актуальных записей, или если force истинно. Вызывается под блокировкой
+// outbox.
+func (o *outbox) compact(force bool) error {
+	if o.journal == nil || !force && o.journal.lines <= 2*len(o.entries)+maxDeliveredOutbox {
+		return nil
+	}
+
+	entries := make([]models.OutboxEntry, 0, len(o.entries))
+	for _, entry := range o.entries {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].ID < entries[j].ID
+	})
+	return o.journal.rewrite(entries)
+}
+
+// prune удаляет самые старые доставленные записи сверх maxDeliveredOutbox.
+// Вызывается под блокировкой outbox.
+func (o *outbox) prune() {
+	if len(o.delivered) <= maxDeliveredOutbox {
+		return
+	}
+	for _, old := range o.delivered[:len(o.delivered)-maxDeliveredOutbox] {
+		delete(o.entries, old)
+	}
+	o.delivered = o.delivered[len(o.delivered)-maxDeliveredOutbox:]
+}
+
+// OutboxNotify возвращает канал, в который приходит сигнал о новых записях outbox
+func (s *ProductStorage) OutboxNotify() <-chan struct{} {
+	return s.outbox.notify
+}
+
+// PendingOutbox возвращает не более limit записей, ожидающих публикации,
+// в порядке их создания. Выборка обрывается на первой записи, время
+// следующей попытки которой еще не наступило, чтобы более поздние события
+// не обгоняли ее.
+func (s *ProductStorage) PendingOutbox(now time.Time, limit int) []models.OutboxEntry {
+	o := s.outbox
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	var pending []models.OutboxEntry
+	for _, entry := range o.entries {
+		if entry.Status == models.OutboxPending {
+			pending = append(pending, entry)
+		}
+	}
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].ID < pending[j].ID
+	})
+
+	var entries []models.OutboxEntry
+	for _, entry := range pending {
+		if entry.NextAttemptAt.After(now) || limit > 0 && len(entries) == limit {
+			break
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// MarkOutboxDelivered отмечает запись как доставленную всем приемникам
+func (s *ProductStorage) MarkOutboxDelivered(id uint64, sinks []string) error {
+	o := s.outbox
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	entry, exists := o.entries[id]
+	if !exists {
+		return errors.New("запись outbox не найдена")
+	}
+
+	entry.Status = models.OutboxDelivered
+	entry.Attempts++
+	entry.DeliveredTo = sinks
+	entry.LastError = ""
+	entry.UpdatedAt = time.Now()
+	o.entries[id] = entry
+
+	o.delivered = append(o.delivered, id)
+	o.prune()
+	return o.save(entry)
+}
+
+// MarkOutboxAttemptFailed сохраняет результат неудачной попытки публикации.
+// Если failed истинно, запись переходит в статус failed и больше не
+// выбирается ретранслятором, иначе следующая попытка будет не раньше nextAttemptAt.
+func (s *ProductStorage) MarkOutboxAttemptFailed(id uint64, deliveredTo []string, lastError string, nextAttemptAt time.Time, failed bool) error {
+	o := s.outbox
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	entry, exists := o.entries[id]
+	if !exists {
+		return errors.New("запись outbox не найдена")
+	}
+
+	entry.Attempts++
+	entry.DeliveredTo = deliveredTo
+	entry.LastError = lastError
+	entry.NextAttemptAt = nextAttemptAt
+	entry.UpdatedAt = time.Now()
+	if failed {
+		entry.Status = models.OutboxFailed
+	}
+	o.entries[id] = entry
+	return o.save(entry)
+}
+
+// RetryOutbox возвращает запись со статусом failed в очередь на публикацию
+func (s *ProductStorage) RetryOutbox(id uint64) (models.OutboxEntry, error) {
+	o := s.outbox
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	entry, exists := o.entries[id]
+	if !exists {
+		return models.OutboxEntry{}, errors.New("запись outbox не найдена")
+	}
+	if entry.Status != models.OutboxFailed {
+		return models.OutboxEntry{}, errors.New("повторить можно только запись со статусом failed")
+	}
+
+	now := time.Now()
+	entry.Status = models.OutboxPending
+	entry.Attempts = 0
+	entry.NextAttemptAt = now
+	entry.UpdatedAt = now
+	o.entries[id] = entry
+	if err := o.save(entry); err != nil {
+		return models.OutboxEntry{}, err
+	}
+
+	select {
+	case o.notify <- struct{}{}:
+	default:
+	}
+	return entry, nil
+}
+
+// GetOutbox возвращает записи outbox с указанным статусом в порядке создания.
+// Пустой статус означает все записи, кроме доставленных.
+func (s *ProductStorage) GetOutbox(status string) []models.OutboxEntry {
+	o := s.outbox
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	entries := []models.OutboxEntry{}
+	for _, entry := range o.entries {
+		if status == "" && entry.Status != models.OutboxDelivered || entry.Status == status {
+			entries = append(entries, entry)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].ID < entries[j].ID
+	})
+	return entries
+}
+
+// GetOutboxEntry возвращает запись outbox по ID
+func (s *ProductStorage) GetOutboxEntry(id uint64) (models.OutboxEntry, error) {
+	o := s.outbox
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	entry, exists := o.entries[id]
+	if !exists {
+		return models.OutboxEntry{}, errors.New("запись outbox не найдена")
+	}
+	return entry, nil
+}
+
+// GetOutboxStats возвращает количество записей outbox по статусам
+func (s *ProductStorage) GetOutboxStats() models.OutboxStats {
+	o := s.outbox
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	var stats models.OutboxStats
+	for _, entry := range o.entries {
+		switch entry.Status {
+		case models.OutboxPending:
+			stats.Pending++
+		case models.OutboxDelivered:
+			stats.Delivered++
+		case models.OutboxFailed:
+			stats.Failed++
+		}
+	}
+	return stats
+}
+
+// OutboxPublishedSeq возвращает ID записи outbox, до которой включительно
+// все записи уже прошли через ретранслятор: следующей будет опубликована
+// запись с большим ID. Поток событий продолжает нумерацию с этого ID после
+// перезапуска.
+func (s *ProductStorage) OutboxPublishedSeq() uint64 {
+	o := s.outbox
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	seq := o.seq
+	for id, entry := range o.entries {
+		if entry.Status == models.OutboxPending && id <= seq {
+			seq = id - 1
+		}
+	}
+	return seq
+}
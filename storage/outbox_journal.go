@@ -0,0 +1,120 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+
+	"github.com/Afra1m/product_api/models"
+)
+
+// OutboxJournal хранит состояние записей outbox в файле в формате NDJSON,
+// чтобы неопубликованные события переживали перезапуск процесса. Каждая
+// строка содержит запись целиком после очередного изменения, и при загрузке
+// действует последняя строка записи. Когда устаревших строк становится
+// больше, чем актуальных, журнал переписывается заново.
+type OutboxJournal struct {
+	path    string
+	file    *os.File
+	loaded  map[uint64]models.OutboxEntry
+	lines   int
+	created bool
+}
+
+// OpenOutboxJournal открывает файл журнала outbox, загружая сохраненные
+// записи. Незавершенная последняя строка отбрасывается.
+func OpenOutboxJournal(path string) (*OutboxJournal, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	journal := &OutboxJournal{
+		path:   path,
+		file:   file,
+		loaded: make(map[uint64]models.OutboxEntry),
+	}
+	var valid int64
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			break
+		}
+		var entry models.OutboxEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			break
+		}
+		journal.loaded[entry.ID] = entry
+		journal.lines++
+		valid += int64(len(line))
+	}
+	journal.created = valid == 0
+
+	if err := file.Truncate(valid); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if _, err := file.Seek(valid, 0); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return journal, nil
+}
+
+// save дописывает состояние записи в журнал
+func (j *OutboxJournal) save(entry models.OutboxEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if _, err := j.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	j.lines++
+	return nil
+}
+
+// rewrite заменяет журнал файлом, содержащим только указанные записи.
+// Новый файл записывается рядом и переименовывается поверх старого, поэтому
+// при сбое остается один из двух целых журналов.
+func (j *OutboxJournal) rewrite(entries []models.OutboxEntry) error {
+	tmp := j.path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(file)
+	for _, entry := range entries {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			file.Close()
+			return err
+		}
+		writer.Write(append(line, '\n'))
+	}
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, j.path); err != nil {
+		return err
+	}
+
+	reopened, err := os.OpenFile(j.path, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	j.file.Close()
+	j.file = reopened
+	j.lines = len(entries)
+	return nil
+}
+
+// Close закрывает файл журнала
+func (j *OutboxJournal) Close() error {
+	return j.file.Close()
+}
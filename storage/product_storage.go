@@ -2,134 +2,214 @@ package storage
 
 import (
 	"errors"
+	"fmt"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/Afra1m/product_api/models"
 )
 
-// ProductStorage представляет собой хранилище продуктов
+// ErrProductNotFound означает, что продукта с указанным ID нет в хранилище
+var ErrProductNotFound = errors.New("продукт не найден")
+
+// ProductStorage представляет собой хранилище продуктов. Продукты разложены
+// по сегментам со своими блокировками (см. shard), а общая блокировка mu
+// защищает индексы, политики, ленту изменений и версию. Последний снимок
+// каталога кэшируется до следующей записи.
 type ProductStorage struct {
-	products map[string]models.Product
-	mu       sync.RWMutex
+	shards    []*shard
+	bySKU     map[string]string
+	byBarcode map[string]string
+	sorted    sortIndexes
+	fields    fieldIndexes
+	policies  map[string]models.InventoryPolicy
+	outbox    *outbox
+	validator ProductValidator
+	counters  []*counterBuffer
+	changes   ChangeLog
+	version   uint64
+	// contentVersion является версией последнего изменения продуктов,
+	// кроме сохранения счетчиков
+	contentVersion uint64
+	mu             sync.RWMutex
+
+	// categoryMu блокируется на запись на время изменения дерева
+	// категорий, а каждая запись продуктов держит его на чтение
+	categoryMu sync.RWMutex
+
+	snapshot   *Snapshot
+	snapshotMu sync.Mutex
 }
 
-// NewProductStorage создает новое хранилище продуктов
+// NewProductStorage создает новое хранилище продуктов с лентой изменений в памяти
 func NewProductStorage() *ProductStorage {
-	return &ProductStorage{
-		products: make(map[string]models.Product),
+	return NewProductStorageWithChangeLog(NewMemoryChangeLog())
+}
+
+// NewProductStorageWithChangeLog создает хранилище продуктов с указанной лентой
+// изменений и outbox в памяти
+func NewProductStorageWithChangeLog(changes ChangeLog) *ProductStorage {
+	return NewProductStorageWithLogs(changes, nil)
+}
+
+// NewProductStorageWithLogs создает хранилище продуктов с указанной лентой
+// изменений и журналом outbox. Состояние продуктов восстанавливается по уже
+// записанным в ленту изменениям, а неопубликованные события — по журналу,
+// поэтому с постоянными лентой и журналом каталог и доставка событий
+// переживают перезапуск. События изменений, которые попали в ленту, но не
+// успели попасть в журнал, создаются заново по ленте. Если journal равен nil,
+// outbox хранится в памяти.
+func NewProductStorageWithLogs(changes ChangeLog, journal *OutboxJournal) *ProductStorage {
+	s := &ProductStorage{
+		shards:    newShards(),
+		bySKU:     make(map[string]string),
+		byBarcode: make(map[string]string),
+		sorted:    newSortIndexes(),
+		fields:    newFieldIndexes(),
+		policies:  make(map[string]models.InventoryPolicy),
+		outbox:    newOutbox(journal),
+		counters:  newCounterBuffers(),
+		changes:   changes,
+	}
+
+	// В новый журнал попадают только события будущих изменений
+	recorded := changes.LastSeq()
+	if journal != nil && !journal.created {
+		recorded = s.outbox.changeSeq()
+	}
+	// История продукта накапливается отдельно, а продукт получает ее срез
+	// без запаса емкости, чтобы дописывание истории при последующих
+	// изменениях не затрагивало сохраненный продукт
+	histories := make(map[string][]models.ProductHistory)
+	for _, change := range changes.Since(0, 0) {
+		oldProduct, existed := s.get(change.ProductID)
+		if existed {
+			s.unindex(oldProduct)
+		}
+		var product *models.Product
+		switch change.Type {
+		case models.ChangeUpsert:
+			// Записи ленты не изменяются, поэтому продукт может разделять
+			// с ними данные
+			history := replayHistory(histories[change.ProductID], change)
+			histories[change.ProductID] = history
+			restored := *change.Product
+			restored.History = history[:len(history):len(history)]
+			product = &restored
+			s.put(restored)
+			s.index(restored)
+		case models.ChangeDelete:
+			s.remove(change.ProductID)
+			delete(histories, change.ProductID)
+		}
+		if change.Seq > recorded {
+			s.record(change.Seq, s.changeEvents(oldProduct, existed, product)...)
+		}
 	}
+	s.version = changes.LastSeq()
+	s.contentVersion = s.version
+	return s
 }
 
 // GetAll возвращает все продукты
 func (s *ProductStorage) GetAll() []models.Product {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	products := []models.Product{}
+	s.forEachShard(func(product models.Product) {
+		products = append(products, product.Clone())
+	})
+	return products
+}
+
+// ForEachChunk обходит продукты, удовлетворяющие фильтру, порциями не больше
+// chunkSize в порядке ID. Блокировка удерживается только на время выборки
+// одной порции, а fn вызывается без нее, поэтому обход большого каталога
+// не блокирует запись. Продукты, измененные во время обхода, попадают в
+// выборку в том состоянии, в котором они были при чтении их порции.
+func (s *ProductStorage) ForEachChunk(filter models.ProductFilter, chunkSize int, fn func([]models.Product) error) error {
+	ids := []string{}
+	s.forEachShard(func(product models.Product) {
+		ids = append(ids, product.ID)
+	})
+	sort.Strings(ids)
+
+	chunk := make([]models.Product, 0, chunkSize)
+	for start := 0; start < len(ids); start += chunkSize {
+		end := start + chunkSize
+		if end > len(ids) {
+			end = len(ids)
+		}
 
-	products := make([]models.Product, 0, len(s.products))
-	for _, product := range s.products {
-		products = append(products, product)
+		chunk = chunk[:0]
+		for _, id := range ids[start:end] {
+			if product, err := s.GetByID(id); err == nil && filter.Matches(product) {
+				chunk = append(chunk, product)
+			}
+		}
+
+		if len(chunk) == 0 {
+			continue
+		}
+		if err := fn(chunk); err != nil {
+			return err
+		}
 	}
-	return products
+	return nil
 }
 
 // GetByID возвращает продукт по ID
 func (s *ProductStorage) GetByID(id string) (models.Product, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	sh := s.shardFor(id)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
 
-	product, exists := s.products[id]
+	product, exists := sh.products[id]
 	if !exists {
 		return models.Product{}, errors.New("продукт не найден")
 	}
-	return product, nil
+	return product.Clone(), nil
 }
 
 // Create создает новый продукт
 func (s *ProductStorage) Create(product models.Product) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	defer s.lockWrite(product.ID)()
 
-	if _, exists := s.products[product.ID]; exists {
+	if _, exists := s.get(product.ID); exists {
 		return errors.New("продукт с таким ID уже существует")
 	}
 
-	s.products[product.ID] = product
-	return nil
+	return s.commitSave(product)
 }
 
-// Update обновляет существующий продукт
+// Update обновляет существующий продукт. Счетчики просмотров и
+// популярности меняет только хранилище (см. IncrementCounters), поэтому они
+// сохраняются из текущего продукта.
 func (s *ProductStorage) Update(id string, product models.Product) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	defer s.lockWrite(id)()
 
-	if _, exists := s.products[id]; !exists {
+	oldProduct, exists := s.get(id)
+	if !exists {
 		return errors.New("продукт не найден")
 	}
+	product.Views, product.Popularity = oldProduct.Views, oldProduct.Popularity
 
-	// Добавляем запись в историю
-	oldProduct := s.products[id]
-	if oldProduct.Name != product.Name {
-		historyEntry := models.ProductHistory{
-			Field:     "name",
-			OldValue:  oldProduct.Name,
-			NewValue:  product.Name,
-			Timestamp: time.Now(),
-		}
-		product.History = append(oldProduct.History, historyEntry)
-	}
-	if oldProduct.Description != product.Description {
-		historyEntry := models.ProductHistory{
-			Field:     "description",
-			OldValue:  oldProduct.Description,
-			NewValue:  product.Description,
-			Timestamp: time.Now(),
-		}
-		product.History = append(oldProduct.History, historyEntry)
-	}
-	if oldProduct.Price != product.Price {
-		historyEntry := models.ProductHistory{
-			Field:     "price",
-			OldValue:  oldProduct.Price,
-			NewValue:  product.Price,
-			Timestamp: time.Now(),
-		}
-		product.History = append(oldProduct.History, historyEntry)
-	}
-	if oldProduct.Category != product.Category {
-		historyEntry := models.ProductHistory{
-			Field:     "category",
-			OldValue:  oldProduct.Category,
-			NewValue:  product.Category,
-			Timestamp: time.Now(),
-		}
-		product.History = append(oldProduct.History, historyEntry)
-	}
-	if oldProduct.Stock != product.Stock {
-		historyEntry := models.ProductHistory{
-			Field:     "stock",
-			OldValue:  oldProduct.Stock,
-			NewValue:  product.Stock,
-			Timestamp: time.Now(),
-		}
-		product.History = append(oldProduct.History, historyEntry)
-	}
-
-	s.products[id] = product
-	return nil
+	t := s.begin()
+	t.applyFamily(&product)
+	product.History = changeHistory(oldProduct, product)
+	t.save(product)
+	return t.commit()
 }
 
 // Delete удаляет продукт
 func (s *ProductStorage) Delete(id string) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	defer s.lockWrite(id)()
 
-	if _, exists := s.products[id]; !exists {
+	product, exists := s.get(id)
+	if !exists {
 		return errors.New("продукт не найден")
 	}
 
-	delete(s.products, id)
-	return nil
+	return s.commitDelete(product)
 }
 
 // GetByCategory возвращает продукты по категории
@@ -137,13 +217,7 @@ func (s *ProductStorage) GetByCategory(category string) []models.Product {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	var products []models.Product
-	for _, product := range s.products {
-		if product.Category == category {
-			products = append(products, product)
-		}
-	}
-	return products
+	return s.collect(s.fields.byCategory[category])
 }
 
 // GetByPriceRange возвращает продукты в указанном диапазоне цен
@@ -152,53 +226,38 @@ func (s *ProductStorage) GetByPriceRange(min, max float64) []models.Product {
 	defer s.mu.RUnlock()
 
 	var products []models.Product
-	for _, product := range s.products {
-		if product.Price >= min && product.Price <= max {
-			products = append(products, product)
-		}
-	}
+	s.sorted.price.AscendRange(&min, &max, func(id string) bool {
+		product, _ := s.get(id)
+		products = append(products, product.Clone())
+		return true
+	})
 	return products
 }
 
-// GetInStock возвращает продукты в наличии
+// GetInStock возвращает продукты и варианты в наличии. Родительские
+// продукты не возвращаются: в наличии находятся их варианты.
 func (s *ProductStorage) GetInStock() []models.Product {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	var products []models.Product
-	for _, product := range s.products {
-		if product.Stock > 0 {
-			products = append(products, product)
-		}
-	}
-	return products
+	inStock := 1
+	return s.stockRange(&inStock, nil, isStocked)
 }
 
-// UpdateStock обновляет количество товара
+// UpdateStock обновляет количество товара. Остаток набора меняется через
+// компоненты: уменьшение списывает их как продажу наборов.
 func (s *ProductStorage) UpdateStock(id string, stock int) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	defer s.lockWrite(id)()
 
-	product, exists := s.products[id]
+	product, exists := s.get(id)
 	if !exists {
 		return errors.New("продукт не найден")
 	}
-
-	oldStock := product.Stock
-	product.Stock = stock
-	product.UpdatedAt = time.Now()
-
-	// Добавляем запись в историю
-	historyEntry := models.ProductHistory{
-		Field:     "stock",
-		OldValue:  oldStock,
-		NewValue:  stock,
-		Timestamp: time.Now(),
+	if product.IsVariantParent() || product.IsBundle() {
+		return s.adjustStock(product, stock-product.Stock)
 	}
-	product.History = append(product.History, historyEntry)
 
-	s.products[id] = product
-	return nil
+	return s.setStock(product, stock)
 }
 
 // GetAllCategories возвращает список всех категорий
@@ -206,13 +265,8 @@ func (s *ProductStorage) GetAllCategories() []string {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	categories := make(map[string]struct{})
-	for _, product := range s.products {
-		categories[product.Category] = struct{}{}
-	}
-
-	result := make([]string, 0, len(categories))
-	for category := range categories {
+	result := make([]string, 0, len(s.fields.byCategory))
+	for category := range s.fields.byCategory {
 		result = append(result, category)
 	}
 	return result
@@ -224,7 +278,7 @@ func (s *ProductStorage) GetStats() models.ProductStats {
 	defer s.mu.RUnlock()
 
 	stats := models.ProductStats{
-		TotalProducts: len(s.products),
+		TotalProducts: s.count(),
 	}
 
 	categories := make(map[string]struct{})
@@ -233,21 +287,24 @@ func (s *ProductStorage) GetStats() models.ProductStats {
 	var outOfStockCount int
 	var lowStockCount int
 
-	for _, product := range s.products {
+	for _, product := range s.all() {
 		categories[product.Category] = struct{}{}
 		totalPrice += product.Price
+		if !isStocked(product) {
+			continue
+		}
 		totalStock += product.Stock
 		if product.Stock == 0 {
 			outOfStockCount++
 		}
-		if product.Stock < 10 {
+		if s.isLowStock(product, 0) {
 			lowStockCount++
 		}
 	}
 
 	stats.TotalCategories = len(categories)
-	if len(s.products) > 0 {
-		stats.AveragePrice = totalPrice / float64(len(s.products))
+	if stats.TotalProducts > 0 {
+		stats.AveragePrice = totalPrice / float64(stats.TotalProducts)
 	}
 	stats.TotalStock = totalStock
 	stats.OutOfStockCount = outOfStockCount
@@ -256,96 +313,170 @@ func (s *ProductStorage) GetStats() models.ProductStats {
 	return stats
 }
 
-// CreateBatch создает несколько продуктов
+// CreateBatch создает несколько продуктов. Пакет сохраняется целиком или
+// не сохраняется вовсе.
 func (s *ProductStorage) CreateBatch(products []models.Product) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	defer s.lockWrite(productIDs(products)...)()
 
+	t := s.begin()
 	for _, product := range products {
-		if _, exists := s.products[product.ID]; exists {
+		if _, exists := t.get(product.ID); exists {
 			return errors.New("продукт с ID " + product.ID + " уже существует")
 		}
-		s.products[product.ID] = product
+		t.save(product)
 	}
-	return nil
+	return t.commit()
 }
 
-// UpdateBatch обновляет несколько продуктов
-func (s *ProductStorage) UpdateBatch(updates map[string]models.Product) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+// UpsertBatch сохраняет продукты, сопоставляя их с существующими по SKU.
+// Продукт, SKU которого уже есть в хранилище, обновляет найденный продукт
+// с сохранением его ID, даты создания, счетчиков и истории; продукты без SKU
+// и с новым SKU создаются. Пакет сохраняется целиком или не сохраняется вовсе.
+func (s *ProductStorage) UpsertBatch(products []models.Product) ([]models.UpsertResult, error) {
+	defer s.lockUpsert(products...)()
 
-	for id, product := range updates {
-		if _, exists := s.products[id]; !exists {
-			return errors.New("продукт с ID " + id + " не найден")
+	t := s.begin()
+	results := make([]models.UpsertResult, 0, len(products))
+	for _, product := range products {
+		result, err := t.upsert(product)
+		if err != nil {
+			return nil, err
 		}
-		s.products[id] = product
+		results = append(results, result)
 	}
-	return nil
+	if err := t.commit(); err != nil {
+		return nil, err
+	}
+	return results, nil
 }
 
-// DeleteBatch удаляет несколько продуктов
-func (s *ProductStorage) DeleteBatch(ids []string) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+// CheckUpsertBatch проверяет пакет так же, как UpsertBatch, но ничего не
+// сохраняет. Возвращает по номеру продукта в пакете ошибки продуктов,
+// которые нарушают уникальность SKU или штрихкода или не проходят проверку.
+// Продукты проверяются в порядке пакета с учетом предыдущих, поэтому два
+// продукта с одним штрихкодом отклоняются оба, если второй не обновляет
+// первый по SKU.
+func (s *ProductStorage) CheckUpsertBatch(products []models.Product) map[int]error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 
-	for _, id := range ids {
-		if _, exists := s.products[id]; !exists {
-			return errors.New("продукт с ID " + id + " не найден")
+	t := s.begin()
+	skus := make(map[string]string)
+	barcodes := make(map[string]string)
+	rejected := make(map[int]error)
+	for i, product := range products {
+		result, err := t.upsert(product)
+		if err != nil {
+			rejected[i] = err
+			continue
+		}
+		product = *t.staged[result.Product.ID]
+		switch {
+		case t.keyTaken(s.bySKU, skus, product.SKU, product.ID, func(p models.Product) string { return p.SKU }):
+			rejected[i] = ErrDuplicateSKU
+		case t.keyTaken(s.byBarcode, barcodes, product.Barcode, product.ID, func(p models.Product) string { return p.Barcode }):
+			rejected[i] = ErrDuplicateBarcode
+		case s.validator != nil:
+			if report := s.validator.Report(product); !report.Valid {
+				rejected[i] = &InvalidProductError{Report: report}
+			}
 		}
-		delete(s.products, id)
 	}
-	return nil
+	return rejected
 }
 
-// GetPopular возвращает популярные продукты
-func (s *ProductStorage) GetPopular(limit int) []models.Product {
+// ExistingSKUs возвращает те из переданных SKU, которые уже есть в хранилище
+func (s *ProductStorage) ExistingSKUs(skus []string) map[string]bool {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	products := make([]models.Product, 0, len(s.products))
-	for _, product := range s.products {
-		products = append(products, product)
-	}
-
-	// Сортировка по популярности
-	for i := 0; i < len(products)-1; i++ {
-		for j := i + 1; j < len(products); j++ {
-			if products[i].Popularity < products[j].Popularity {
-				products[i], products[j] = products[j], products[i]
-			}
+	existing := make(map[string]bool)
+	for _, sku := range skus {
+		if _, exists := s.bySKU[sku]; sku != "" && exists {
+			existing[sku] = true
 		}
 	}
+	return existing
+}
 
-	if limit > len(products) {
-		limit = len(products)
+// ExistingIDs возвращает те из переданных ID, продукты с которыми есть в
+// хранилище
+func (s *ProductStorage) ExistingIDs(ids []string) map[string]bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	existing := make(map[string]bool)
+	for _, id := range ids {
+		if _, exists := s.get(id); exists {
+			existing[id] = true
+		}
 	}
-	return products[:limit]
+	return existing
 }
 
-// GetNew возвращает новые продукты
-func (s *ProductStorage) GetNew(limit int) []models.Product {
+// TaggedIDs возвращает ID продуктов, у которых есть хотя бы один из тегов
+func (s *ProductStorage) TaggedIDs(tags []string) []string {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	products := make([]models.Product, 0, len(s.products))
-	for _, product := range s.products {
-		products = append(products, product)
+	seen := make(idSet)
+	var ids []string
+	for _, tag := range tags {
+		for id := range s.fields.byTag[tag] {
+			if _, exists := seen[id]; !exists {
+				seen[id] = struct{}{}
+				ids = append(ids, id)
+			}
+		}
 	}
+	return ids
+}
 
-	// Сортировка по дате создания
-	for i := 0; i < len(products)-1; i++ {
-		for j := i + 1; j < len(products); j++ {
-			if products[i].CreatedAt.Before(products[j].CreatedAt) {
-				products[i], products[j] = products[j], products[i]
-			}
+// UpdateBatch обновляет несколько продуктов. Пакет сохраняется целиком или
+// не сохраняется вовсе. Счетчики продуктов сохраняются, как в Update.
+func (s *ProductStorage) UpdateBatch(updates map[string]models.Product) error {
+	ids := updateIDs(updates)
+	defer s.lockWrite(ids...)()
+
+	t := s.begin()
+	for _, id := range ids {
+		oldProduct, exists := t.get(id)
+		if !exists {
+			return errors.New("продукт с ID " + id + " не найден")
 		}
+		product := updates[id]
+		product.Views, product.Popularity = oldProduct.Views, oldProduct.Popularity
+		t.save(product)
 	}
+	return t.commit()
+}
+
+// DeleteBatch удаляет несколько продуктов. Пакет удаляется целиком или не
+// удаляется вовсе.
+func (s *ProductStorage) DeleteBatch(ids []string) error {
+	defer s.lockWrite(ids...)()
 
-	if limit > len(products) {
-		limit = len(products)
+	t := s.begin()
+	for _, id := range ids {
+		product, exists := t.get(id)
+		if !exists {
+			return fmt.Errorf("%w: %s", ErrProductNotFound, id)
+		}
+		if err := t.delete(product); err != nil {
+			return err
+		}
 	}
-	return products[:limit]
+	return t.commit()
+}
+
+// GetPopular возвращает популярные продукты
+func (s *ProductStorage) GetPopular(limit int) []models.Product {
+	return s.topSorted(SortPopularity, limit)
+}
+
+// GetNew возвращает новые продукты
+func (s *ProductStorage) GetNew(limit int) []models.Product {
+	return s.topSorted(SortCreatedAt, limit)
 }
 
 // GetDiscounted возвращает продукты со скидкой
@@ -353,21 +484,14 @@ func (s *ProductStorage) GetDiscounted() []models.Product {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	var products []models.Product
-	for _, product := range s.products {
-		if product.Discount > 0 {
-			products = append(products, product)
-		}
-	}
-	return products
+	return s.collect(s.fields.discounted)
 }
 
 // UpdateDiscount обновляет скидку продукта
 func (s *ProductStorage) UpdateDiscount(id string, discount float64) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	defer s.lockWrite(id)()
 
-	product, exists := s.products[id]
+	product, exists := s.get(id)
 	if !exists {
 		return errors.New("продукт не найден")
 	}
@@ -385,8 +509,7 @@ func (s *ProductStorage) UpdateDiscount(id string, discount float64) error {
 	}
 	product.History = append(product.History, historyEntry)
 
-	s.products[id] = product
-	return nil
+	return s.commitSave(product)
 }
 
 // GetFeatured возвращает рекомендуемые продукты
@@ -394,21 +517,14 @@ func (s *ProductStorage) GetFeatured() []models.Product {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	var products []models.Product
-	for _, product := range s.products {
-		if product.Featured {
-			products = append(products, product)
-		}
-	}
-	return products
+	return s.collect(s.fields.featured)
 }
 
 // UpdateFeature обновляет статус рекомендации продукта
 func (s *ProductStorage) UpdateFeature(id string, featured bool) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	defer s.lockWrite(id)()
 
-	product, exists := s.products[id]
+	product, exists := s.get(id)
 	if !exists {
 		return errors.New("продукт не найден")
 	}
@@ -426,34 +542,72 @@ func (s *ProductStorage) UpdateFeature(id string, featured bool) error {
 	}
 	product.History = append(product.History, historyEntry)
 
-	s.products[id] = product
-	return nil
+	return s.commitSave(product)
 }
 
-// GetOutOfStock возвращает продукты, которых нет в наличии
+// GetOutOfStock возвращает продукты и варианты, которых нет в наличии
 func (s *ProductStorage) GetOutOfStock() []models.Product {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	var products []models.Product
-	for _, product := range s.products {
-		if product.Stock == 0 {
-			products = append(products, product)
-		}
-	}
-	return products
+	outOfStock := 0
+	return s.stockRange(&outOfStock, &outOfStock, isStocked)
 }
 
-// GetLowStock возвращает продукты с низким запасом
+// GetLowStock возвращает продукты и варианты с низким запасом.
+// Если threshold не положителен, порог определяется через resolvePolicy.
 func (s *ProductStorage) GetLowStock(threshold int) []models.Product {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	var products []models.Product
-	for _, product := range s.products {
-		if product.Stock > 0 && product.Stock <= threshold {
-			products = append(products, product)
+	inStock := 1
+	if threshold > 0 {
+		return s.stockRange(&inStock, &threshold, isStocked)
+	}
+	return s.stockRange(&inStock, nil, func(product models.Product) bool {
+		return isStocked(product) && s.isLowStock(product, threshold)
+	})
+}
+
+// changeHistory возвращает историю продукта, дополненную записями об
+// изменении отслеживаемых полей
+func changeHistory(oldProduct, product models.Product) []models.ProductHistory {
+	history := oldProduct.History
+	now := time.Now()
+	track := func(field string, oldValue, newValue interface{}) {
+		if oldValue != newValue {
+			history = append(history, models.ProductHistory{
+				Field:     field,
+				OldValue:  oldValue,
+				NewValue:  newValue,
+				Timestamp: now,
+			})
 		}
 	}
-	return products
+
+	track("name", oldProduct.Name, product.Name)
+	track("description", oldProduct.Description, product.Description)
+	track("price", oldProduct.Price, product.Price)
+	track("category", oldProduct.Category, product.Category)
+	track("stock", oldProduct.Stock, product.Stock)
+	return history
+}
+
+// productIDs возвращает ID продуктов
+func productIDs(products []models.Product) []string {
+	ids := make([]string, len(products))
+	for i, product := range products {
+		ids[i] = product.ID
+	}
+	return ids
+}
+
+// updateIDs возвращает упорядоченные ID обновляемых продуктов
+func updateIDs(updates map[string]models.Product) []string {
+	ids := make([]string, 0, len(updates))
+	for id := range updates {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
 }
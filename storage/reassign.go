@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"sort"
+	"time"
+)
+
+// ReassignCategory переносит все продукты категории from в категорию to и
+// возвращает число сохраненных продуктов; варианты переезжают вместе с
+// родителем и не учитываются. Перенос записывается в историю продуктов и
+// сохраняется одной транзакцией: переносятся все продукты или ни один.
+func (s *ProductStorage) ReassignCategory(from, to string) (int, error) {
+	return s.reassignCategory(from, to, s.lockStable)
+}
+
+// CategoryChange переносит продукты между категориями внутри
+// ChangeCategories
+type CategoryChange struct {
+	s *ProductStorage
+}
+
+// ReassignCategory переносит продукты так же, как
+// ProductStorage.ReassignCategory
+func (c CategoryChange) ReassignCategory(from, to string) (int, error) {
+	return c.s.reassignCategory(from, to, c.s.lockFamily)
+}
+
+// ChangeCategories выполняет fn, изменяющую дерево категорий, пока запись
+// продуктов приостановлена. Так проверка продуктов категории, изменение
+// дерева и перенос продуктов через change выполняются без записей между
+// ними: например, продукт не может попасть в удаляемую категорию после
+// проверки, что она пуста. Чтение продуктов внутри fn не блокируется.
+func (s *ProductStorage) ChangeCategories(fn func(change CategoryChange) error) error {
+	s.categoryMu.Lock()
+	defer s.categoryMu.Unlock()
+
+	return fn(CategoryChange{s: s})
+}
+
+// reassignCategory переносит продукты категории, блокируя их функцией lock
+func (s *ProductStorage) reassignCategory(from, to string, lock func(ids func() []string) func()) (int, error) {
+	if from == to {
+		return 0, nil
+	}
+
+	var ids []string
+	defer lock(func() []string {
+		ids = make([]string, 0, len(s.fields.byCategory[from]))
+		for id := range s.fields.byCategory[from] {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		return ids
+	})()
+
+	t := s.begin()
+	now := time.Now()
+	saved := 0
+	for _, id := range ids {
+		oldProduct, _ := t.get(id)
+		if oldProduct.IsVariant() {
+			// Категория варианта следует за родителем
+			continue
+		}
+		product := oldProduct
+		product.Category = to
+		product.UpdatedAt = now
+		product.History = changeHistory(oldProduct, product)
+		t.save(product)
+		saved++
+	}
+	if err := t.commit(); err != nil {
+		return 0, err
+	}
+	return saved, nil
+}
@@ -0,0 +1,271 @@
+package storage
+
+import (
+	"hash/fnv"
+	"sort"
+	"sync"
+
+	"github.com/Afra1m/product_api/models"
+)
+
+// ShardCount задает число сегментов карты продуктов
+const ShardCount = 16
+
+// shard является сегментом карты продуктов со своей блокировкой.
+//
+// Порядок блокировок в хранилище: сначала сегменты по возрастанию номера,
+// затем общая блокировка хранилища, которая защищает индексы, ленту
+// изменений и версию. Запись держит сегменты своих продуктов на запись, а
+// хранилище — только на чтение, поэтому записи в разные сегменты готовят
+// изменения параллельно; на запись хранилище блокируется лишь на время
+// применения готовых изменений (см. exclusive). Карта сегмента изменяется
+// только под обеими блокировками на запись, поэтому читать ее можно под
+// любой из них: чтение по ID и полный обход берут только блокировки
+// сегментов и не ждут записи в другие сегменты, а выборки по индексам берут
+// только общую блокировку.
+//
+// frozen хранит неизменяемую копию карты для снимков и сбрасывается при
+// каждой записи в сегмент.
+type shard struct {
+	products map[string]models.Product
+	frozen   map[string]models.Product
+	mu       sync.RWMutex
+}
+
+func newShards() []*shard {
+	shards := make([]*shard, ShardCount)
+	for i := range shards {
+		shards[i] = &shard{products: make(map[string]models.Product)}
+	}
+	return shards
+}
+
+// shardOf возвращает номер сегмента продукта при count сегментах
+func shardOf(id string, count int) int {
+	hash := fnv.New32a()
+	hash.Write([]byte(id))
+	return int(hash.Sum32() % uint32(count))
+}
+
+// shardIndex возвращает номер сегмента продукта
+func (s *ProductStorage) shardIndex(id string) int {
+	return shardOf(id, len(s.shards))
+}
+
+// shardFor возвращает сегмент продукта
+func (s *ProductStorage) shardFor(id string) *shard {
+	return s.shards[s.shardIndex(id)]
+}
+
+// get возвращает продукт по ID. Вызывается под блокировкой хранилища или
+// сегмента продукта.
+func (s *ProductStorage) get(id string) (models.Product, bool) {
+	product, exists := s.shardFor(id).products[id]
+	return product, exists
+}
+
+// put сохраняет продукт. Вызывается под блокировками сегмента и хранилища.
+func (s *ProductStorage) put(product models.Product) {
+	sh := s.shardFor(product.ID)
+	sh.products[product.ID] = product
+	sh.frozen = nil
+	s.snapshot = nil
+}
+
+// remove удаляет продукт. Вызывается под блокировками сегмента и хранилища.
+func (s *ProductStorage) remove(id string) {
+	sh := s.shardFor(id)
+	delete(sh.products, id)
+	sh.frozen = nil
+	s.snapshot = nil
+}
+
+// count возвращает число продуктов. Вызывается под блокировкой хранилища.
+func (s *ProductStorage) count() int {
+	total := 0
+	for _, sh := range s.shards {
+		total += len(sh.products)
+	}
+	return total
+}
+
+// all возвращает все продукты. Вызывается под блокировкой хранилища.
+func (s *ProductStorage) all() []models.Product {
+	products := make([]models.Product, 0, s.count())
+	for _, sh := range s.shards {
+		for _, product := range sh.products {
+			products = append(products, product)
+		}
+	}
+	return products
+}
+
+// forEachShard вызывает fn для каждого продукта, блокируя на чтение по одному
+// сегменту за раз. Не вызывается под блокировкой хранилища.
+func (s *ProductStorage) forEachShard(fn func(product models.Product)) {
+	for _, sh := range s.shards {
+		sh.mu.RLock()
+		for _, product := range sh.products {
+			fn(product)
+		}
+		sh.mu.RUnlock()
+	}
+}
+
+// lockWrite блокирует на запись сегменты продуктов с указанными ID и
+// связанных с ними продуктов (см. family), затем хранилище на чтение, и
+// возвращает функцию снятия блокировок
+func (s *ProductStorage) lockWrite(ids ...string) func() {
+	return s.lockStable(func() []string {
+		return ids
+	})
+}
+
+// lockShards блокирует на запись сегменты продуктов с указанными ID в порядке
+// возрастания номера, затем хранилище на чтение, и возвращает функцию снятия
+// блокировок
+func (s *ProductStorage) lockShards(ids ...string) func() {
+	seen := make(map[int]bool, len(ids))
+	indexes := make([]int, 0, len(ids))
+	for _, id := range ids {
+		if index := s.shardIndex(id); !seen[index] {
+			seen[index] = true
+			indexes = append(indexes, index)
+		}
+	}
+	sort.Ints(indexes)
+
+	for _, index := range indexes {
+		s.shards[index].mu.Lock()
+	}
+	s.mu.RLock()
+
+	return func() {
+		s.mu.RUnlock()
+		for i := len(indexes) - 1; i >= 0; i-- {
+			s.shards[indexes[i]].mu.Unlock()
+		}
+	}
+}
+
+// exclusive выполняет fn под блокировкой хранилища на запись. Вызывается
+// под блокировкой lockWrite: на время fn блокировка хранилища на чтение
+// заменяется блокировкой на запись, а блокировки сегментов сохраняются,
+// поэтому продукты этих сегментов не меняются, но индексы, изменения которых
+// fn не должна терять, перед применением нужно проверять заново.
+func (s *ProductStorage) exclusive(fn func() error) error {
+	s.mu.RUnlock()
+	s.mu.Lock()
+	defer func() {
+		s.mu.Unlock()
+		s.mu.RLock()
+	}()
+	return fn()
+}
+
+// lockUpsert блокирует на запись сегменты продуктов и тех существующих
+// продуктов, с которыми они совпадают по SKU или штрихкоду
+func (s *ProductStorage) lockUpsert(products ...models.Product) func() {
+	return s.lockStable(func() []string {
+		return s.keyOwners(products)
+	})
+}
+
+// lockStable блокирует на запись сегменты продуктов, ID которых возвращает
+// ids, вместе со связанными с ними продуктами. Набор ID определяется по индексам
+// до блокировки, поэтому если он успел измениться, блокировка повторяется.
+// ids вызывается под блокировкой хранилища и должна возвращать ID в
+// детерминированном порядке. Запись не начинается, пока выполняется
+// изменение дерева категорий (см. ChangeCategories).
+func (s *ProductStorage) lockStable(ids func() []string) func() {
+	s.categoryMu.RLock()
+	unlock := s.lockFamily(ids)
+	return func() {
+		unlock()
+		s.categoryMu.RUnlock()
+	}
+}
+
+// lockFamily блокирует сегменты так же, как lockStable, но не ждет
+// изменения дерева категорий. Вызывается внутри ChangeCategories.
+func (s *ProductStorage) lockFamily(ids func() []string) func() {
+	for {
+		s.mu.RLock()
+		expected := s.family(ids())
+		s.mu.RUnlock()
+
+		unlock := s.lockShards(expected...)
+		if equalStrings(s.family(ids()), expected) {
+			return unlock
+		}
+		unlock()
+	}
+}
+
+// family дополняет ID продуктов ID всех связанных с ними продуктов:
+// родителей и вариантов, компонентов и наборов. Запись продукта
+// пересчитывает производные поля связанных продуктов (см. syncFamily),
+// поэтому связи обходятся транзитивно. Вызывается под блокировкой хранилища.
+func (s *ProductStorage) family(ids []string) []string {
+	result := make([]string, 0, len(ids))
+	seen := make(map[string]bool, len(ids))
+	queue := append([]string(nil), ids...)
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		result = append(result, id)
+		queue = append(queue, s.related(id)...)
+	}
+	return result
+}
+
+// related возвращает ID продуктов, непосредственно связанных с продуктом id.
+// Вызывается под блокировкой хранилища.
+func (s *ProductStorage) related(id string) []string {
+	ids := s.bundleIDs(id)
+	product, exists := s.get(id)
+	if !exists {
+		return ids
+	}
+	if product.IsVariant() {
+		ids = append(ids, product.ParentID)
+	}
+	if product.IsBundle() {
+		for _, component := range product.Bundle.Components {
+			ids = append(ids, component.ProductID)
+		}
+	}
+	return append(ids, s.variantIDs(id)...)
+}
+
+// keyOwners возвращает ID продуктов и владельцев их SKU и штрихкодов.
+// Вызывается под блокировкой хранилища.
+func (s *ProductStorage) keyOwners(products []models.Product) []string {
+	ids := make([]string, 0, len(products))
+	for _, product := range products {
+		ids = append(ids, product.ID)
+		if id, exists := s.bySKU[product.SKU]; product.SKU != "" && exists {
+			ids = append(ids, id)
+		}
+		if id, exists := s.byBarcode[product.Barcode]; product.Barcode != "" && exists {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
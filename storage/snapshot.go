@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"errors"
+
+	"github.com/Afra1m/product_api/models"
+)
+
+// Snapshot является неизменяемым снимком каталога на момент версии Version.
+// Снимок читается без блокировок, и все чтения из него согласованы между
+// собой независимо от параллельной записи.
+type Snapshot struct {
+	version        uint64
+	contentVersion uint64
+	shards         []map[string]models.Product
+	size           int
+}
+
+// Snapshot возвращает снимок текущего состояния каталога. Снимки строятся
+// копированием при записи: сегмент копируется только если он изменился
+// с предыдущего снимка, а без изменений возвращается тот же снимок.
+// Снимок отражает все записи, завершившиеся до вызова.
+func (s *ProductStorage) Snapshot() *Snapshot {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	s.snapshotMu.Lock()
+	defer s.snapshotMu.Unlock()
+
+	if s.snapshot != nil {
+		return s.snapshot
+	}
+
+	snapshot := &Snapshot{
+		version:        s.version,
+		contentVersion: s.contentVersion,
+		shards:         make([]map[string]models.Product, len(s.shards)),
+	}
+	for i, sh := range s.shards {
+		if sh.frozen == nil {
+			sh.frozen = make(map[string]models.Product, len(sh.products))
+			for id, product := range sh.products {
+				sh.frozen[id] = product
+			}
+		}
+		snapshot.shards[i] = sh.frozen
+		snapshot.size += len(sh.frozen)
+	}
+	s.snapshot = snapshot
+	return snapshot
+}
+
+// Version возвращает версию каталога, на которой сделан снимок
+func (s *Snapshot) Version() uint64 {
+	return s.version
+}
+
+// ContentVersion возвращает версию последнего изменения продуктов снимка,
+// кроме сохранения счетчиков просмотров и популярности. Производные данные,
+// не зависящие от счетчиков, перестраиваются по ней, а не по Version, которая
+// растет с каждым сохранением счетчиков.
+func (s *Snapshot) ContentVersion() uint64 {
+	return s.contentVersion
+}
+
+// Len возвращает число продуктов в снимке
+func (s *Snapshot) Len() int {
+	return s.size
+}
+
+// GetByID возвращает продукт снимка по ID
+func (s *Snapshot) GetByID(id string) (models.Product, error) {
+	product, exists := s.shards[shardOf(id, len(s.shards))][id]
+	if !exists {
+		return models.Product{}, errors.New("продукт не найден")
+	}
+	return product.Clone(), nil
+}
+
+// GetAll возвращает все продукты снимка
+func (s *Snapshot) GetAll() []models.Product {
+	products := make([]models.Product, 0, s.size)
+	for _, shard := range s.shards {
+		for _, product := range shard {
+			products = append(products, product.Clone())
+		}
+	}
+	return products
+}
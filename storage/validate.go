@@ -0,0 +1,59 @@
+package storage
+
+import (
+	"errors"
+
+	"github.com/Afra1m/product_api/models"
+)
+
+// ProductValidator проверяет продукт перед сохранением. Хранилище вызывает
+// его для каждого продукта, который сохраняет операция, поэтому правила
+// действуют на всех путях записи: при слиянии, переносе категории, в наборах
+// и вариантах, а не только в обработчиках создания и обновления. Продукты,
+// у которых меняются только производные поля или счетчики, не проверяются.
+type ProductValidator interface {
+	Report(product models.Product) models.ValidationReport
+}
+
+// InvalidProductError сообщает, что продукт не прошел проверку перед
+// сохранением
+type InvalidProductError struct {
+	Report models.ValidationReport
+}
+
+// Error возвращает первую ошибку проверки продукта
+func (e *InvalidProductError) Error() string {
+	return "продукт " + e.Report.ProductID + ": " + e.Report.Errors[0].Error()
+}
+
+// IsInvalid сообщает, что продукт не прошел проверку перед сохранением
+func IsInvalid(err error) bool {
+	var invalid *InvalidProductError
+	return errors.As(err, &invalid)
+}
+
+// SetValidator задает проверку продуктов перед сохранением
+func (s *ProductStorage) SetValidator(validator ProductValidator) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.validator = validator
+}
+
+// validate проверяет продукты, сохраненные операцией. Вызывается под
+// блокировкой хранилища на чтение.
+func (t *tx) validate() error {
+	if t.s.validator == nil || t.silent {
+		return nil
+	}
+	for _, id := range t.order {
+		product := t.staged[id]
+		if product == nil || !t.checked[id] {
+			continue
+		}
+		if report := t.s.validator.Report(*product); !report.Valid {
+			return &InvalidProductError{Report: report}
+		}
+	}
+	return nil
+}
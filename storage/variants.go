@@ -0,0 +1,179 @@
+package storage
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/Afra1m/product_api/models"
+)
+
+// Вариант хранится как обычный продукт со ссылкой на родителя, поэтому
+// остатки, SKU и штрихкоды вариантов индексируются наравне с остальными
+// продуктами. Остаток родителя всегда равен сумме остатков вариантов, а
+// название, категория и цена варианта без переопределения следуют за
+// родителем; функции commit* поддерживают это при каждой записи (см.
+// family.go).
+
+// Ошибки вариантов продуктов
+var (
+	ErrNotVariantParent   = errors.New("у продукта не заданы оси вариантов")
+	ErrNestedVariant      = errors.New("вариант не может иметь собственных вариантов")
+	ErrDuplicateVariant   = errors.New("вариант с такими значениями осей уже существует")
+	ErrVariantParentStock = errors.New("остаток родительского продукта складывается из остатков вариантов")
+	ErrBundleVariants     = errors.New("набор и его компоненты не могут иметь вариантов")
+	ErrStockedParent      = errors.New("у продукта есть собственный остаток, обнулите его перед заданием осей вариантов")
+)
+
+// GetVariants возвращает родительский продукт, его варианты и сводку наличия
+func (s *ProductStorage) GetVariants(parentID string) (models.ProductVariants, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	parent, exists := s.get(parentID)
+	if !exists {
+		return models.ProductVariants{}, errors.New("продукт не найден")
+	}
+	if !parent.IsVariantParent() {
+		return models.ProductVariants{}, ErrNotVariantParent
+	}
+
+	result := models.ProductVariants{Parent: parent.Clone(), Variants: []models.Product{}}
+	for _, id := range s.variantIDs(parentID) {
+		variant, _ := s.get(id)
+		result.Variants = append(result.Variants, variant.Clone())
+
+		result.Availability.Variants++
+		result.Availability.TotalStock += variant.Stock
+		if variant.Stock > 0 {
+			result.Availability.InStockVariants++
+		} else {
+			result.Availability.OutOfStockVariants++
+		}
+	}
+	result.Availability.Available = result.Availability.InStockVariants > 0
+	return result, nil
+}
+
+// SetVariantAxes задает оси вариантов продукта. Существующие варианты должны
+// остаться допустимыми для новых осей. Остаток родителя складывается из
+// остатков вариантов, поэтому оси нельзя задать продукту с собственным
+// ненулевым остатком: иначе этот остаток пропал бы без записи в истории.
+func (s *ProductStorage) SetVariantAxes(id string, axes []models.VariantAxis) (models.Product, error) {
+	if err := models.ValidateAxes(axes); err != nil {
+		return models.Product{}, err
+	}
+
+	defer s.lockWrite(id)()
+
+	product, exists := s.get(id)
+	if !exists {
+		return models.Product{}, errors.New("продукт не найден")
+	}
+	if product.IsVariant() {
+		return models.Product{}, ErrNestedVariant
+	}
+	if product.IsBundle() || len(s.fields.byComponent[id]) > 0 {
+		return models.Product{}, ErrBundleVariants
+	}
+	if !product.IsVariantParent() && product.Stock != 0 {
+		return models.Product{}, ErrStockedParent
+	}
+	seen := make(map[string]bool)
+	for _, variantID := range s.variantIDs(id) {
+		variant, _ := s.get(variantID)
+		if err := models.ValidateOptions(axes, variant.Options); err != nil {
+			return models.Product{}, errors.New("вариант " + variant.ID + ": " + err.Error())
+		}
+		key := models.OptionsKey(axes, variant.Options)
+		if seen[key] {
+			return models.Product{}, ErrDuplicateVariant
+		}
+		seen[key] = true
+	}
+
+	product.VariantAxes = axes
+	product.UpdatedAt = time.Now()
+	if err := s.commitSave(product); err != nil {
+		return models.Product{}, err
+	}
+	product, _ = s.get(id)
+	return product.Clone(), nil
+}
+
+// CreateVariant создает вариант родительского продукта
+func (s *ProductStorage) CreateVariant(parentID string, variant models.Product) (models.Product, error) {
+	defer s.lockWrite(parentID, variant.ID)()
+
+	if _, exists := s.get(variant.ID); exists {
+		return models.Product{}, errors.New("продукт с таким ID уже существует")
+	}
+	if err := s.checkVariant(parentID, variant); err != nil {
+		return models.Product{}, err
+	}
+	if err := s.commitSave(variant); err != nil {
+		return models.Product{}, err
+	}
+	variant, _ = s.get(variant.ID)
+	return variant.Clone(), nil
+}
+
+// UpdateVariant изменяет собственные поля варианта родительского продукта
+func (s *ProductStorage) UpdateVariant(parentID, id string, input models.VariantInput) (models.Product, error) {
+	defer s.lockWrite(parentID, id)()
+
+	oldVariant, exists := s.get(id)
+	if !exists || oldVariant.ParentID != parentID {
+		return models.Product{}, errors.New("вариант не найден")
+	}
+
+	variant := oldVariant
+	variant.ApplyVariantInput(input)
+	variant.UpdatedAt = time.Now()
+	if err := s.checkVariant(parentID, variant); err != nil {
+		return models.Product{}, err
+	}
+	variant.History = changeHistory(oldVariant, variant)
+	if err := s.commitSave(variant); err != nil {
+		return models.Product{}, err
+	}
+	variant, _ = s.get(id)
+	return variant.Clone(), nil
+}
+
+// checkVariant проверяет, что вариант можно сохранить у родителя parentID:
+// опции допустимы для осей родителя и не совпадают с опциями других
+// вариантов. Вызывается под блокировкой.
+func (s *ProductStorage) checkVariant(parentID string, variant models.Product) error {
+	parent, exists := s.get(parentID)
+	if !exists {
+		return errors.New("продукт не найден")
+	}
+	if !parent.IsVariantParent() {
+		return ErrNotVariantParent
+	}
+	if err := models.ValidateOptions(parent.VariantAxes, variant.Options); err != nil {
+		return err
+	}
+
+	key := models.OptionsKey(parent.VariantAxes, variant.Options)
+	for _, id := range s.variantIDs(parentID) {
+		sibling, _ := s.get(id)
+		if id != variant.ID && models.OptionsKey(parent.VariantAxes, sibling.Options) == key {
+			return ErrDuplicateVariant
+		}
+	}
+	return nil
+}
+
+// variantIDs возвращает упорядоченные ID вариантов продукта. Вызывается под
+// блокировкой.
+func (s *ProductStorage) variantIDs(parentID string) []string {
+	set := s.fields.byParent[parentID]
+	ids := make([]string, 0, len(set))
+	for id := range set {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
@@ -0,0 +1,183 @@
+package storage
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Afra1m/product_api/models"
+)
+
+// maxDeliveriesPerWebhook ограничивает число хранимых доставок одного вебхука
+const maxDeliveriesPerWebhook = 200
+
+// WebhookStorage представляет собой хранилище вебхуков и их доставок
+type WebhookStorage struct {
+	webhooks   map[string]models.Webhook
+	deliveries map[string]models.WebhookDelivery
+	// byWebhook хранит ID доставок каждого вебхука в порядке создания
+	byWebhook map[string][]string
+	mu        sync.RWMutex
+}
+
+// NewWebhookStorage создает новое хранилище вебхуков
+func NewWebhookStorage() *WebhookStorage {
+	return &WebhookStorage{
+		webhooks:   make(map[string]models.Webhook),
+		deliveries: make(map[string]models.WebhookDelivery),
+		byWebhook:  make(map[string][]string),
+	}
+}
+
+// GetAll возвращает все вебхуки
+func (s *WebhookStorage) GetAll() []models.Webhook {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	webhooks := make([]models.Webhook, 0, len(s.webhooks))
+	for _, webhook := range s.webhooks {
+		webhooks = append(webhooks, webhook)
+	}
+	sort.Slice(webhooks, func(i, j int) bool {
+		return webhooks[i].CreatedAt.Before(webhooks[j].CreatedAt)
+	})
+	return webhooks
+}
+
+// GetByID возвращает вебхук по ID
+func (s *WebhookStorage) GetByID(id string) (models.Webhook, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	webhook, exists := s.webhooks[id]
+	if !exists {
+		return models.Webhook{}, errors.New("вебхук не найден")
+	}
+	return webhook, nil
+}
+
+// GetSubscribed возвращает активные вебхуки, подписанные на событие указанного типа
+func (s *WebhookStorage) GetSubscribed(eventType string) []models.Webhook {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var webhooks []models.Webhook
+	for _, webhook := range s.webhooks {
+		if webhook.Active && webhook.Matches(eventType) {
+			webhooks = append(webhooks, webhook)
+		}
+	}
+	return webhooks
+}
+
+// Create создает новый вебхук
+func (s *WebhookStorage) Create(webhook models.Webhook) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.webhooks[webhook.ID]; exists {
+		return errors.New("вебхук с таким ID уже существует")
+	}
+
+	s.webhooks[webhook.ID] = webhook
+	return nil
+}
+
+// Update обновляет существующий вебхук
+func (s *WebhookStorage) Update(id string, webhook models.Webhook) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.webhooks[id]; !exists {
+		return errors.New("вебхук не найден")
+	}
+
+	s.webhooks[id] = webhook
+	return nil
+}
+
+// Delete удаляет вебхук вместе с историей его доставок
+func (s *WebhookStorage) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.webhooks[id]; !exists {
+		return errors.New("вебхук не найден")
+	}
+
+	for _, deliveryID := range s.byWebhook[id] {
+		delete(s.deliveries, deliveryID)
+	}
+	delete(s.byWebhook, id)
+	delete(s.webhooks, id)
+	return nil
+}
+
+// CreateDelivery сохраняет новую доставку. Самые старые доставки вебхука
+// удаляются, если их число превышает maxDeliveriesPerWebhook.
+func (s *WebhookStorage) CreateDelivery(delivery models.WebhookDelivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.webhooks[delivery.WebhookID]; !exists {
+		return errors.New("вебхук не найден")
+	}
+
+	ids := append(s.byWebhook[delivery.WebhookID], delivery.ID)
+	if len(ids) > maxDeliveriesPerWebhook {
+		for _, old := range ids[:len(ids)-maxDeliveriesPerWebhook] {
+			delete(s.deliveries, old)
+		}
+		ids = ids[len(ids)-maxDeliveriesPerWebhook:]
+	}
+	s.byWebhook[delivery.WebhookID] = ids
+	s.deliveries[delivery.ID] = delivery
+	return nil
+}
+
+// AddAttempt добавляет попытку к доставке и обновляет ее статус
+func (s *WebhookStorage) AddAttempt(deliveryID string, attempt models.DeliveryAttempt, status string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delivery, exists := s.deliveries[deliveryID]
+	if !exists {
+		return errors.New("доставка не найдена")
+	}
+
+	delivery.Attempts = append(delivery.Attempts, attempt)
+	delivery.Status = status
+	delivery.UpdatedAt = time.Now()
+	s.deliveries[deliveryID] = delivery
+	return nil
+}
+
+// GetDelivery возвращает доставку по ID
+func (s *WebhookStorage) GetDelivery(id string) (models.WebhookDelivery, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	delivery, exists := s.deliveries[id]
+	if !exists {
+		return models.WebhookDelivery{}, errors.New("доставка не найдена")
+	}
+	return delivery, nil
+}
+
+// GetDeliveries возвращает доставки вебхука, начиная с самых новых
+func (s *WebhookStorage) GetDeliveries(webhookID string) ([]models.WebhookDelivery, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, exists := s.webhooks[webhookID]; !exists {
+		return nil, errors.New("вебхук не найден")
+	}
+
+	ids := s.byWebhook[webhookID]
+	deliveries := make([]models.WebhookDelivery, 0, len(ids))
+	for i := len(ids) - 1; i >= 0; i-- {
+		deliveries = append(deliveries, s.deliveries[ids[i]])
+	}
+	return deliveries, nil
+}
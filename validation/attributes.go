@@ -0,0 +1,85 @@
+package validation
+
+import (
+	"sort"
+
+	"github.com/Afra1m/product_api/models"
+)
+
+// SchemaProvider возвращает схему атрибутов категории вместе с
+// унаследованными определениями
+type SchemaProvider interface {
+	Schema(category string) []models.AttributeDefinition
+}
+
+// SetSchemas задает источник схем атрибутов категорий. Без него атрибуты
+// продуктов не проверяются.
+func (v *Validator) SetSchemas(schemas SchemaProvider) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.schemas = schemas
+}
+
+// AttributeErrors возвращает ошибки атрибутов продукта по схемам schemas.
+// По нему продукты проверяются по новой схеме категории до изменения дерева.
+func AttributeErrors(product models.Product, schemas SchemaProvider) []models.ValidationError {
+	var errs []models.ValidationError
+	for _, err := range checkAttributes(product, schemas) {
+		if err.Severity == models.SeverityError {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// checkAttributes проверяет атрибуты продукта по схеме его категории из
+// schemas. Несоответствие типу, недопустимое значение и отсутствие
+// обязательного атрибута являются ошибками, атрибут вне схемы —
+// предупреждением.
+func checkAttributes(product models.Product, schemas SchemaProvider) []models.ValidationError {
+	if schemas == nil {
+		return nil
+	}
+	schema := schemas.Schema(product.Category)
+	if len(schema) == 0 && len(product.Attributes) == 0 {
+		return nil
+	}
+
+	var errs []models.ValidationError
+	issue := func(name, message, severity string) {
+		errs = append(errs, models.ValidationError{
+			Field:    "attributes." + name,
+			Message:  message,
+			Severity: severity,
+			Rule:     "attribute_schema",
+		})
+	}
+
+	known := make(map[string]bool, len(schema))
+	for _, definition := range schema {
+		known[definition.Name] = true
+		value, exists := product.Attributes[definition.Name]
+		if !exists || value == nil {
+			if definition.Required {
+				issue(definition.Name, "обязательный атрибут не задан", models.SeverityError)
+			}
+			continue
+		}
+		if err := definition.Check(value); err != nil {
+			issue(definition.Name, err.Error(), models.SeverityError)
+		}
+	}
+
+	var unknown []string
+	for name := range product.Attributes {
+		if !known[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	sort.Strings(unknown)
+	for _, name := range unknown {
+		issue(name, "атрибут не описан в схеме категории", models.SeverityWarning)
+	}
+	return errs
+}
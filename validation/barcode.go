@@ -0,0 +1,58 @@
+package validation
+
+import (
+	"errors"
+)
+
+// Форматы штрихкодов GS1
+const (
+	FormatEAN8   = "EAN-8"
+	FormatUPCA   = "UPC-A"
+	FormatEAN13  = "EAN-13"
+	FormatGTIN14 = "GTIN-14"
+)
+
+var barcodeFormats = map[int]string{
+	8:  FormatEAN8,
+	12: FormatUPCA,
+	13: FormatEAN13,
+	14: FormatGTIN14,
+}
+
+// BarcodeFormat определяет формат штрихкода по длине. Контрольная цифра не
+// проверяется; для неизвестной длины возвращается пустая строка.
+func BarcodeFormat(code string) string {
+	return barcodeFormats[len(code)]
+}
+
+// ValidateBarcode проверяет штрихкод EAN-8, UPC-A, EAN-13 или GTIN-14:
+// только цифры, допустимая длина и верная контрольная цифра
+func ValidateBarcode(code string) error {
+	for _, r := range code {
+		if r < '0' || r > '9' {
+			return errors.New("штрихкод должен содержать только цифры")
+		}
+	}
+	if BarcodeFormat(code) == "" {
+		return errors.New("штрихкод должен содержать 8 (EAN-8), 12 (UPC-A), 13 (EAN-13) или 14 (GTIN-14) цифр")
+	}
+	if checkDigit(code[:len(code)-1]) != code[len(code)-1] {
+		return errors.New("неверная контрольная цифра штрихкода " + BarcodeFormat(code))
+	}
+	return nil
+}
+
+// checkDigit вычисляет контрольную цифру GS1: цифры справа налево
+// умножаются поочередно на 3 и 1, контрольная цифра дополняет сумму до
+// кратной 10
+func checkDigit(digits string) byte {
+	sum := 0
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := int(digits[i] - '0')
+		if (len(digits)-1-i)%2 == 0 {
+			d *= 3
+		}
+		sum += d
+	}
+	return byte('0' + (10-sum%10)%10)
+}
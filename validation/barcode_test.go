@@ -0,0 +1,61 @@
+package validation
+
+import "testing"
+
+func TestValidateBarcode(t *testing.T) {
+	tests := []struct {
+		code   string
+		format string
+		valid  bool
+	}{
+		{"96385074", FormatEAN8, true},
+		{"73513537", FormatEAN8, true},
+		{"96385075", FormatEAN8, false},
+		{"036000291452", FormatUPCA, true},
+		{"012345678905", FormatUPCA, true},
+		{"036000291453", FormatUPCA, false},
+		{"4006381333931", FormatEAN13, true},
+		{"5901234123457", FormatEAN13, true},
+		{"4600000000008", FormatEAN13, true},
+		{"4006381333932", FormatEAN13, false},
+		{"5901234123475", FormatEAN13, false},
+		{"10614141000415", FormatGTIN14, true},
+		{"00012345600012", FormatGTIN14, true},
+		{"10614141000414", FormatGTIN14, false},
+		{"", "", false},
+		{"1234567", "", false},
+		{"123456789", "", false},
+		{"123456789012345", "", false},
+		{"9638507A", FormatEAN8, false},
+		{"4006381 33931", FormatEAN13, false},
+		{"-96385074", "", false},
+	}
+	for _, tt := range tests {
+		if got := BarcodeFormat(tt.code); got != tt.format {
+			t.Errorf("BarcodeFormat(%q) = %q, ожидалось %q", tt.code, got, tt.format)
+		}
+		if err := ValidateBarcode(tt.code); (err == nil) != tt.valid {
+			t.Errorf("ValidateBarcode(%q): ошибка %v, ожидался верный штрихкод: %v", tt.code, err, tt.valid)
+		}
+	}
+}
+
+func TestCheckDigit(t *testing.T) {
+	tests := []struct {
+		digits string
+		want   byte
+	}{
+		{"9638507", '4'},
+		{"03600029145", '2'},
+		{"400638133393", '1'},
+		{"460000000000", '8'},
+		{"1061414100041", '5'},
+		{"0000000", '0'},
+		{"", '0'},
+	}
+	for _, tt := range tests {
+		if got := checkDigit(tt.digits); got != tt.want {
+			t.Errorf("checkDigit(%q) = %q, ожидалось %q", tt.digits, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/Afra1m/product_api/exporter"
+	"github.com/Afra1m/product_api/models"
+)
+
+// Rule проверяет продукт и возвращает нарушения. Уровень серьезности и имя
+// правила проставляет Validator по конфигурации правила.
+type Rule interface {
+	Check(product models.Product) []models.ValidationError
+}
+
+// RuleFunc позволяет использовать функцию как Rule
+type RuleFunc func(product models.Product) []models.ValidationError
+
+// Check вызывает функцию правила
+func (f RuleFunc) Check(product models.Product) []models.ValidationError {
+	return f(product)
+}
+
+// RuleFactory создает правило по его конфигурации
+type RuleFactory func(config models.ValidationRule) (Rule, error)
+
+var ruleTypes = map[string]RuleFactory{
+	"required_fields":    requiredFieldsRule,
+	"price_bounds":       priceBoundsRule,
+	"description_length": descriptionLengthRule,
+	"tag_whitelist":      tagWhitelistRule,
+	"dimensions_format":  dimensionsFormatRule,
+	"weight_positive":    weightPositiveRule,
+}
+
+// RegisterRule добавляет вид правила, который можно использовать в конфигурации.
+// Вызывается до загрузки правил, обычно при инициализации программы.
+func RegisterRule(ruleType string, factory RuleFactory) {
+	ruleTypes[ruleType] = factory
+}
+
+// newRule создает правило по конфигурации
+func newRule(config models.ValidationRule) (Rule, error) {
+	factory, exists := ruleTypes[config.Type]
+	if !exists {
+		return nil, fmt.Errorf("неизвестный вид правила %q", config.Type)
+	}
+	return factory(config)
+}
+
+// requiredFieldsRule требует непустые значения полей fields
+func requiredFieldsRule(config models.ValidationRule) (Rule, error) {
+	if len(config.Fields) == 0 {
+		return nil, errors.New("правило required_fields требует список fields")
+	}
+	for _, field := range config.Fields {
+		if !isProductField(field) {
+			return nil, fmt.Errorf("неизвестное поле %q", field)
+		}
+	}
+
+	return RuleFunc(func(product models.Product) []models.ValidationError {
+		var errs []models.ValidationError
+		for _, field := range config.Fields {
+			if isEmpty(exporter.Value(product, field)) {
+				errs = append(errs, models.ValidationError{Field: field, Message: "поле обязательно"})
+			}
+		}
+		return errs
+	}), nil
+}
+
+// priceBoundsRule ограничивает цену значениями min и max
+func priceBoundsRule(config models.ValidationRule) (Rule, error) {
+	if config.Min == nil && config.Max == nil {
+		return nil, errors.New("правило price_bounds требует min или max")
+	}
+
+	return RuleFunc(func(product models.Product) []models.ValidationError {
+		if message := checkBounds(product.Price, config.Min, config.Max); message != "" {
+			return []models.ValidationError{{Field: "price", Message: "цена " + message}}
+		}
+		return nil
+	}), nil
+}
+
+// descriptionLengthRule ограничивает длину описания в символах
+func descriptionLengthRule(config models.ValidationRule) (Rule, error) {
+	if config.Min == nil && config.Max == nil {
+		return nil, errors.New("правило description_length требует min или max")
+	}
+
+	return RuleFunc(func(product models.Product) []models.ValidationError {
+		length := float64(utf8.RuneCountInString(product.Description))
+		if message := checkBounds(length, config.Min, config.Max); message != "" {
+			return []models.ValidationError{{Field: "description", Message: "длина описания " + message}}
+		}
+		return nil
+	}), nil
+}
+
+// tagWhitelistRule разрешает только теги из списка tags
+func tagWhitelistRule(config models.ValidationRule) (Rule, error) {
+	allowed := make(map[string]bool, len(config.Tags))
+	for _, tag := range config.Tags {
+		allowed[tag] = true
+	}
+
+	return RuleFunc(func(product models.Product) []models.ValidationError {
+		var unknown []string
+		for _, tag := range product.Tags {
+			if !allowed[tag] {
+				unknown = append(unknown, tag)
+			}
+		}
+		if len(unknown) > 0 {
+			return []models.ValidationError{{Field: "tags", Message: "недопустимые теги: " + strings.Join(unknown, ", ")}}
+		}
+		return nil
+	}), nil
+}
+
+// dimensionsFormatRule требует, чтобы заданные габариты имели все три
+// измерения. Габариты, разобранные из запроса или файла импорта, уже
+// проверены при разборе; правило отмечает продукты, сохраненные до этой
+// проверки.
+func dimensionsFormatRule(config models.ValidationRule) (Rule, error) {
+	return RuleFunc(func(product models.Product) []models.ValidationError {
+		d := product.Dimensions
+		if !d.IsZero() && (d.Length == 0 || d.Width == 0 || d.Height == 0) {
+			return []models.ValidationError{{Field: "dimensions", Message: "все габариты должны быть больше 0"}}
+		}
+		return nil
+	}), nil
+}
+
+// weightPositiveRule требует положительный вес. Физические товары задаются
+// списком категорий правила.
+func weightPositiveRule(config models.ValidationRule) (Rule, error) {
+	return RuleFunc(func(product models.Product) []models.ValidationError {
+		if product.Weight.Value <= 0 {
+			return []models.ValidationError{{Field: "weight", Message: "вес должен быть больше 0"}}
+		}
+		return nil
+	}), nil
+}
+
+// checkBounds возвращает описание нарушения границ или пустую строку
+func checkBounds(value float64, min, max *float64) string {
+	if min != nil && value < *min {
+		return "меньше " + strconv.FormatFloat(*min, 'f', -1, 64)
+	}
+	if max != nil && value > *max {
+		return "больше " + strconv.FormatFloat(*max, 'f', -1, 64)
+	}
+	return ""
+}
+
+func isEmpty(value interface{}) bool {
+	switch v := value.(type) {
+	case string:
+		return strings.TrimSpace(v) == ""
+	case int:
+		return v == 0
+	case float64:
+		return v == 0
+	case []string:
+		return len(v) == 0
+	case models.Dimensions:
+		return v.IsZero()
+	case models.Weight:
+		return v.IsZero()
+	case models.Attributes:
+		return len(v) == 0
+	case nil:
+		return true
+	default:
+		return false
+	}
+}
+
+func isProductField(field string) bool {
+	for _, f := range exporter.Fields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,246 @@
+package validation
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Afra1m/product_api/importer"
+	"github.com/Afra1m/product_api/models"
+)
+
+// DefaultCategory обозначает шаблон SKU для категорий без собственного шаблона
+const DefaultCategory = "*"
+
+// Config представляет файл конфигурации проверки продуктов
+type Config struct {
+	SKUPatterns map[string]string       `json:"sku_patterns"`
+	Rules       []models.ValidationRule `json:"rules"`
+}
+
+// Validator проверяет продукты. Штрихкод и шаблоны SKU категорий проверяются
+// всегда с уровнем error, остальные правила задаются конфигурацией. Атрибуты
+// проверяются по схеме категории, если задан источник схем. Шаблоны
+// и правила могут меняться во время работы.
+type Validator struct {
+	patterns map[string]*regexp.Regexp
+	rules    []configuredRule
+	schemas  SchemaProvider
+	mu       sync.RWMutex
+}
+
+// configuredRule связывает правило с его конфигурацией
+type configuredRule struct {
+	config     models.ValidationRule
+	rule       Rule
+	categories map[string]bool
+}
+
+// NewValidator создает проверку без шаблонов SKU и правил
+func NewValidator() *Validator {
+	return &Validator{patterns: make(map[string]*regexp.Regexp)}
+}
+
+// LoadConfig загружает шаблоны SKU и правила из JSON-файла
+func (v *Validator) LoadConfig(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var config Config
+	if err := json.Unmarshal(data, &config); err != nil {
+		return errors.New("неверный формат конфигурации проверки: " + err.Error())
+	}
+
+	for category, pattern := range config.SKUPatterns {
+		if err := v.SetSKUPattern(category, pattern); err != nil {
+			return fmt.Errorf("шаблон SKU категории %q: %w", category, err)
+		}
+	}
+	return v.SetRules(config.Rules)
+}
+
+// GetRules возвращает настроенные правила
+func (v *Validator) GetRules() []models.ValidationRule {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	rules := make([]models.ValidationRule, 0, len(v.rules))
+	for _, rule := range v.rules {
+		rules = append(rules, rule.config)
+	}
+	return rules
+}
+
+// SetRules заменяет правила. Если хотя бы одно правило задано неверно,
+// текущие правила не меняются.
+func (v *Validator) SetRules(configs []models.ValidationRule) error {
+	rules := make([]configuredRule, 0, len(configs))
+	for i, config := range configs {
+		if config.Severity == "" {
+			config.Severity = models.SeverityError
+		}
+		if config.Severity != models.SeverityError && config.Severity != models.SeverityWarning {
+			return fmt.Errorf("правило %d: неверный уровень %q", i+1, config.Severity)
+		}
+		if config.Name == "" {
+			config.Name = config.Type
+		}
+
+		rule, err := newRule(config)
+		if err != nil {
+			return fmt.Errorf("правило %d: %w", i+1, err)
+		}
+
+		var categories map[string]bool
+		if len(config.Categories) > 0 {
+			categories = make(map[string]bool, len(config.Categories))
+			for _, category := range config.Categories {
+				categories[category] = true
+			}
+		}
+		rules = append(rules, configuredRule{config: config, rule: rule, categories: categories})
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.rules = rules
+	return nil
+}
+
+// GetSKUPatterns возвращает шаблоны SKU, упорядоченные по категории
+func (v *Validator) GetSKUPatterns() []models.SKUPattern {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	patterns := make([]models.SKUPattern, 0, len(v.patterns))
+	for category, re := range v.patterns {
+		patterns = append(patterns, models.SKUPattern{Category: category, Pattern: source(re)})
+	}
+	sort.Slice(patterns, func(i, j int) bool {
+		return patterns[i].Category < patterns[j].Category
+	})
+	return patterns
+}
+
+// SetSKUPattern устанавливает шаблон SKU категории. Шаблон должен совпадать
+// с SKU целиком.
+func (v *Validator) SetSKUPattern(category, pattern string) error {
+	re, err := regexp.Compile("^(?:" + pattern + ")$")
+	if err != nil {
+		return errors.New("неверное регулярное выражение: " + err.Error())
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.patterns[category] = re
+	return nil
+}
+
+// DeleteSKUPattern удаляет шаблон SKU категории
+func (v *Validator) DeleteSKUPattern(category string) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if _, exists := v.patterns[category]; !exists {
+		return errors.New("шаблон SKU не найден")
+	}
+	delete(v.patterns, category)
+	return nil
+}
+
+// Validate проверяет продукт и возвращает нарушения всех уровней. Пустые
+// SKU и штрихкод не проверяются.
+func (v *Validator) Validate(product models.Product) []models.ValidationError {
+	var errs []models.ValidationError
+
+	if product.Barcode != "" {
+		if err := ValidateBarcode(product.Barcode); err != nil {
+			errs = append(errs, models.ValidationError{
+				Field:    "barcode",
+				Message:  err.Error(),
+				Severity: models.SeverityError,
+				Rule:     "barcode",
+			})
+		}
+	}
+
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	if product.SKU != "" {
+		re, exists := v.patterns[product.Category]
+		if !exists {
+			re = v.patterns[DefaultCategory]
+		}
+		if re != nil && !re.MatchString(product.SKU) {
+			errs = append(errs, models.ValidationError{
+				Field:    "sku",
+				Message:  "SKU не соответствует шаблону категории " + source(re),
+				Severity: models.SeverityError,
+				Rule:     "sku_pattern",
+			})
+		}
+	}
+
+	errs = append(errs, checkAttributes(product, v.schemas)...)
+
+	for _, rule := range v.rules {
+		if rule.categories != nil && !rule.categories[product.Category] {
+			continue
+		}
+		for _, err := range rule.rule.Check(product) {
+			err.Severity = rule.config.Severity
+			err.Rule = rule.config.Name
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// Report проверяет продукт и разделяет нарушения на ошибки и предупреждения
+func (v *Validator) Report(product models.Product) models.ValidationReport {
+	report := models.ValidationReport{
+		ProductID: product.ID,
+		Name:      product.Name,
+		Category:  product.Category,
+		Errors:    []models.ValidationError{},
+		Warnings:  []models.ValidationError{},
+	}
+	for _, err := range v.Validate(product) {
+		if err.Severity == models.SeverityWarning {
+			report.Warnings = append(report.Warnings, err)
+		} else {
+			report.Errors = append(report.Errors, err)
+		}
+	}
+	report.Valid = len(report.Errors) == 0
+	return report
+}
+
+// ValidateRows дополняет ошибки строк импорта, прошедших разбор, нарушениями
+// уровня error. Предупреждения импорт не останавливают.
+func (v *Validator) ValidateRows(rows []importer.Row) {
+	for i, row := range rows {
+		if !row.Valid() {
+			continue
+		}
+		for _, err := range v.Report(models.NewProduct(row.Input, time.Time{})).Errors {
+			rows[i].Errors = append(rows[i].Errors, err.Error())
+		}
+	}
+}
+
+// source возвращает шаблон в том виде, в котором он был задан
+func source(re *regexp.Regexp) string {
+	s := re.String()
+	return s[len("^(?:") : len(s)-len(")$")]
+}
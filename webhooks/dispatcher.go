@@ -0,0 +1,213 @@
+package webhooks
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/Afra1m/product_api/models"
+	"github.com/Afra1m/product_api/storage"
+)
+
+// Заголовки запроса доставки
+const (
+	HeaderDeliveryID = "X-Webhook-Delivery"
+	HeaderEvent      = "X-Webhook-Event"
+	HeaderTimestamp  = "X-Webhook-Timestamp"
+	HeaderSignature  = "X-Webhook-Signature"
+)
+
+// Dispatcher доставляет события продуктов на зарегистрированные вебхуки.
+// Каждая доставка выполняется в отдельной горутине с повторными попытками
+// и экспоненциальной задержкой между ними.
+type Dispatcher struct {
+	storage *storage.WebhookStorage
+	client  *http.Client
+
+	// MaxAttempts ограничивает число попыток одной доставки
+	MaxAttempts int
+	// BaseDelay задает задержку перед второй попыткой, далее она удваивается
+	BaseDelay time.Duration
+	// MaxDelay ограничивает задержку между попытками
+	MaxDelay time.Duration
+}
+
+// NewDispatcher создает новый диспетчер вебхуков
+func NewDispatcher(storage *storage.WebhookStorage) *Dispatcher {
+	return &Dispatcher{
+		storage:     storage,
+		client:      &http.Client{Timeout: 10 * time.Second},
+		MaxAttempts: 5,
+		BaseDelay:   time.Second,
+		MaxDelay:    time.Minute,
+	}
+}
+
+// HandleEvent создает доставки события для всех подписанных вебхуков.
+// Метод не блокируется: отправка выполняется в фоне.
+func (d *Dispatcher) HandleEvent(event models.ProductEvent) error {
+	webhooks := d.storage.GetSubscribed(event.Type)
+	if len(webhooks) == 0 {
+		return nil
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	for _, webhook := range webhooks {
+		delivery := newDelivery(webhook.ID, event.ID, event.Type, payload)
+		if err := d.storage.CreateDelivery(delivery); err != nil {
+			// Вебхук мог быть удален после выборки
+			continue
+		}
+		go d.deliver(webhook, delivery)
+	}
+	return nil
+}
+
+// Redeliver повторно отправляет сохраненную доставку как новую доставку
+// с тем же содержимым
+func (d *Dispatcher) Redeliver(deliveryID string) (models.WebhookDelivery, error) {
+	original, err := d.storage.GetDelivery(deliveryID)
+	if err != nil {
+		return models.WebhookDelivery{}, err
+	}
+
+	webhook, err := d.storage.GetByID(original.WebhookID)
+	if err != nil {
+		return models.WebhookDelivery{}, err
+	}
+
+	delivery := newDelivery(webhook.ID, original.EventID, original.EventType, original.Payload)
+	delivery.RedeliveryOf = original.ID
+	if err := d.storage.CreateDelivery(delivery); err != nil {
+		return models.WebhookDelivery{}, err
+	}
+
+	go d.deliver(webhook, delivery)
+	return delivery, nil
+}
+
+// deliver выполняет попытки доставки, пока одна из них не завершится успешно
+// или не будет исчерпан лимит попыток
+func (d *Dispatcher) deliver(webhook models.Webhook, delivery models.WebhookDelivery) {
+	for attempt := 1; attempt <= d.MaxAttempts; attempt++ {
+		if attempt > 1 {
+			time.Sleep(d.backoff(attempt))
+		}
+
+		result := d.send(webhook, delivery, attempt)
+
+		status := models.DeliveryPending
+		if result.Error == "" {
+			status = models.DeliverySucceeded
+		} else if attempt == d.MaxAttempts {
+			status = models.DeliveryFailed
+		}
+
+		if err := d.storage.AddAttempt(delivery.ID, result, status); err != nil {
+			// Доставка удалена вместе с вебхуком
+			return
+		}
+		if status != models.DeliveryPending {
+			return
+		}
+	}
+}
+
+// send выполняет одну попытку доставки
+func (d *Dispatcher) send(webhook models.Webhook, delivery models.WebhookDelivery, number int) models.DeliveryAttempt {
+	started := time.Now()
+	attempt := models.DeliveryAttempt{
+		Number:    number,
+		Timestamp: started,
+	}
+
+	err := func() error {
+		req, err := http.NewRequest(http.MethodPost, webhook.URL, bytes.NewReader(delivery.Payload))
+		if err != nil {
+			return err
+		}
+
+		timestamp := strconv.FormatInt(started.Unix(), 10)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(HeaderDeliveryID, delivery.ID)
+		req.Header.Set(HeaderEvent, delivery.EventType)
+		req.Header.Set(HeaderTimestamp, timestamp)
+		req.Header.Set(HeaderSignature, Sign(webhook.Secret, timestamp, delivery.Payload))
+
+		resp, err := d.client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		attempt.StatusCode = resp.StatusCode
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return fmt.Errorf("получатель ответил статусом %d", resp.StatusCode)
+		}
+		return nil
+	}()
+	if err != nil {
+		attempt.Error = err.Error()
+	}
+
+	attempt.DurationMs = time.Since(started).Milliseconds()
+	return attempt
+}
+
+// backoff возвращает задержку перед попыткой с указанным номером
+func (d *Dispatcher) backoff(attempt int) time.Duration {
+	delay := d.BaseDelay
+	for i := 2; i < attempt; i++ {
+		delay *= 2
+		if delay >= d.MaxDelay {
+			return d.MaxDelay
+		}
+	}
+	return delay
+}
+
+// Sign вычисляет подпись тела запроса: HMAC-SHA256 от строки "<timestamp>.<body>"
+// с секретом вебхука. Получатель должен сравнить ее с заголовком X-Webhook-Signature.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify проверяет подпись доставки
+func Verify(secret, timestamp string, body []byte, signature string) error {
+	if !hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature)) {
+		return errors.New("неверная подпись вебхука")
+	}
+	return nil
+}
+
+func newDelivery(webhookID, eventID, eventType string, payload []byte) models.WebhookDelivery {
+	now := time.Now()
+	return models.WebhookDelivery{
+		ID:        uuid.New().String(),
+		WebhookID: webhookID,
+		EventID:   eventID,
+		EventType: eventType,
+		Payload:   payload,
+		Status:    models.DeliveryPending,
+		Attempts:  []models.DeliveryAttempt{},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+}
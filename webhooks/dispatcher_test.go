@@ -0,0 +1,232 @@
+package webhooks
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Afra1m/product_api/models"
+	"github.com/Afra1m/product_api/storage"
+)
+
+// request хранит запрос, полученный тестовым получателем
+type request struct {
+	header http.Header
+	body   []byte
+	at     time.Time
+}
+
+// receiver является тестовым получателем вебхуков: i-й запрос получает
+// статус statuses[i], а запросы сверх списка — последний статус списка
+type receiver struct {
+	statuses []int
+	requests []request
+	mu       sync.Mutex
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+
+	r.mu.Lock()
+	r.requests = append(r.requests, request{header: req.Header.Clone(), body: body, at: time.Now()})
+	status := r.statuses[len(r.statuses)-1]
+	if len(r.requests) <= len(r.statuses) {
+		status = r.statuses[len(r.requests)-1]
+	}
+	r.mu.Unlock()
+
+	w.WriteHeader(status)
+}
+
+func (r *receiver) received() []request {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]request(nil), r.requests...)
+}
+
+// newTestDispatcher создает диспетчер с короткими задержками и вебхук,
+// подписанный на все события, с адресом тестового сервера
+func newTestDispatcher(t *testing.T, server *httptest.Server, maxAttempts int) (*Dispatcher, models.Webhook) {
+	t.Helper()
+	webhooks := storage.NewWebhookStorage()
+	webhook := models.Webhook{
+		ID:     "webhook",
+		URL:    server.URL,
+		Events: []string{"*"},
+		Secret: "secret",
+		Active: true,
+	}
+	if err := webhooks.Create(webhook); err != nil {
+		t.Fatal(err)
+	}
+
+	dispatcher := NewDispatcher(webhooks)
+	dispatcher.MaxAttempts = maxAttempts
+	dispatcher.BaseDelay = 20 * time.Millisecond
+	dispatcher.MaxDelay = 40 * time.Millisecond
+	return dispatcher, webhook
+}
+
+// waitDelivery ждет завершения единственной доставки вебхука
+func waitDelivery(t *testing.T, d *Dispatcher, webhookID string) models.WebhookDelivery {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		deliveries, err := d.storage.GetDeliveries(webhookID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(deliveries) == 1 && deliveries[0].Status != models.DeliveryPending {
+			return deliveries[0]
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("доставка не завершилась")
+	return models.WebhookDelivery{}
+}
+
+func testEvent() models.ProductEvent {
+	return models.ProductEvent{
+		ID:        "event",
+		Type:      "product.created",
+		ProductID: "product",
+		Timestamp: time.Now(),
+	}
+}
+
+// TestDeliverySignature проверяет, что получатель может проверить подпись
+// доставки секретом вебхука, а измененное тело или чужой секрет ее не проходят
+func TestDeliverySignature(t *testing.T) {
+	receiver := &receiver{statuses: []int{http.StatusOK}}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	d, webhook := newTestDispatcher(t, server, 1)
+	if err := d.HandleEvent(testEvent()); err != nil {
+		t.Fatal(err)
+	}
+	delivery := waitDelivery(t, d, webhook.ID)
+	if delivery.Status != models.DeliverySucceeded {
+		t.Fatalf("статус доставки %q", delivery.Status)
+	}
+
+	requests := receiver.received()
+	if len(requests) != 1 {
+		t.Fatalf("получено %d запросов, ожидался один", len(requests))
+	}
+	req := requests[0]
+	timestamp, signature := req.header.Get(HeaderTimestamp), req.header.Get(HeaderSignature)
+	if err := Verify(webhook.Secret, timestamp, req.body, signature); err != nil {
+		t.Fatal(err)
+	}
+	if req.header.Get(HeaderDeliveryID) != delivery.ID || req.header.Get(HeaderEvent) != "product.created" {
+		t.Fatalf("неверные заголовки доставки: %v", req.header)
+	}
+	if string(req.body) != string(delivery.Payload) {
+		t.Fatalf("тело запроса %s не совпадает с содержимым доставки %s", req.body, delivery.Payload)
+	}
+
+	tampered := append([]byte(nil), req.body...)
+	tampered[len(tampered)-2] ^= 1
+	if Verify(webhook.Secret, timestamp, tampered, signature) == nil {
+		t.Fatal("подпись прошла проверку с измененным телом")
+	}
+	if Verify("other", timestamp, req.body, signature) == nil {
+		t.Fatal("подпись прошла проверку с чужим секретом")
+	}
+	if Verify(webhook.Secret, timestamp+"0", req.body, signature) == nil {
+		t.Fatal("подпись прошла проверку с другим временем")
+	}
+}
+
+// TestDeliveryRetries проверяет, что неудачные попытки повторяются с
+// растущей задержкой той же доставкой, пока получатель не ответит успехом
+func TestDeliveryRetries(t *testing.T) {
+	receiver := &receiver{statuses: []int{http.StatusInternalServerError, http.StatusServiceUnavailable, http.StatusNoContent}}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	d, webhook := newTestDispatcher(t, server, 5)
+	if err := d.HandleEvent(testEvent()); err != nil {
+		t.Fatal(err)
+	}
+	delivery := waitDelivery(t, d, webhook.ID)
+	if delivery.Status != models.DeliverySucceeded {
+		t.Fatalf("статус доставки %q", delivery.Status)
+	}
+
+	wantCodes := []int{http.StatusInternalServerError, http.StatusServiceUnavailable, http.StatusNoContent}
+	if len(delivery.Attempts) != len(wantCodes) {
+		t.Fatalf("сделано %d попыток, ожидалось %d", len(delivery.Attempts), len(wantCodes))
+	}
+	for i, attempt := range delivery.Attempts {
+		if attempt.Number != i+1 || attempt.StatusCode != wantCodes[i] {
+			t.Fatalf("попытка %d: номер %d, статус %d", i+1, attempt.Number, attempt.StatusCode)
+		}
+		if (attempt.Error == "") != (i == len(wantCodes)-1) {
+			t.Fatalf("попытка %d: ошибка %q", i+1, attempt.Error)
+		}
+	}
+
+	requests := receiver.received()
+	if len(requests) != len(wantCodes) {
+		t.Fatalf("получено %d запросов, ожидалось %d", len(requests), len(wantCodes))
+	}
+	for i, req := range requests {
+		if req.header.Get(HeaderDeliveryID) != delivery.ID {
+			t.Fatalf("запрос %d отправлен с другим ID доставки", i+1)
+		}
+		if err := Verify(webhook.Secret, req.header.Get(HeaderTimestamp), req.body, req.header.Get(HeaderSignature)); err != nil {
+			t.Fatalf("запрос %d: %v", i+1, err)
+		}
+	}
+	// Перед второй попыткой ждем BaseDelay, перед третьей — вдвое дольше
+	for i, want := range []time.Duration{d.BaseDelay, 2 * d.BaseDelay} {
+		if gap := requests[i+1].at.Sub(requests[i].at); gap < want {
+			t.Fatalf("попытка %d отправлена через %v, ожидалось не меньше %v", i+2, gap, want)
+		}
+	}
+}
+
+// TestDeliveryGivesUp проверяет, что после MaxAttempts неудачных попыток
+// доставка получает статус failed и больше не повторяется
+func TestDeliveryGivesUp(t *testing.T) {
+	receiver := &receiver{statuses: []int{http.StatusBadGateway}}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	d, webhook := newTestDispatcher(t, server, 3)
+	if err := d.HandleEvent(testEvent()); err != nil {
+		t.Fatal(err)
+	}
+	delivery := waitDelivery(t, d, webhook.ID)
+	if delivery.Status != models.DeliveryFailed || len(delivery.Attempts) != 3 {
+		t.Fatalf("статус доставки %q после %d попыток", delivery.Status, len(delivery.Attempts))
+	}
+
+	time.Sleep(3 * d.MaxDelay)
+	if requests := receiver.received(); len(requests) != 3 {
+		t.Fatalf("получено %d запросов, ожидалось 3", len(requests))
+	}
+}
+
+// TestBackoff проверяет удвоение задержки между попытками и ее ограничение
+func TestBackoff(t *testing.T) {
+	d := &Dispatcher{BaseDelay: time.Second, MaxDelay: 5 * time.Second}
+	want := map[int]time.Duration{
+		2: time.Second,
+		3: 2 * time.Second,
+		4: 4 * time.Second,
+		5: 5 * time.Second,
+		9: 5 * time.Second,
+	}
+	for attempt, delay := range want {
+		if got := d.backoff(attempt); got != delay {
+			t.Errorf("задержка перед попыткой %d равна %v, ожидалось %v", attempt, got, delay)
+		}
+	}
+}